@@ -0,0 +1,266 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var aggregateStr = "agg"          //object type of the composite keys that store the running exchange totals
+var aggregateMemberStr = "aggmbr" //object type of the keys that remember which members were already counted
+var allPartners = "all"           //partner name used for the totals over every partner
+
+var aggregatePeriods = []string{"day", "week", "month"}
+
+// Aggregate holds the running totals of one seller for one calendar bucket.
+// POINTS_OUT are the seller's own points its members exchanged away, POINTS_IN
+// are the partner points its members received for them.
+type Aggregate struct {
+	Seller    string `json:"SELLER_ID"`
+	Partner   string `json:"PARTNER_ID"`
+	Period    string `json:"PERIOD"`
+	Bucket    string `json:"BUCKET"`
+	PointsOut int    `json:"POINTS_OUT"`
+	PointsIn  int    `json:"POINTS_IN"`
+	Exchanges int    `json:"EXCHANGES"`
+	Members   int    `json:"UNIQUE_MEMBERS"`
+}
+
+type AllAggregate struct {
+	Aggs []Aggregate `json:"agg"`
+}
+
+// ============================================================================================================================
+// Aggregate buckets - name of the day/week/month bucket a timestamp (ms, UTC) falls into
+// ============================================================================================================================
+func aggregateBucket(period string, ms int64) (string, error) {
+	tm := time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC()
+	switch period {
+	case "day":
+		return tm.Format("2006-01-02"), nil
+	case "week":
+		year, week := tm.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week), nil
+	case "month":
+		return tm.Format("2006-01"), nil
+	}
+	return "", ParamError("Unknown period " + period + ". Expecting day, week or month")
+}
+
+func aggregateKey(stub shim.ChaincodeStubInterface, seller string, partner string, period string, bucket string) (string, error) {
+	return stub.CreateCompositeKey(aggregateStr, []string{seller, partner, period, bucket})
+}
+
+// partnerShare is what the members of a seller gave the members of a partner seller in one exchange and received from them
+type partnerShare struct {
+	partner string
+	out     int
+	in      int
+	members []string
+}
+
+// aggregateSide is the part one member of a seller played in an exchange
+type aggregateSide struct {
+	seller string
+	member string
+	shares []partnerShare
+}
+
+// ============================================================================================================================
+// Add Aggregates - add the sides of an exchange to the running totals of their sellers. A seller on several sides counts
+// the exchange once, with what all of its members gave and received
+// ============================================================================================================================
+func addAggregates(stub shim.ChaincodeStubInterface, sides []aggregateSide, ms int64) error {
+	var sellers []string
+	shares := make(map[string][]partnerShare)
+	for _, side := range sides {
+		seller := normalSeller(side.seller)
+		if _, ok := shares[seller]; !ok {
+			sellers = append(sellers, seller)
+		}
+		merged := shares[seller]
+		for _, share := range side.shares {
+			merged = addShare(merged, partnerShare{normalSeller(share.partner), share.out, share.in, []string{side.member}})
+		}
+		shares[seller] = merged
+	}
+	for _, seller := range sellers {
+		err := updateAggregates(stub, seller, shares[seller], ms)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addShare - add share to the one of the same partner in shares, or append it
+func addShare(shares []partnerShare, share partnerShare) []partnerShare {
+	for i := range shares {
+		if shares[i].partner == share.partner {
+			shares[i].out += share.out
+			shares[i].in += share.in
+			for _, m := range share.members {
+				if !containsString(shares[i].members, m) {
+					shares[i].members = append(shares[i].members, m)
+				}
+			}
+			return shares
+		}
+	}
+	return append(shares, share)
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Update Aggregates - add the shares of a seller in one exchange to its running totals, once per partner it dealt with
+// and once over every partner. The writes of a transaction are not visible to its own reads, so each key is written once
+// ============================================================================================================================
+func updateAggregates(stub shim.ChaincodeStubInterface, seller string, shares []partnerShare, ms int64) error {
+	total := partnerShare{partner: allPartners}
+	for _, share := range shares {
+		total.out += share.out
+		total.in += share.in
+		for _, m := range share.members {
+			if !containsString(total.members, m) {
+				total.members = append(total.members, m)
+			}
+		}
+	}
+	for _, period := range aggregatePeriods {
+		bucket, err := aggregateBucket(period, ms)
+		if err != nil {
+			return err
+		}
+		for _, share := range append(shares, total) {
+			p := share.partner
+			key, err := aggregateKey(stub, seller, p, period, bucket)
+			if err != nil {
+				return ParamError(err.Error())
+			}
+			aggAsBytes, err := stub.GetState(key)
+			if err != nil {
+				return errors.New("Failed to get aggregate " + key)
+			}
+			agg := Aggregate{Seller: seller, Partner: p, Period: period, Bucket: bucket}
+			if aggAsBytes != nil {
+				json.Unmarshal(aggAsBytes, &agg)
+			}
+			agg.PointsOut += share.out
+			agg.PointsIn += share.in
+			agg.Exchanges++
+
+			for _, member := range share.members {
+				memberKey, err := stub.CreateCompositeKey(aggregateMemberStr, []string{seller, p, period, bucket, member})
+				if err != nil {
+					return ParamError(err.Error())
+				}
+				seen, err := stub.GetState(memberKey)
+				if err != nil {
+					return errors.New("Failed to get aggregate member " + memberKey)
+				}
+				if seen == nil {
+					agg.Members++
+					err = stub.PutState(memberKey, []byte("1"))
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			jsonAsBytes, _ := json.Marshal(agg)
+			err = stub.PutState(key, jsonAsBytes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Find Aggregate - totals of a seller per day/week/month between two timestamps (ms)
+// ============================================================================================================================
+func (t *SimpleChaincode) findAggregate(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//    0         1        2       3       4
+	// "seller", "day", "from", "to", *"partner"*
+	seller := normalSeller(args[0]) //"007" and "7" are the same seller
+	period := args[1]
+	from, _ := strconv.ParseInt(args[2], 10, 64) //numbers are checked by the registry
+	to, _ := strconv.ParseInt(args[3], 10, 64)
+	partner := allPartners
+	if len(args) == 5 && len(args[4]) > 0 {
+		partner = normalSeller(args[4])
+	}
+
+	fromBucket, err := aggregateBucket(period, from)
+	if err != nil {
+		return nil, err
+	}
+	toBucket, _ := aggregateBucket(period, to)
+
+	keysIter, err := stub.GetStateByPartialCompositeKey(aggregateStr, []string{seller, partner, period})
+	if err != nil {
+		return nil, errors.New("Failed to get aggregates")
+	}
+	defer keysIter.Close()
+
+	var processed AllAggregate
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get aggregates")
+		}
+		_, attrs, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(attrs) != 4 || attrs[3] < fromBucket || attrs[3] > toBucket { //bucket names sort like time
+			continue
+		}
+		agg := Aggregate{}
+		json.Unmarshal(kv.Value, &agg)
+		processed.Aggs = append(processed.Aggs, agg)
+	}
+	if len(processed.Aggs) == 0 {
+		return nil, NotFoundError("No records")
+	}
+	jsonAsBytes, _ := json.Marshal(processed)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Clear Object Type - delete every composite key of one object type, used by Init to reset derived state
+// ============================================================================================================================
+func clearObjectType(stub shim.ChaincodeStubInterface, objectType string) error {
+	keysIter, err := stub.GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			keysIter.Close()
+			return err
+		}
+		keys = append(keys, kv.Key)
+	}
+	keysIter.Close()
+
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// bundlePayloadVersion heads the payload the sellers of a bundle exchange sign,
+// so that it never verifies as the payload of an exchange without points
+var bundlePayloadVersion = "ccpx-bundle-v1"
+
+// BundlePayload is what the sellers of a bundle exchange sign: the arguments
+// of init_bundle_exchange from txID to NONCE exactly as they are passed, one
+// per line after a version line. The signature is ASN.1 ECDSA over its SHA-256.
+func BundlePayload(args []string) []byte {
+	return []byte(bundlePayloadVersion + "\n" + strings.Join(args, "\n"))
+}
+
+// ============================================================================================================================
+// Init Bundle Exchange - record an exchange that also hands point lots over, each from the member holding it to the
+// other member. The owner of each point must be USER_A_ID or USER_B_ID and hold it. The points are listed in the
+// related field of the exchange with the owner that gave them, in findLatest/findRange and in the exports.
+// ============================================================================================================================
+func (t *SimpleChaincode) init_bundle_exchange(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0        1          2          3            4            5          6          7          8                              9          10              11
+	//["txID", "USER_A_ID", "USER_B_ID", "SELLER_A_ID", "SELLER_B_ID", "POINT_A", "POINT_B", "EX_TIME", "[{"id","owner"}, ...]", *"NONCE"*, *"SIGNATURE_A"*, *"SIGNATURE_B"*]
+	opt := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	nonce := opt(9)
+	payload := BundlePayload(append(append([]string{}, args[:9]...), nonce))
+	err := checkSignatures(stub, args[0], payload, nonce, []signedSide{{args[3], opt(10), "SIGNATURE_A"}, {args[4], opt(11), "SIGNATURE_B"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var related []Point
+	if err := json.Unmarshal([]byte(args[8]), &related); err != nil || len(related) == 0 {
+		return nil, ParamError("RELATED must be a non-empty list of {id, owner}")
+	}
+	userA, userB := strings.ToLower(args[1]), strings.ToLower(args[2]) //owners are lower case
+	if userA == userB {
+		return nil, ParamError("A bundle needs two different members, " + args[1] + " is on both sides")
+	}
+	receivers := make([]string, len(related))
+	seen := make(map[string]bool)
+	for i, p := range related {
+		if seen[p.Id] {
+			return nil, ParamError("Point " + p.Id + " is listed twice")
+		}
+		seen[p.Id] = true
+		switch strings.ToLower(p.Owner) {
+		case userA:
+			receivers[i] = userB
+		case userB:
+			receivers[i] = userA
+		default:
+			return nil, ParamError(fmt.Sprintf("Point %s must be given by %s or %s", p.Id, args[1], args[2]))
+		}
+		pointAsBytes, err := stub.GetState(p.Id)
+		if err != nil {
+			return nil, errors.New("Failed to get point " + p.Id)
+		}
+		if pointAsBytes == nil {
+			return nil, NotFoundError("Point " + p.Id + " does not exist")
+		}
+		held := Point{}
+		json.Unmarshal(pointAsBytes, &held)
+		if held.Id != p.Id || held.Owner != strings.ToLower(p.Owner) {
+			return nil, PermissionError("Point " + p.Id + " is not held by " + p.Owner)
+		}
+		related[i] = held
+	}
+
+	_, err = recordExchange(stub, args[:8], related)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range related {
+		err = movePoint(stub, p, receivers[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// movePoint - hand a point over to a new owner, as set_user does
+func movePoint(stub shim.ChaincodeStubInterface, p Point, owner string) error {
+	moved := p
+	moved.Owner = owner
+	jsonAsBytes, _ := json.Marshal(moved)
+	err := stub.PutState(p.Id, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	err = recordOwnerChange(stub, p.Id, p.Owner, owner)
+	if err != nil {
+		return err
+	}
+	err = removeFromOwnerIndex(stub, p.Owner, p.Id)
+	if err != nil {
+		return err
+	}
+	return addToOwnerIndex(stub, owner, p.Id)
+}
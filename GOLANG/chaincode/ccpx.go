@@ -0,0 +1,880 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package chaincode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"time"
+	"strings"
+	"math"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// SimpleChaincode example simple Chaincode implementation, started by ../ccpx/main.go
+type SimpleChaincode struct {
+}
+
+var pointIndexStr = "_pointindex"				//name for the key/value that will store a list of all known marbles
+var transectionStr = "_tx"				//name for the key/value that will store all open trades
+var tmpStr = "_tmpIndex"
+
+var minimalTxStr = "_minimaltx"				//list of every exchange of older ledgers, only read by findExchanges now
+var txRecordStr = "tx"						//object type of the composite keys that store one exchange each
+var sellerTxIndexStr = "seller~time~tx"		//object type of the index of the exchanges of a seller, in time order
+
+type Point struct{
+	Id string `json:"id"`					//the fieldtags are needed to keep case from bouncing around
+	Owner string `json:"owner"`
+	Points int `json:"points,omitempty"`			//what the lot is worth, only lots issued by credit_member carry points
+}
+
+type Description struct{
+	Color string `json:"color"`
+	Size int `json:"size"`
+}
+
+type Transaction struct{
+	Id string `json:"txID"`					//user who created the open trade order
+	Timestamp string `json:"EX_TIME"`			//utc timestamp of creation
+	TraderA string  `json:"USER_A_ID"`				//description of desired marble
+	TraderB string  `json:"USER_B_ID"`
+	SellerA string  `json:"SELLER_A_ID"`				//description of desired marble
+	SellerB string  `json:"SELLER_B_ID"`
+	PointA string  `json:"POINT_A"`
+	PointB string  `json:"POINT_B"`
+	Related []Point `json:"related"`		//array of marbles willing to trade away
+	Legs []Leg `json:"legs,omitempty"`		//the members of a ring exchange, the A and B fields are empty then
+	Erased string `json:"erased,omitempty"`	//the erasure that removed its members, see erase_member
+}
+
+type AllTx struct{
+	TXs []Transaction `json:"tx"`
+}
+
+// ============================================================================================================================
+// Init - reset all the things
+// ============================================================================================================================
+func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()								//the instantiate call is ["init", "<abc>"]
+	args, err := registry["init"].parseArgs(args)							//deploy skips the role check, the deployer owns the chaincode
+	if err == nil {
+		_, err = t.reset(stub, args)
+	}
+	if err != nil {
+		err = InitError(err.Error())											//any failure here is an init error for the client
+	}
+	return respond(nil, err, false)
+}
+
+func (t *SimpleChaincode) reset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var Aval int
+	var err error
+
+	// Initialize the chaincode
+	Aval, _ = strconv.Atoi(args[0])										//checked by the registry
+
+	// Write the state to the ledger
+	err = stub.PutState("abc", []byte(strconv.Itoa(Aval)))				//making a test var "abc", I find it handy to read/write to it right away to test the network
+	if err != nil {
+		return nil, err
+	}
+	
+	var empty []string
+	jsonAsBytes, _ := json.Marshal(empty)								//marshal an emtpy array of strings to clear the index
+	err = stub.PutState(pointIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	
+	err = stub.PutState(tmpStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	var trades AllTx
+	jsonAsBytes, _ = json.Marshal(trades)								//clear the open trade struct
+	err = stub.PutState(transectionStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(minimalTxStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, objectType := range []string{aggregateStr, aggregateMemberStr, pointHistoryStr, ownerIndexStr, txRecordStr, sellerTxIndexStr, reconciliationStr, merkleStr, merkleLeafStr, merklePosStr} {
+		err = clearObjectType(stub, objectType)						//drop the derived state, it is rebuilt from new records
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Invoke - Our entry point for Invocations and Queries, answers with a Response envelope
+// ============================================================================================================================
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+
+	if function == "read" && len(args) > 0 {								//legacy form, the query name is the 1st argument of read
+		if spec, ok := registry[args[0]]; ok && spec.Kind == kindQuery {
+			function = args[0]
+			args = args[1:]
+		}
+	}
+	spec, ok := registry[function]
+	if !ok {
+		return respond(nil, ParamError("Received unknown function invocation " + function), false)
+	}
+	res, err := t.dispatch(stub, spec, args)
+	return respond(res, err, spec.Kind == kindQuery)
+}
+
+// ============================================================================================================================
+// Read - read a variable from chaincode state
+// ============================================================================================================================
+func (t *SimpleChaincode) read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var jsonResp string
+
+	//   0
+	// "key"
+	valAsbytes, err := stub.GetState(args[0])									//get the var from chaincode state
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + args[0] + "\"}"
+		return nil, errors.New(jsonResp)
+	}
+	if valAsbytes == nil {
+		return nil, NotFoundError("No records for " + args[0])
+	}
+	return valAsbytes, nil
+}
+
+// ============================================================================================================================
+// Seller Txs - the exchanges a seller took part in, oldest first, from the seller~time~tx index
+// ============================================================================================================================
+func sellerTxs(stub shim.ChaincodeStubInterface, seller int, from int64, to int64) ([]Transaction, error) {
+	keysIter, err := stub.GetStateByPartialCompositeKey(sellerTxIndexStr, []string{strconv.Itoa(seller)})
+	if err != nil {
+		return nil, errors.New("Failed to get seller index")
+	}
+	defer keysIter.Close()
+
+	var txs []Transaction
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get seller index")
+		}
+		_, attrs, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(attrs) != 3 {
+			continue
+		}
+		tx_time, _ := strconv.ParseInt(attrs[1], 10, 64)
+		if tx_time < from || tx_time > to {
+			continue
+		}
+		recordKey, _ := stub.CreateCompositeKey(txRecordStr, []string{attrs[2]})
+		txAsBytes, err := stub.GetState(recordKey)
+		if err != nil {
+			return nil, errors.New("Failed to get tx " + attrs[2])
+		}
+		tx := Transaction{}
+		json.Unmarshal(txAsBytes, &tx)
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// sellerTxKey - seller ids are matched as numbers like findLatest always did, times are zero padded so they sort
+func sellerTxKey(stub shim.ChaincodeStubInterface, seller string, ms int64, id string) (string, error) {
+	if n, err := strconv.Atoi(seller); err == nil {
+		seller = strconv.Itoa(n)
+	}
+	return stub.CreateCompositeKey(sellerTxIndexStr, []string{seller, fmt.Sprintf("%020d", ms), id})
+}
+
+// ============================================================================================================================
+// Find Latest - the last exchanges a seller took part in
+// ============================================================================================================================
+func (t *SimpleChaincode) findLatest(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", "how many"
+	seller, _ := strconv.Atoi(args[0])										//both checked by the registry
+	fetch, _ := strconv.Atoi(args[1])
+
+	var processed AllTx
+	txs, err := sellerTxs(stub, seller, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	processed.TXs = txs
+	var fulLen = len(processed.TXs)
+	if fulLen == 0 {
+		return nil, NotFoundError("No records")
+	}
+	if fetch < fulLen {
+		processed.TXs = processed.TXs[fulLen-fetch:]
+	}
+	jsonAsBytes, _ := json.Marshal(processed)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Find Range - the exchanges of a seller between two timestamps (ms)
+// ============================================================================================================================
+func (t *SimpleChaincode) findRange(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0        1       2
+	// "seller", "from", "to"
+	seller, _ := strconv.Atoi(args[0])										//all checked by the registry
+	from, _ := strconv.ParseInt(args[1], 10, 64)
+	to, _ := strconv.ParseInt(args[2], 10, 64)
+
+	var processed AllTx
+	txs, err := sellerTxs(stub, seller, from, to)
+	if err != nil {
+		return nil, err
+	}
+	processed.TXs = txs
+	if len(processed.TXs) == 0 {
+		return nil, NotFoundError("No records")
+	}
+	jsonAsBytes, _ := json.Marshal(processed)
+	
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Find Exchanges - every exchange on the ledger, oldest first. Exchanges of older ledgers that only made it into the
+// _minimaltx list are read from there
+// ============================================================================================================================
+func (t *SimpleChaincode) findExchanges(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	keysIter, err := stub.GetStateByPartialCompositeKey(txRecordStr, []string{})
+	if err != nil {
+		return nil, errors.New("Failed to get TXs")
+	}
+	defer keysIter.Close()
+
+	var processed AllTx
+	recorded := make(map[string]bool)
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get TXs")
+		}
+		tx := Transaction{}
+		json.Unmarshal(kv.Value, &tx)
+		recorded[tx.Id] = true
+		processed.TXs = append(processed.TXs, tx)
+	}
+
+	tradesAsBytes, err := stub.GetState(minimalTxStr)
+	if err != nil {
+		return nil, errors.New("Failed to get TXs")
+	}
+	var legacy AllTx
+	json.Unmarshal(tradesAsBytes, &legacy)
+	for _, tx := range legacy.TXs {
+		if !recorded[tx.Id] {
+			processed.TXs = append(processed.TXs, tx)
+		}
+	}
+	if len(processed.TXs) == 0 {
+		return nil, NotFoundError("No records")
+	}
+	sort.SliceStable(processed.TXs, func(i, j int) bool {
+		a, _ := strconv.ParseInt(processed.TXs[i].Timestamp, 10, 64)
+		b, _ := strconv.ParseInt(processed.TXs[j].Timestamp, 10, 64)
+		return a < b
+	})
+	jsonAsBytes, _ := json.Marshal(processed)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Delete - remove a key/value pair from state
+// ============================================================================================================================
+func (t *SimpleChaincode) Delete(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	id := args[0]
+	pointAsBytes, err := stub.GetState(id)
+	if err != nil {
+		return nil, errors.New("Failed to get point")
+	}
+	if pointAsBytes != nil {
+		res := Point{}
+		json.Unmarshal(pointAsBytes, &res)
+		err = recordOwnerChange(stub, id, res.Owner, "")						//close the provenance chain, history outlives the point
+		if err != nil {
+			return nil, err
+		}
+		err = removeFromOwnerIndex(stub, res.Owner, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = stub.DelState(id)													//remove the key from chaincode state
+	if err != nil {
+		return nil, errors.New("Failed to delete state")
+	}
+
+	//get the marble index
+	pointAsBytes, err = stub.GetState(pointIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get marble index")
+	}
+	var pointIndex []string
+	json.Unmarshal(pointAsBytes, &pointIndex)								//un stringify it aka JSON.parse()
+	
+	//remove marble from index
+	for i,val := range pointIndex{
+		fmt.Println(strconv.Itoa(i) + " - looking at " + val + " for " + id)
+		if val == id{															//find the correct marble
+			fmt.Println("found point")
+			pointIndex = append(pointIndex[:i], pointIndex[i+1:]...)			//remove it
+			for x:= range pointIndex{											//debug prints...
+				fmt.Println(strconv.Itoa(x) + " - " + pointIndex[x])
+			}
+			break
+		}
+	}
+	jsonAsBytes, _ := json.Marshal(pointIndex)									//save new index
+	err = stub.PutState(pointIndexStr, jsonAsBytes)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Write - write variable into chaincode state
+// ============================================================================================================================
+func (t *SimpleChaincode) Write(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var name, value string // Entities
+	var err error
+	fmt.Println("running write()")
+
+	name = args[0]															//rename for funsies
+	value = args[1]
+	err = stub.PutState(name, []byte(value))								//write the variable into the chaincode state
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Init Point - create a new marble, store into chaincode state
+// ============================================================================================================================
+func (t *SimpleChaincode) init_point(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+
+	//   0        		1       
+	// "SellerXhash", "Owner"		an id ending with a dash is a prefix, the chaincode mints the rest
+	fmt.Println("- start init point")
+
+	id := args[0]
+	owner := strings.ToLower(args[1])
+	if strings.HasSuffix(id, "-") {
+		id, err = mintPointId(stub, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+
+	//check if marble already exists
+	pointAsBytes, err := stub.GetState(id)
+	if err != nil {
+		return nil, errors.New("Failed to get point id")
+	}
+
+	res := Point{}
+	json.Unmarshal(pointAsBytes, &res)
+	if res.Id == id{
+		fmt.Println("This point arleady exists: " + id)
+		fmt.Println(res);
+		return nil, ConflictError("This point arleady exists")				//all stop a marble by this name exists
+	}
+	
+	//build the marble json string manually
+	str := `{"id": "` + id + `", "owner": "` + owner + `"}`
+	err = stub.PutState(id, []byte(str))									//store marble with id as key
+	if err != nil {
+		return nil, err
+	}
+	err = recordOwnerChange(stub, id, "", owner)							//first entry of the provenance chain
+	if err != nil {
+		return nil, err
+	}
+	err = addToOwnerIndex(stub, owner, id)
+	if err != nil {
+		return nil, err
+	}
+		
+	//get the marble index
+	pointAsByte , err := stub.GetState(pointIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get marble index")
+	}
+	var pointIndex []string
+	json.Unmarshal(pointAsByte, &pointIndex)							//un stringify it aka JSON.parse()
+	
+	//append
+	pointIndex = append(pointIndex, id)									//add marble name to index list
+	fmt.Println("! marble index: ", pointIndex)
+	jsonAsBytes, _ := json.Marshal(pointIndex)
+	err = stub.PutState(pointIndexStr, jsonAsBytes)						//store name of marble
+
+	fmt.Println("- end init marble")
+	return []byte(str), nil												//answer the point, its id may be minted
+}
+func (t *SimpleChaincode) init_transaction(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error	
+	//	0        1          2          3            4            5          6          7          8         9              10
+	//["txID", "USER_A_ID", "USER_B_ID", "SELLER_A_ID", "SELLER_B_ID", "POINT_A", "POINT_B", "EX_TIME", *"NONCE"*, *"SIGNATURE_A"*, *"SIGNATURE_B"*]
+
+	/*
+	Id string `json:"txID"`					//user who created the open trade order
+	Timestamp string `json:"EX_TIME"`			//utc timestamp of creation
+	TraderA string  `json:"USER_A_ID"`				//description of desired marble
+	TraderB string  `json:"USER_B_ID"`
+	SellerA string  `json:"SELLER_A_ID"`				//description of desired marble
+	SellerB string  `json:"SELLER_B_ID"`
+	PointA string  `json:"POINT_A"`
+	PointB string  `json:"POINT_B"`
+	Related []Point `json:"related"`
+}
+	*/
+
+
+	err = checkExchangeSignatures(stub, args)								//sellers with a key must have signed it
+	if err != nil {
+		return nil, err
+	}
+	return recordExchange(stub, args[:8], nil)
+}
+
+// ============================================================================================================================
+// Record Exchange - store a checked exchange with the points handed over with it, if any, and index it
+// ============================================================================================================================
+func recordExchange(stub shim.ChaincodeStubInterface, args []string, related []Point) ([]byte, error) {
+	var err error
+	//	0        1          2          3            4            5          6          7
+	//["txID", "USER_A_ID", "USER_B_ID", "SELLER_A_ID", "SELLER_B_ID", "POINT_A", "POINT_B", "EX_TIME"]
+	err = checkPseudonyms(stub, [2]string{args[3], args[1]}, [2]string{args[4], args[2]})
+	if err != nil {
+		return nil, err
+	}
+
+	pointA, _ := strconv.Atoi(args[5])										//numbers are checked by the registry
+	pointB, _ := strconv.Atoi(args[6])
+	exTime, _ := strconv.ParseInt(args[7], 10, 64)
+
+	open := Transaction{}
+	open.Id = args[0]
+	open.TraderA = args[1]
+	open.TraderB = args[2]
+	open.SellerA = args[3]
+	open.SellerB = args[4]
+	open.PointA = args[5]
+	open.PointB = args[6]
+	open.Timestamp = args[7]
+	open.Related = related
+	
+	jsonAsBytes, _ := json.Marshal(open)
+
+	//one key per exchange, plus the seller index findLatest and findRange walk
+	recordKey, err := stub.CreateCompositeKey(txRecordStr, []string{open.Id})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	recAsBytes, err := stub.GetState(recordKey)
+	if err != nil {
+		return nil, errors.New("Failed to get tx " + open.Id)
+	}
+	if recAsBytes != nil {
+		return nil, ConflictError("This transaction already exists")
+	}
+	err = stub.PutState(recordKey, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = addReceiptLeaf(stub, open.Id, exTime, jsonAsBytes)			//the record as stored is the leaf of the receipts
+	if err != nil {
+		return nil, err
+	}
+	for _, seller := range []string{open.SellerA, open.SellerB} {
+		indexKey, err := sellerTxKey(stub, seller, exTime, open.Id)
+		if err != nil {
+			return nil, ParamError(err.Error())
+		}
+		err = stub.PutState(indexKey, []byte{0x00})					//same seller on both sides is indexed once
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//keep the per seller totals in step with the record
+	err = addAggregates(stub, []aggregateSide{
+		{open.SellerA, open.TraderA, []partnerShare{{partner: open.SellerB, out: pointA, in: pointB}}},
+		{open.SellerB, open.TraderB, []partnerShare{{partner: open.SellerA, out: pointB, in: pointA}}},
+	}, exTime)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set User Permission on Point
+// ============================================================================================================================
+func (t *SimpleChaincode) set_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	
+	//   0       1
+	// "name", "bob"
+	fmt.Println("- start set user")
+	fmt.Println(args[0] + " - " + args[1])
+	pointAsBytes, err := stub.GetState(args[0])
+	if err != nil {
+		return nil, errors.New("Failed to get thing")
+	}
+	if pointAsBytes == nil {
+		return nil, NotFoundError("Point " + args[0] + " does not exist")
+	}
+	res := Point{}
+	json.Unmarshal(pointAsBytes, &res)										//un stringify it aka JSON.parse()
+	if res.Points > 0 {
+		return nil, PermissionError("Point " + args[0] + " carries " + strconv.Itoa(res.Points) + " points, only its owner moves it with transfer_points")
+	}
+	prevOwner := res.Owner
+	res.Owner = strings.ToLower(args[1])										//change the user, lower case like init_point
+	
+	jsonAsBytes, _ := json.Marshal(res)
+	err = stub.PutState(args[0], jsonAsBytes)								//rewrite the marble with id as key
+	if err != nil {
+		return nil, err
+	}
+	err = recordOwnerChange(stub, args[0], prevOwner, res.Owner)
+	if err != nil {
+		return nil, err
+	}
+	err = removeFromOwnerIndex(stub, prevOwner, args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = addToOwnerIndex(stub, res.Owner, args[0])
+	if err != nil {
+		return nil, err
+	}
+	
+	fmt.Println("- end set user")
+	return nil, nil
+}
+
+func (t *SimpleChaincode) test(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	
+	//   0       1
+	// "name", "bob"
+	fmt.Println("- start test fcn")
+	fmt.Println(args[0] + " - " + args[1])
+
+	//get the open trade struct
+	tmpAsBytes, err := stub.GetState(tmpStr)
+	if err != nil {
+		return nil, errors.New("Failed to get TXs")
+	}
+	var tmps []string
+
+	json.Unmarshal(tmpAsBytes, &tmps)	
+	
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Open Trade - create an open trade for a marble you want with marbles you have 
+// ============================================================================================================================
+/*func (t *SimpleChaincode) open_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	var will_size int
+	var trade_away Description
+	
+	//	0        1      2     3      4      5       6
+	//["bob", "blue", "16", "red", "16"] *"blue", "35*
+	if len(args) < 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting like 5?")
+	}
+	if len(args)%2 == 0{
+		return nil, errors.New("Incorrect number of arguments. Expecting an odd number")
+	}
+
+	size1, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, errors.New("3rd argument must be a numeric string")
+	}
+
+	open := Transaction{}
+	open.User = args[0]
+	open.Timestamp = makeTimestamp()											//use timestamp as an ID
+	open.Want.Color = args[1]
+	open.Want.Size =  size1
+	fmt.Println("- start open trade")
+	jsonAsBytes, _ := json.Marshal(open)
+	err = stub.PutState("_debug1", jsonAsBytes)
+
+	for i:=3; i < len(args); i++ {												//create and append each willing trade
+		will_size, err = strconv.Atoi(args[i + 1])
+		if err != nil {
+			msg := "is not a numeric string " + args[i + 1]
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		
+		trade_away = Description{}
+		trade_away.Color = args[i]
+		trade_away.Size =  will_size
+		fmt.Println("! created trade_away: " + args[i])
+		jsonAsBytes, _ = json.Marshal(trade_away)
+		err = stub.PutState("_debug2", jsonAsBytes)
+		
+		open.Willing = append(open.Willing, trade_away)
+		fmt.Println("! appended willing to open")
+		i++;
+	}
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(transectionStr)
+	if err != nil {
+		return nil, errors.New("Failed to get TXs")
+	}
+	var trades AllTx
+	json.Unmarshal(tradesAsBytes, &trades)										//un stringify it aka JSON.parse()
+	
+	trades.TXs = append(trades.TXs, open);						//append to open trades
+	fmt.Println("! appended open to trades")
+	jsonAsBytes, _ = json.Marshal(trades)
+	err = stub.PutState(transectionStr, jsonAsBytes)								//rewrite open orders
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end open trade")
+	return nil, nil
+}*/
+
+// ============================================================================================================================
+// Perform Trade - close an open trade and move ownership
+// ============================================================================================================================
+/*
+func (t *SimpleChaincode) perform_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	
+	//	0		1					2					3				4					5
+	//[data.id, data.closer.user, data.closer.name, data.opener.user, data.opener.color, data.opener.size]
+	if len(args) < 6 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 6")
+	}
+	
+	fmt.Println("- start close trade")
+	timestamp, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("1st argument must be a numeric string")
+	}
+	
+	size, err := strconv.Atoi(args[5])
+	if err != nil {
+		return nil, errors.New("6th argument must be a numeric string")
+	}
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(transectionStr)
+	if err != nil {
+		return nil, errors.New("Failed to get TXs")
+	}
+	var trades AllTx
+	json.Unmarshal(tradesAsBytes, &trades)															//un stringify it aka JSON.parse()
+	
+	for i := range trades.TXs{																//look for the trade
+		fmt.Println("looking at " + strconv.FormatInt(trades.TXs[i].Timestamp, 10) + " for " + strconv.FormatInt(timestamp, 10))
+		if trades.TXs[i].Timestamp == timestamp{
+			fmt.Println("found the trade");
+			
+			
+			pointAsBytes, err := stub.GetState(args[2])
+			if err != nil {
+				return nil, errors.New("Failed to get thing")
+			}
+			closersMarble := Point{}
+			json.Unmarshal(pointAsBytes, &closersMarble)											//un stringify it aka JSON.parse()
+			
+			//verify if marble meets trade requirements
+			if closersMarble.Color != trades.TXs[i].Want.Color || closersMarble.Size != trades.TXs[i].Want.Size {
+				msg := "marble in input does not meet trade requriements"
+				fmt.Println(msg)
+				return nil, errors.New(msg)
+			}
+			
+			marble, e := findMarble4Trade(stub, trades.TXs[i].User, args[4], size)			//find a marble that is suitable from opener
+			if(e == nil){
+				fmt.Println("! no errors, proceeding")
+
+				t.set_user(stub, []string{args[2], trades.TXs[i].User})						//change owner of selected marble, closer -> opener
+				t.set_user(stub, []string{marble.Name, args[1]})									//change owner of selected marble, opener -> closer
+			
+				trades.TXs = append(trades.TXs[:i], trades.TXs[i+1:]...)		//remove trade
+				jsonAsBytes, _ := json.Marshal(trades)
+				err = stub.PutState(transectionStr, jsonAsBytes)										//rewrite open orders
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	fmt.Println("- end close trade")
+	return nil, nil
+}*/
+
+// ============================================================================================================================
+// Make Timestamp - create a timestamp in ms
+// ============================================================================================================================
+func makeTimestamp() int64 {
+    return time.Now().UnixNano() / (int64(time.Millisecond)/int64(time.Nanosecond))
+}
+
+// ============================================================================================================================
+// Remove Open Trade - close an open trade
+// ============================================================================================================================
+/*
+func (t *SimpleChaincode) remove_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	
+	//	0
+	//[data.id]
+	if len(args) < 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+	
+	fmt.Println("- start remove trade")
+	timestamp, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("1st argument must be a numeric string")
+	}
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(transectionStr)
+	if err != nil {
+		return nil, errors.New("Failed to get TXs")
+	}
+	var trades AllTx
+	json.Unmarshal(tradesAsBytes, &trades)																//un stringify it aka JSON.parse()
+	
+	for i := range trades.TXs{																	//look for the trade
+		//fmt.Println("looking at " + strconv.FormatInt(trades.TXs[i].Timestamp, 10) + " for " + strconv.FormatInt(timestamp, 10))
+		if trades.TXs[i].Timestamp == timestamp{
+			fmt.Println("found the trade");
+			trades.TXs = append(trades.TXs[:i], trades.TXs[i+1:]...)				//remove this trade
+			jsonAsBytes, _ := json.Marshal(trades)
+			err = stub.PutState(transectionStr, jsonAsBytes)												//rewrite open orders
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	
+	fmt.Println("- end remove trade")
+	return nil, nil
+}*/
+
+// ============================================================================================================================
+// Clean Up Open Trades - make sure open trades are still possible, remove choices that are no longer possible, remove trades that have no valid choices
+// ============================================================================================================================
+/*
+func cleanTrades(stub shim.ChaincodeStubInterface)(err error){
+	var didWork = false
+	fmt.Println("- start clean trades")
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(transectionStr)
+	if err != nil {
+		return errors.New("Failed to get TXs")
+	}
+	var trades AllTx
+	json.Unmarshal(tradesAsBytes, &trades)																		//un stringify it aka JSON.parse()
+	
+	fmt.Println("# trades " + strconv.Itoa(len(trades.TXs)))
+	for i:=0; i<len(trades.TXs); {																		//iter over all the known open trades
+		fmt.Println(strconv.Itoa(i) + ": looking at trade " + strconv.FormatInt(trades.TXs[i].Timestamp, 10))
+		
+		fmt.Println("# options " + strconv.Itoa(len(trades.TXs[i].Willing)))
+		for x:=0; x<len(trades.TXs[i].Willing); {														//find a marble that is suitable
+			fmt.Println("! on next option " + strconv.Itoa(i) + ":" + strconv.Itoa(x))
+			_, e := findMarble4Trade(stub, trades.TXs[i].User, trades.TXs[i].Willing[x].Color, trades.TXs[i].Willing[x].Size)
+			if(e != nil){
+				fmt.Println("! errors with this option, removing option")
+				didWork = true
+				trades.TXs[i].Willing = append(trades.TXs[i].Willing[:x], trades.TXs[i].Willing[x+1:]...)	//remove this option
+				x--;
+			}else{
+				fmt.Println("! this option is fine")
+			}
+			
+			x++
+			fmt.Println("! x:" + strconv.Itoa(x))
+			if x >= len(trades.TXs[i].Willing) {														//things might have shifted, recalcuate
+				break
+			}
+		}
+		
+		if len(trades.TXs[i].Willing) == 0 {
+			fmt.Println("! no more options for this trade, removing trade")
+			didWork = true
+			trades.TXs = append(trades.TXs[:i], trades.TXs[i+1:]...)					//remove this trade
+			i--;
+		}
+		
+		i++
+		fmt.Println("! i:" + strconv.Itoa(i))
+		if i >= len(trades.TXs) {																	//things might have shifted, recalcuate
+			break
+		}
+	}
+
+	if(didWork){
+		fmt.Println("! saving open trade changes")
+		jsonAsBytes, _ := json.Marshal(trades)
+		err = stub.PutState(transectionStr, jsonAsBytes)														//rewrite open orders
+		if err != nil {
+			return err
+		}
+	}else{
+		fmt.Println("! all open trades are fine")
+	}
+
+	fmt.Println("- end clean trades")
+	return nil
+}*/
\ No newline at end of file
@@ -0,0 +1,1168 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/merkle"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+)
+
+// newLedger deploys the chaincode on a fresh mock stub
+func newLedger(t *testing.T) *mockStub {
+	s := newMockStub()
+	if _, err := s.deploy("99"); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	return s
+}
+
+func mustInvoke(t *testing.T, s *mockStub, function string, args ...string) Response {
+	resp, err := s.invoke(function, args...)
+	if err != nil {
+		t.Fatalf("%s %v: %v", function, args, err)
+	}
+	return resp
+}
+
+func mustQuery(t *testing.T, s *mockStub, function string, args ...string) Response {
+	resp, err := s.query(function, args...)
+	if err != nil {
+		t.Fatalf("%s %v: %v", function, args, err)
+	}
+	return resp
+}
+
+func decodePayload(t *testing.T, resp Response, v interface{}) {
+	if resp.Payload == nil {
+		t.Fatalf("no payload in %+v", resp)
+	}
+	if err := json.Unmarshal(*resp.Payload, v); err != nil {
+		t.Fatalf("payload %s: %v", string(*resp.Payload), err)
+	}
+}
+
+// exchange records an exchange between bob (seller 1) and alice (seller 2)
+func exchange(t *testing.T, s *mockStub, id string, pointA string, pointB string, exTime string) {
+	mustInvoke(t, s, "init_transaction", id, "bob", "alice", "1", "2", pointA, pointB, exTime)
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"integer", []string{"99"}, CodeRecorded},
+		{"named", []string{`{"abc":"7"}`}, CodeRecorded},
+		{"not a number", []string{"abc"}, CodeInitError},
+		{"no args", nil, CodeInitError},
+		{"too many args", []string{"1", "2"}, CodeInitError},
+	}
+	for _, tt := range tests {
+		s := newMockStub()
+		resp, _ := s.deploy(tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+}
+
+func TestInitResetsState(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "init_point", "p1", "bob")
+	exchange(t, s, "t1", "10", "20", "1480838400000")
+
+	mustInvoke(t, s, "init", "1")
+
+	for _, q := range [][]string{
+		{"findLatest", "1", "10"},
+		{"findPointWithOwner", "bob"},
+		{"findPointHistory", "p1"},
+		{"findAggregate", "1", "day", "0", "1480838400000"},
+	} {
+		if resp := mustQuery(t, s, q[0], q[1:]...); resp.Code != CodeNoRecords {
+			t.Errorf("%v after init: code %d, want %d", q, resp.Code, CodeNoRecords)
+		}
+	}
+	if resp := mustQuery(t, s, "read", "abc"); string(*resp.Payload) != "1" {
+		t.Errorf("abc = %s, want 1", string(*resp.Payload))
+	}
+}
+
+func TestInitPoint(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		code  int
+		owner string
+	}{
+		{"new point", []string{"p1", "Bob"}, CodeRecorded, "bob"},
+		{"same id again", []string{"p1", "alice"}, CodeConflict, "bob"},
+		{"empty owner", []string{"p2", ""}, CodeParamError, ""},
+		{"missing owner", []string{"p3"}, CodeParamError, ""},
+		{"named args", []string{`{"id":"p4","owner":"carol"}`}, CodeRecorded, "carol"},
+	}
+	s := newLedger(t)
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_point", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+			continue
+		}
+		if tt.owner == "" {
+			continue
+		}
+		var p Point
+		id := tt.args[0]
+		if tt.name == "named args" {
+			id = "p4"
+		}
+		decodePayload(t, mustQuery(t, s, "read", id), &p)
+		if p.Owner != tt.owner {
+			t.Errorf("%s: owner %q, want %q", tt.name, p.Owner, tt.owner)
+		}
+	}
+}
+
+func TestMintPointId(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "init_point", "1-3", "carol") //an explicit id the sequence has to skip
+	tests := []struct {
+		prefix string
+		code   int
+		id     string
+	}{
+		{"1-", CodeRecorded, "1-1"},
+		{"1-2016114-", CodeRecorded, "1-2016114-2"},
+		{"1-", CodeRecorded, "1-4"},
+		{"01-", CodeRecorded, "01-5"}, //the same seller written with a leading zero
+		{"2-", CodeRecorded, "2-1"},
+		{"-", CodeParamError, ""},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_point", tt.prefix, "Bob")
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.prefix, resp.Code, tt.code, resp.Message)
+			continue
+		}
+		if tt.id == "" {
+			continue
+		}
+		var p Point
+		decodePayload(t, resp, &p)
+		if p.Id != tt.id || p.Owner != "bob" {
+			t.Errorf("%s: minted %+v, want %s", tt.prefix, p, tt.id)
+		}
+		decodePayload(t, mustQuery(t, s, "read", tt.id), &p)
+		if p.Owner != "bob" {
+			t.Errorf("%s: read %+v", tt.prefix, p)
+		}
+	}
+
+	mustInvoke(t, s, "init", "1")
+	var p Point
+	decodePayload(t, mustInvoke(t, s, "init_point", "1-", "bob"), &p)
+	if p.Id != "1-6" {
+		t.Errorf("after init: minted %s, want 1-6", p.Id)
+	}
+}
+
+func TestSetUser(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"move to alice", []string{"p1", "alice"}, CodeRecorded},
+		{"move to carol", []string{"p1", "Carol"}, CodeRecorded},
+		{"unknown point", []string{"nope", "bob"}, CodeNoRecords},
+		{"missing owner", []string{"p1"}, CodeParamError},
+	}
+	s := newLedger(t)
+	mustInvoke(t, s, "init_point", "p1", "bob")
+	for _, tt := range tests {
+		resp, _ := s.invoke("set_user", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+
+	var hist PointHistory
+	decodePayload(t, mustQuery(t, s, "findPointHistory", "p1"), &hist)
+	owners := []string{"bob", "alice", "carol"}
+	if len(hist.History) != len(owners) {
+		t.Fatalf("history has %d entries, want %d", len(hist.History), len(owners))
+	}
+	for i, h := range hist.History {
+		if h.NewOwner != owners[i] || (i > 0 && h.PrevOwner != owners[i-1]) || h.TxID == "" || h.Timestamp == "" {
+			t.Errorf("history[%d] = %+v", i, h)
+		}
+	}
+
+	for owner, want := range map[string]int{"bob": CodeNoRecords, "alice": CodeNoRecords, "carol": CodeEnquiryOK} {
+		if resp := mustQuery(t, s, "findPointWithOwner", owner); resp.Code != want {
+			t.Errorf("findPointWithOwner %s: code %d, want %d", owner, resp.Code, want)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "init_point", "p1", "bob")
+	mustInvoke(t, s, "init_point", "p2", "bob")
+
+	tests := []struct {
+		name  string
+		id    string
+		role  string
+		code  int
+		index []string
+	}{
+		{"not an admin", "p1", "member", CodeNoPermissionRecord, []string{"p1", "p2"}},
+		{"first point", "p1", roleAdmin, CodeRecorded, []string{"p2"}},
+		{"unknown point", "nope", roleAdmin, CodeRecorded, []string{"p2"}},
+		{"last point", "p2", roleAdmin, CodeRecorded, []string{}},
+	}
+	for _, tt := range tests {
+		s.attrs[roleAttr] = tt.role
+		resp, _ := s.invoke("delete", tt.id)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+		var index []string
+		json.Unmarshal(s.state[pointIndexStr], &index)
+		if len(index) != len(tt.index) {
+			t.Errorf("%s: point index %v, want %v", tt.name, index, tt.index)
+		}
+	}
+
+	if resp := mustQuery(t, s, "findPointWithOwner", "bob"); resp.Code != CodeNoRecords {
+		t.Errorf("bob still owns points after delete: %s", string(*resp.Payload))
+	}
+	var hist PointHistory
+	decodePayload(t, mustQuery(t, s, "findPointHistory", "p1"), &hist)
+	if last := hist.History[len(hist.History)-1]; last.NewOwner != "" || last.PrevOwner != "bob" {
+		t.Errorf("last history entry of a deleted point = %+v", last)
+	}
+}
+
+func TestInitTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"exchange", []string{"t1", "bob", "alice", "1", "2", "10", "20", "1480838400000"}, CodeRecorded},
+		{"named", []string{`{"txID":"t2","USER_A_ID":"bob","USER_B_ID":"carol","SELLER_A_ID":"1","SELLER_B_ID":"3","POINT_A":5,"POINT_B":6,"EX_TIME":"1480838500000"}`}, CodeRecorded},
+		{"points not numeric", []string{"t3", "bob", "alice", "1", "2", "ten", "20", "1480838400000"}, CodeParamError},
+		{"time not numeric", []string{"t4", "bob", "alice", "1", "2", "10", "20", "today"}, CodeParamError},
+		{"seven args", []string{"t5", "bob", "alice", "1", "2", "10", "20"}, CodeParamError},
+		{"unknown field", []string{`{"txID":"t6","USER":"bob"}`}, CodeParamError},
+		{"time before 1970", []string{"t7", "bob", "alice", "1", "2", "10", "20", "-1"}, CodeParamError},
+		{"txID already recorded", []string{"t1", "bob", "alice", "1", "2", "10", "20", "1480838400000"}, CodeConflict},
+	}
+	s := newLedger(t)
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_transaction", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+	if debug, ok := s.state["_debug1"]; ok {
+		t.Errorf("an exchange left a _debug1 copy: %s", debug)
+	}
+
+	var all AllTx
+	decodePayload(t, mustQuery(t, s, "findExchanges"), &all)
+	if len(all.TXs) != 2 || all.TXs[1].TraderB != "carol" || all.TXs[1].PointA != "5" {
+		t.Errorf("recorded %+v", all.TXs)
+	}
+
+	var aggs AllAggregate
+	decodePayload(t, mustQuery(t, s, "findAggregate", "1", "day", "1480838400000", "1480838400000"), &aggs)
+	if len(aggs.Aggs) != 1 {
+		t.Fatalf("aggregates %+v", aggs.Aggs)
+	}
+	if a := aggs.Aggs[0]; a.Exchanges != 2 || a.PointsOut != 15 || a.PointsIn != 26 || a.Members != 1 || a.Bucket != "2016-12-04" {
+		t.Errorf("seller 1 day total %+v", a)
+	}
+	decodePayload(t, mustQuery(t, s, "findAggregate", "2", "month", "1480838400000", "1480838400000", "1"), &aggs)
+	if a := aggs.Aggs[0]; a.Exchanges != 1 || a.PointsOut != 20 || a.PointsIn != 10 || a.Partner != "1" {
+		t.Errorf("seller 2 month total with partner 1 %+v", a)
+	}
+	if resp, _ := s.query("findAggregate", "1", "day", "-86400000", "1480838400000"); resp.Code != CodeParamError {
+		t.Errorf("a start before 1970 answered %d %s", resp.Code, resp.Message)
+	}
+}
+
+func TestLedgerError(t *testing.T) {
+	s := newLedger(t)
+	exchange(t, s, "t1", "10", "20", "1000")
+	key, _ := s.CreateCompositeKey(txRecordStr, []string{"t2"})
+	s.broken = map[string]bool{key: true, "abc": true}
+
+	if resp, _ := s.invoke("init_transaction", "t2", "bob", "alice", "1", "2", "10", "20", "2000"); resp.Code != CodeLedgerError {
+		t.Errorf("exchange on an unreadable ledger: %d %s", resp.Code, resp.Message)
+	}
+	if resp, _ := s.query("read", "abc"); resp.Code != CodeLedgerError {
+		t.Errorf("read of an unreadable key: %d %s", resp.Code, resp.Message)
+	}
+	if resp, _ := s.invoke("init_transaction", "t1", "bob", "alice", "1", "2", "10", "20", "2000"); resp.Code != CodeConflict {
+		t.Errorf("the other records still answer: %d %s", resp.Code, resp.Message)
+	}
+}
+
+func TestFindLatest(t *testing.T) {
+	s := newLedger(t)
+	exchange(t, s, "t1", "1", "1", "1000")
+	exchange(t, s, "t2", "2", "2", "2000")
+	mustInvoke(t, s, "init_transaction", "t3", "carol", "dave", "3", "4", "3", "3", "3000")
+	exchange(t, s, "t4", "4", "4", "4000")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		ids  []string
+	}{
+		{"last two of seller 1", []string{"1", "2"}, CodeEnquiryOK, []string{"t2", "t4"}},
+		{"more than there are", []string{"2", "10"}, CodeEnquiryOK, []string{"t1", "t2", "t4"}},
+		{"seller 4 is side B", []string{"4", "10"}, CodeEnquiryOK, []string{"t3"}},
+		{"unknown seller", []string{"9", "10"}, CodeNoRecords, nil},
+		{"legacy read form", []string{"read", "findLatest", "3", "1"}, CodeEnquiryOK, []string{"t3"}},
+		{"seller not numeric", []string{"x", "1"}, CodeParamError, nil},
+	}
+	for _, tt := range tests {
+		var resp Response
+		if tt.args[0] == "read" {
+			resp = mustQuery(t, s, "read", tt.args[1:]...)
+		} else {
+			resp = mustQuery(t, s, "findLatest", tt.args...)
+		}
+		checkTxIds(t, tt.name, resp, tt.code, tt.ids)
+	}
+}
+
+func TestFindRange(t *testing.T) {
+	s := newLedger(t)
+	exchange(t, s, "t1", "1", "1", "1000")
+	exchange(t, s, "t2", "2", "2", "2000")
+	exchange(t, s, "t3", "3", "3", "3000")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		ids  []string
+	}{
+		{"inclusive bounds", []string{"1", "1000", "2000"}, CodeEnquiryOK, []string{"t1", "t2"}},
+		{"everything", []string{"2", "0", "9999"}, CodeEnquiryOK, []string{"t1", "t2", "t3"}},
+		{"empty window", []string{"1", "1001", "1999"}, CodeNoRecords, nil},
+		{"named", []string{`{"SELLER_ID":1,"START_TIME":3000,"END_TIME":3000}`}, CodeEnquiryOK, []string{"t3"}},
+		{"missing end", []string{"1", "0"}, CodeParamError, nil},
+		{"negative start", []string{"1", "-1000", "2000"}, CodeParamError, nil},
+	}
+	for _, tt := range tests {
+		checkTxIds(t, tt.name, mustQuery(t, s, "findRange", tt.args...), tt.code, tt.ids)
+	}
+}
+
+func TestFindExchanges(t *testing.T) {
+	s := newLedger(t)
+	checkTxIds(t, "empty ledger", mustQuery(t, s, "findExchanges"), CodeNoRecords, nil)
+
+	exchange(t, s, "t2", "1", "2", "2000")
+	exchange(t, s, "t1", "2", "1", "1000")
+	legacy, _ := json.Marshal(AllTx{TXs: []Transaction{{Id: "old", Timestamp: "500"}, {Id: "t1", Timestamp: "1000"}}})
+	s.state[minimalTxStr] = legacy //an exchange of an older ledger that only made it into the list
+	checkTxIds(t, "records and legacy list", mustQuery(t, s, "findExchanges"), CodeEnquiryOK, []string{"old", "t1", "t2"})
+
+	exchange(t, s, "t3", "1", "2", "3000")
+	if string(s.state[minimalTxStr]) != string(legacy) {
+		t.Errorf("a new exchange was appended to the legacy list: %s", s.state[minimalTxStr])
+	}
+}
+
+func checkTxIds(t *testing.T, name string, resp Response, code int, ids []string) {
+	if resp.Code != code {
+		t.Errorf("%s: code %d, want %d (%s)", name, resp.Code, code, resp.Message)
+		return
+	}
+	if code != CodeEnquiryOK {
+		return
+	}
+	var all AllTx
+	decodePayload(t, resp, &all)
+	var got []string
+	for _, tx := range all.TXs {
+		got = append(got, tx.Id)
+	}
+	if len(got) != len(ids) {
+		t.Errorf("%s: got %v, want %v", name, got, ids)
+		return
+	}
+	for i := range ids {
+		if got[i] != ids[i] {
+			t.Errorf("%s: got %v, want %v", name, got, ids)
+			return
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	s := newLedger(t)
+	var all AllFunction
+	decodePayload(t, mustQuery(t, s, "describe"), &all)
+	if len(all.Functions) != len(functions) {
+		t.Fatalf("describe lists %d functions, want %d", len(all.Functions), len(functions))
+	}
+	for _, f := range all.Functions {
+		if f.Kind != kindInvoke && f.Kind != kindQuery {
+			t.Errorf("%s has kind %q", f.Name, f.Kind)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	s := newLedger(t)
+	exchange(t, s, "t1", "10", "20", "1000")
+	exchange(t, s, "t2", "30", "40", "2000")
+	exchange(t, s, "t3", "50", "60", "3000")
+	exchange(t, s, "t4", "70", "80", "9000") //outside the period
+
+	records := `[{"txID":"t1","USER_ID":"bob","POINTS":10,"EX_TIME":1000},
+		{"txID":"t2","USER_ID":"bob","POINTS":"31","EX_TIME":"2500"},
+		{"txID":"t4","USER_ID":"bob","POINTS":70,"EX_TIME":4000},
+		{"txID":"t9","USER_ID":"bob","POINTS":1,"EX_TIME":1500}]`
+	var res Reconciliation
+	decodePayload(t, mustInvoke(t, s, "reconcile", "1", "0", "5000", records), &res)
+	if res.Submitted != 4 || res.Matched != 1 {
+		t.Errorf("submitted %d matched %d, want 4 and 1", res.Submitted, res.Matched)
+	}
+	if len(res.MissingOnLedger) != 1 || res.MissingOnLedger[0] != "t9" {
+		t.Errorf("missing on ledger %v", res.MissingOnLedger)
+	}
+	if len(res.MissingAtSeller) != 1 || res.MissingAtSeller[0] != "t3" {
+		t.Errorf("missing at seller %v", res.MissingAtSeller)
+	}
+	want := []Mismatch{{"t2", "POINTS", "30", "31"}, {"t2", "EX_TIME", "2000", "2500"}, {"t4", "EX_TIME", "9000", "4000"}}
+	if len(res.Mismatches) != len(want) {
+		t.Fatalf("mismatches %+v", res.Mismatches)
+	}
+	for i := range want {
+		if res.Mismatches[i] != want[i] {
+			t.Errorf("mismatch %d is %+v, want %+v", i, res.Mismatches[i], want[i])
+		}
+	}
+
+	//seller 2 keeps the B side of the exchanges
+	decodePayload(t, mustInvoke(t, s, "reconcile", "2", "0", "2000",
+		`[{"txID":"t1","USER_ID":"alice","POINTS":20,"EX_TIME":1000},{"txID":"t2","USER_ID":"carol","POINTS":40,"EX_TIME":2000}]`), &res)
+	if res.Matched != 1 || len(res.Mismatches) != 1 || res.Mismatches[0].Field != "USER_ID" || res.Mismatches[0].Ledger != "alice" {
+		t.Errorf("seller 2: %+v", res)
+	}
+
+	var all AllReconciliation
+	decodePayload(t, mustQuery(t, s, "findReconciliations", "1"), &all)
+	if len(all.Reconciliations) != 1 || all.Reconciliations[0].RecordsHash == "" {
+		t.Errorf("recorded %+v", all.Reconciliations)
+	}
+	decodePayload(t, mustQuery(t, s, "findReconciliations", "2", res.Id), &all)
+	if len(all.Reconciliations) != 1 || all.Reconciliations[0].Matched != 1 {
+		t.Errorf("by id %+v", all.Reconciliations)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"nothing submitted", []string{"3", "0", "5000", `[]`}, CodeRecorded},
+		{"not a list", []string{"1", "0", "5000", `{"txID":"t1"}`}, CodeParamError},
+		{"listed twice", []string{"1", "0", "5000", `[{"txID":"t1","USER_ID":"bob","POINTS":10,"EX_TIME":1000},{"txID":"t1","USER_ID":"bob","POINTS":10,"EX_TIME":1000}]`}, CodeParamError},
+		{"points not numeric", []string{"1", "0", "5000", `[{"txID":"t1","USER_ID":"bob","POINTS":"ten","EX_TIME":1000}]`}, CodeParamError},
+		{"no txID", []string{"1", "0", "5000", `[{"USER_ID":"bob","POINTS":10,"EX_TIME":1000}]`}, CodeParamError},
+		{"period reversed", []string{"1", "5000", "0", `[]`}, CodeParamError},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("reconcile", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+	if resp := mustQuery(t, s, "findReconciliations", "9"); resp.Code != CodeNoRecords {
+		t.Errorf("unknown seller: code %d", resp.Code)
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	s := newLedger(t)
+	day := int64(1480809600000) //2016-12-04 UTC
+	for i, id := range []string{"t1", "t2", "t3", "t4", "t5"} {
+		exchange(t, s, id, "10", "20", strconv.FormatInt(day+int64(i)*3600000, 10))
+	}
+	exchange(t, s, "t6", "10", "20", strconv.FormatInt(day+86400000, 10)) //next day
+
+	var root PeriodRoot
+	decodePayload(t, mustQuery(t, s, "findMerkleRoot", "2016-12-04"), &root)
+	if root.Size != 5 {
+		t.Errorf("root %+v", root)
+	}
+	for i, id := range []string{"t1", "t3", "t5"} {
+		var r merkle.Receipt
+		decodePayload(t, mustQuery(t, s, "findReceipt", id), &r)
+		if err := r.Verify(); err != nil {
+			t.Errorf("receipt of %s: %v", id, err)
+		}
+		if r.Root != root.Root || r.Index != uint64(2*i) || r.Period != "2016-12-04" {
+			t.Errorf("receipt of %s: %+v, root %+v", id, r, root)
+		}
+		var tx Transaction
+		if json.Unmarshal(r.Record, &tx) != nil || tx.Id != id {
+			t.Errorf("receipt of %s holds %s", id, r.Record)
+		}
+	}
+	var r merkle.Receipt
+	decodePayload(t, mustQuery(t, s, "findReceipt", "t6"), &r)
+	if r.Period != "2016-12-05" || r.Size != 1 || r.Verify() != nil {
+		t.Errorf("receipt of t6 %+v", r)
+	}
+
+	if resp := mustQuery(t, s, "findReceipt", "t9"); resp.Code != CodeNoRecords {
+		t.Errorf("receipt of an unknown exchange: code %d", resp.Code)
+	}
+	if resp := mustQuery(t, s, "findMerkleRoot", "2016-12-06"); resp.Code != CodeNoRecords {
+		t.Errorf("root of an empty day: code %d", resp.Code)
+	}
+	mustInvoke(t, s, "init", "1")
+	if resp := mustQuery(t, s, "findMerkleRoot", "2016-12-04"); resp.Code != CodeNoRecords {
+		t.Errorf("root after init: code %d", resp.Code)
+	}
+}
+
+// registerSellerKey generates a seller key and registers it
+func registerSellerKey(t *testing.T, s *mockStub, seller string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	mustInvoke(t, s, "register_seller_key", seller, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	return key
+}
+
+func signPayload(key *ecdsa.PrivateKey, payload []byte) string {
+	h := sha256.Sum256(payload)
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, h[:])
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// sellerSigner generates a seller key, registers it and signs exchange arguments with it
+func sellerSigner(t *testing.T, s *mockStub, seller string) func(args ...string) string {
+	key := registerSellerKey(t, s, seller)
+	return func(args ...string) string {
+		return signPayload(key, ExchangePayload(args))
+	}
+}
+
+func TestSignedExchange(t *testing.T) {
+	s := newLedger(t)
+	signA := sellerSigner(t, s, "1")
+	signB := sellerSigner(t, s, "2")
+	psnKey := []byte("0123456789abcdef")
+	bob, alice, dave := pseudonym.Of(psnKey, "1", "bob"), pseudonym.Of(psnKey, "2", "alice"), pseudonym.Of(psnKey, "1", "dave")
+	ex := func(id string, nonce string) []string {
+		return []string{id, bob, alice, "1", "2", "10", "20", "1480838400000", nonce}
+	}
+	signed := func(id string, nonce string) []string {
+		args := ex(id, nonce)
+		return append(args, signA(args...), signB(args...))
+	}
+	forged := signed("t4", "n4")
+	forged[5] = "1000" //points changed after signing
+	replayed := signed("t5", "n1")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"both signed", signed("t1", "n1"), CodeRecorded},
+		{"unsigned", ex("t2", "n2")[:8], CodeNoPermissionRecord},
+		{"only seller 1 signed", append(ex("t3", "n3"), signA(ex("t3", "n3")...)), CodeNoPermissionRecord},
+		{"signed by the wrong seller", append(ex("t3", "n3"), signB(ex("t3", "n3")...), signB(ex("t3", "n3")...)), CodeNoPermissionRecord},
+		{"altered after signing", forged, CodeNoPermissionRecord},
+		{"nonce used before", replayed, CodeConflict},
+		{"not base64", append(ex("t6", "n6"), "%%%", "%%%"), CodeNoPermissionRecord},
+		{"seller 3 has no key", []string{"t7", bob, "carol", "1", "3", "10", "20", "1480838400000", "n7", signA("t7", bob, "carol", "1", "3", "10", "20", "1480838400000", "n7")}, CodeRecorded},
+		{"same seller signs once", func() []string {
+			args := []string{"t8", bob, dave, "1", "1", "10", "20", "1480838400000", "n8"}
+			return append(args, signA(args...))
+		}(), CodeRecorded},
+		{"clear member of a seller with a key", func() []string {
+			args := []string{"t9", "bob", "carol", "1", "3", "10", "20", "1480838400000", "n9"}
+			return append(args, signA(args...))
+		}(), CodeParamError},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_transaction", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+
+	//a reset keeps the keys and the nonces
+	mustInvoke(t, s, "init", "1")
+	if resp, _ := s.invoke("init_transaction", signed("t1", "n1")...); resp.Code != CodeConflict {
+		t.Errorf("replay after init: code %d (%s)", resp.Code, resp.Message)
+	}
+	var sk SellerKey
+	decodePayload(t, mustQuery(t, s, "findSellerKey", "01"), &sk)
+	if sk.Seller != "1" || sk.TxID == "" {
+		t.Errorf("seller key %+v", sk)
+	}
+	if resp := mustQuery(t, s, "findSellerKey", "9"); resp.Code != CodeNoRecords {
+		t.Errorf("key of a seller without one: code %d", resp.Code)
+	}
+
+	s.attrs = map[string]string{}
+	if resp, _ := s.invoke("register_seller_key", "2", sk.PublicKey); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("register_seller_key without the admin role: code %d", resp.Code)
+	}
+	s.attrs = map[string]string{roleAttr: roleAdmin}
+	if resp, _ := s.invoke("register_seller_key", "2", "not a key"); resp.Code != CodeParamError {
+		t.Errorf("register_seller_key with garbage: code %d", resp.Code)
+	}
+}
+
+func TestPseudonymousSeller(t *testing.T) {
+	s := newLedger(t)
+	key := []byte("0123456789abcdef")
+	bob := pseudonym.Of(key, "1", "bob")
+	mustInvoke(t, s, "set_seller_policy", "1", `{"pseudonymous":true}`)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"member of seller 1 in clear", []string{"t1", "bob", "alice", "1", "2", "10", "20", "1000"}, CodeParamError},
+		{"pseudonym", []string{"t2", bob, "alice", "1", "2", "10", "20", "2000"}, CodeRecorded},
+		{"seller 1 on side B", []string{"t3", "carol", "bob", "2", "1", "10", "20", "3000"}, CodeParamError},
+		{"seller 1 on side B with a pseudonym", []string{"t4", "carol", bob, "2", "1", "10", "20", "4000"}, CodeRecorded},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_transaction", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+
+	checkTxIds(t, "exchanges of bob", mustQuery(t, s, "findUserEx", "1", bob), CodeEnquiryOK, []string{"t2", "t4"})
+	checkTxIds(t, "bob in clear", mustQuery(t, s, "findUserEx", "1", "bob"), CodeNoRecords, nil)
+	checkTxIds(t, "alice of seller 2", mustQuery(t, s, "findUserEx", "2", "alice"), CodeEnquiryOK, []string{"t2"})
+
+	var policy SellerPolicy
+	decodePayload(t, mustInvoke(t, s, "set_seller_policy", "01", `{}`), &policy)
+	if !policy.Pseudonymous || policy.Seller != "1" {
+		t.Errorf("an empty change lost the policy: %+v", policy)
+	}
+	mustInvoke(t, s, "init", "1")
+	decodePayload(t, mustQuery(t, s, "findSellerPolicy", "1"), &policy)
+	if !policy.Pseudonymous {
+		t.Errorf("init reset the policy: %+v", policy)
+	}
+	for _, bad := range []string{`{"pseudonymous":"yes"}`, `{"SELLER_ID":"2"}`, `[]`} {
+		if resp, _ := s.invoke("set_seller_policy", "1", bad); resp.Code != CodeParamError {
+			t.Errorf("policy %s: code %d", bad, resp.Code)
+		}
+	}
+}
+
+func TestEraseMember(t *testing.T) {
+	s := newLedger(t)
+	day := int64(1480809600000) //2016-12-04 UTC
+	exchange(t, s, "t1", "10", "20", strconv.FormatInt(day, 10))
+	exchange(t, s, "t2", "30", "40", strconv.FormatInt(day+1000, 10))
+	mustInvoke(t, s, "init_transaction", "t3", "carol", "bob", "1", "2", "5", "6", strconv.FormatInt(day+2000, 10))
+	mustInvoke(t, s, "init_point", "1-a", "bob")
+	mustInvoke(t, s, "init_point", "1-b", "bob")
+	mustInvoke(t, s, "set_user", "1-b", "carol")
+	mustInvoke(t, s, "init_point", "2-a", "bob")
+	mustInvoke(t, s, "reconcile", "1", strconv.FormatInt(day, 10), strconv.FormatInt(day+5000, 10),
+		`[{"txID":"t1","USER_ID":"bobby","POINTS":10,"EX_TIME":1480809600000}]`)
+	var before merkle.Receipt
+	decodePayload(t, mustQuery(t, s, "findReceipt", "t1"), &before)
+	var agg AllAggregate
+	decodePayload(t, mustQuery(t, s, "findAggregate", "1", "day", "0", strconv.FormatInt(day+86400000, 10)), &agg)
+
+	resp := mustInvoke(t, s, "erase_member", "01", "bob")
+	if resp.Code != CodeRecorded {
+		t.Fatalf("erase_member: %+v", resp)
+	}
+	var erasure Erasure
+	decodePayload(t, resp, &erasure)
+	token := "erased:" + strings.ToLower(erasure.Id)
+	if erasure.Seller != "1" || erasure.Replacement != token ||
+		strings.Join(erasure.Exchanges, ",") != "t1,t2" || strings.Join(erasure.Points, ",") != "1-a,1-b" {
+		t.Errorf("erasure %+v", erasure)
+	}
+
+	var all AllTx
+	decodePayload(t, mustQuery(t, s, "findLatest", "1", "10"), &all)
+	for _, tx := range all.TXs {
+		if tx.TraderA == "bob" {
+			t.Errorf("%s still holds bob", tx.Id)
+		}
+		if tx.Id == "t1" && (tx.TraderA != token || tx.TraderB != "alice" || tx.PointA != "10" || tx.SellerA != "1" || tx.Erased != erasure.Id) {
+			t.Errorf("erased record %+v", tx)
+		}
+		if tx.Id == "t3" && (tx.TraderA != "carol" || tx.TraderB != "bob") {
+			t.Errorf("bob of seller 2 was erased: %+v", tx)
+		}
+	}
+	checkTxIds(t, "bob of seller 1", mustQuery(t, s, "findUserEx", "1", "bob"), CodeNoRecords, nil)
+	checkTxIds(t, "the token", mustQuery(t, s, "findUserEx", "1", token), CodeEnquiryOK, []string{"t1", "t2"})
+	raw := mustQuery(t, s, "findExchanges")
+	if strings.Contains(string(*raw.Payload), `"USER_A_ID":"bob"`) {
+		t.Errorf("the exchanges still hold bob: %s", *raw.Payload)
+	}
+
+	var after merkle.Receipt
+	decodePayload(t, mustQuery(t, s, "findReceipt", "t1"), &after)
+	if after.Erased != erasure.Id || after.Leaf != before.Leaf || after.Root != before.Root || after.Verify() != nil {
+		t.Errorf("receipt after erasure %+v, before %+v", after, before)
+	}
+	if before.Verify() != nil {
+		t.Error("the receipt kept from before the erasure no longer verifies")
+	}
+	var aggAfter AllAggregate
+	decodePayload(t, mustQuery(t, s, "findAggregate", "1", "day", "0", strconv.FormatInt(day+86400000, 10)), &aggAfter)
+	if !reflect.DeepEqual(agg, aggAfter) {
+		t.Errorf("aggregates changed: %+v, were %+v", aggAfter, agg)
+	}
+
+	var points AllPoint
+	decodePayload(t, mustQuery(t, s, "findPointWithOwner", "bob"), &points)
+	if len(points.Points) != 1 || points.Points[0].Id != "2-a" {
+		t.Errorf("points of bob %+v", points)
+	}
+	decodePayload(t, mustQuery(t, s, "findPointWithOwner", token), &points)
+	if len(points.Points) != 1 || points.Points[0].Id != "1-a" {
+		t.Errorf("points of the token %+v", points)
+	}
+	var hist PointHistory
+	decodePayload(t, mustQuery(t, s, "findPointHistory", "1-b"), &hist)
+	if hist.History[0].NewOwner != token || hist.History[1].PrevOwner != token || hist.History[1].NewOwner != "carol" {
+		t.Errorf("history of 1-b %+v", hist)
+	}
+	var recs AllReconciliation
+	decodePayload(t, mustQuery(t, s, "findReconciliations", "1"), &recs)
+	if m := recs.Reconciliations[0].Mismatches; len(m) != 1 || m[0].Ledger != token || m[0].Seller != "bobby" {
+		t.Errorf("reconciliation mismatches %+v", m)
+	}
+
+	mustInvoke(t, s, "init", "1")
+	var erasures AllErasure
+	decodePayload(t, mustQuery(t, s, "findErasures", "1", erasure.Id), &erasures)
+	if len(erasures.Erasures) != 1 || erasures.Erasures[0].Replacement != token {
+		t.Errorf("erasures after init %+v", erasures)
+	}
+	if resp, _ := s.invoke("erase_member", "1", "dave"); resp.Code != CodeNoRecords {
+		t.Errorf("erasing an unknown member: code %d", resp.Code)
+	}
+	if resp, _ := s.invoke("erase_member", "1", token); resp.Code != CodeParamError {
+		t.Errorf("erasing a token: code %d", resp.Code)
+	}
+	s.attrs = map[string]string{}
+	if resp, _ := s.invoke("erase_member", "2", "bob"); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("erasing as a seller: code %d", resp.Code)
+	}
+}
+
+func TestAggregateSameSeller(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "init_transaction", "t1", "bob", "alice", "007", "7", "10", "20", "1480838400000")
+	mustInvoke(t, s, "init_transaction", "t2", "bob", "carol", "7", "2", "5", "6", "1480838400000")
+
+	//t1 is one exchange between two members of seller 7 however it is spelled, both sides count for it
+	for _, tt := range []struct {
+		seller, partner      string
+		out, in, txs, member int
+	}{{"7", "07", 30, 30, 1, 2}, {"007", "", 35, 36, 2, 2}, {"7", "2", 5, 6, 1, 1}} {
+		var aggs AllAggregate
+		decodePayload(t, mustQuery(t, s, "findAggregate", tt.seller, "day", "0", "1480838400000", tt.partner), &aggs)
+		if len(aggs.Aggs) != 1 {
+			t.Fatalf("aggregates of %s with %q: %+v", tt.seller, tt.partner, aggs)
+		}
+		if a := aggs.Aggs[0]; a.PointsOut != tt.out || a.PointsIn != tt.in || a.Exchanges != tt.txs || a.Members != tt.member {
+			t.Errorf("aggregates of %s with %q: %+v", tt.seller, tt.partner, a)
+		}
+	}
+}
+
+func TestRingExchange(t *testing.T) {
+	s := newLedger(t)
+	day := int64(1480809600000) //2016-12-04 UTC
+	legs := `[{"USER_ID":"bob","SELLER_ID":"1","POINT_IN":30,"POINT_OUT":10},` +
+		`{"USER_ID":"alice","SELLER_ID":"2","POINT_IN":"10","POINT_OUT":"20"},` +
+		`{"USER_ID":"carol","SELLER_ID":"3","POINT_IN":20,"POINT_OUT":30}]`
+	mustInvoke(t, s, "init_ring_exchange", "r1", strconv.FormatInt(day, 10), legs)
+	exchange(t, s, "t1", "5", "6", strconv.FormatInt(day+1000, 10))
+
+	checkTxIds(t, "seller 1", mustQuery(t, s, "findLatest", "1", "10"), CodeEnquiryOK, []string{"r1", "t1"})
+	checkTxIds(t, "seller 2", mustQuery(t, s, "findRange", "2", "0", strconv.FormatInt(day, 10)), CodeEnquiryOK, []string{"r1"})
+	checkTxIds(t, "seller 3", mustQuery(t, s, "findLatest", "3", "10"), CodeEnquiryOK, []string{"r1"})
+	checkTxIds(t, "carol", mustQuery(t, s, "findUserEx", "3", "carol"), CodeEnquiryOK, []string{"r1"})
+
+	var all AllTx
+	decodePayload(t, mustQuery(t, s, "findRange", "2", "0", strconv.FormatInt(day, 10)), &all)
+	want := []Leg{{"bob", "1", "30", "10"}, {"alice", "2", "10", "20"}, {"carol", "3", "20", "30"}}
+	if len(all.TXs) != 1 || !reflect.DeepEqual(all.TXs[0].Legs, want) || all.TXs[0].SellerA != "" {
+		t.Errorf("ring as seller 2 sees it: %+v", all.TXs)
+	}
+	//in the ring seller 2 gives 20 to seller 3 and receives 10 from seller 1, t1 adds 6 out and 5 in with seller 1
+	for _, tt := range []struct {
+		partner      string
+		out, in, txs int
+	}{{"3", 20, 0, 1}, {"1", 6, 15, 2}, {allPartners, 26, 15, 2}} {
+		var aggs AllAggregate
+		decodePayload(t, mustQuery(t, s, "findAggregate", "2", "day", "0", strconv.FormatInt(day, 10), tt.partner), &aggs)
+		if len(aggs.Aggs) != 1 || aggs.Aggs[0].PointsOut != tt.out || aggs.Aggs[0].PointsIn != tt.in || aggs.Aggs[0].Exchanges != tt.txs {
+			t.Errorf("aggregates of seller 2 with %s: %+v", tt.partner, aggs)
+		}
+	}
+	var r merkle.Receipt
+	decodePayload(t, mustQuery(t, s, "findReceipt", "r1"), &r)
+	if r.Verify() != nil {
+		t.Errorf("receipt of the ring %+v", r)
+	}
+
+	tests := []struct {
+		name string
+		legs string
+		code int
+	}{
+		{"one leg", `[{"USER_ID":"bob","SELLER_ID":"1","POINT_IN":0,"POINT_OUT":0}]`, CodeParamError},
+		{"not a list", `{"USER_ID":"bob"}`, CodeParamError},
+		{"leg without a seller", `[{"USER_ID":"bob","POINT_IN":1,"POINT_OUT":1},{"USER_ID":"alice","SELLER_ID":"2","POINT_IN":1,"POINT_OUT":1}]`, CodeParamError},
+		{"receives more than given", `[{"USER_ID":"bob","SELLER_ID":"1","POINT_IN":5,"POINT_OUT":1},{"USER_ID":"alice","SELLER_ID":"2","POINT_IN":1,"POINT_OUT":1}]`, CodeParamError},
+		{"negative points", `[{"USER_ID":"bob","SELLER_ID":"1","POINT_IN":-1,"POINT_OUT":1},{"USER_ID":"alice","SELLER_ID":"2","POINT_IN":1,"POINT_OUT":-1}]`, CodeParamError},
+		{"member on two legs", `[{"USER_ID":"bob","SELLER_ID":"1","POINT_IN":1,"POINT_OUT":1},{"USER_ID":"bob","SELLER_ID":"01","POINT_IN":1,"POINT_OUT":1}]`, CodeParamError},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_ring_exchange", "r2", strconv.FormatInt(day, 10), tt.legs)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+	if resp, _ := s.invoke("init_ring_exchange", "r1", strconv.FormatInt(day, 10), legs); resp.Code != CodeConflict {
+		t.Errorf("same txID twice: code %d", resp.Code)
+	}
+	checkTxIds(t, "seller 1 after the failures", mustQuery(t, s, "findLatest", "1", "10"), CodeEnquiryOK, []string{"r1", "t1"})
+
+	//a seller with a key signs its legs and records its members as pseudonyms
+	key := registerSellerKey(t, s, "2")
+	at := strconv.FormatInt(day+2000, 10)
+	if resp, _ := s.invoke("init_ring_exchange", "r3", at, legs, "n1", `{"2":"`+signPayload(key, RingPayload([]string{"r3", at, legs, "n1"}))+`"}`); resp.Code != CodeParamError {
+		t.Errorf("ring with a clear member of seller 2: code %d (%s)", resp.Code, resp.Message)
+	}
+	legs = strings.Replace(legs, `"alice"`, `"`+pseudonym.Of([]byte("0123456789abcdef"), "2", "alice")+`"`, 1)
+	if resp, _ := s.invoke("init_ring_exchange", "r3", at, legs, "n1"); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("unsigned ring: code %d (%s)", resp.Code, resp.Message)
+	}
+	sig := signPayload(key, RingPayload([]string{"r3", at, legs, "n1"}))
+	if resp, _ := s.invoke("init_ring_exchange", "r3", at, legs, "n1", `{"02":"`+sig+`"}`); resp.Code != CodeRecorded {
+		t.Errorf("signed ring: code %d (%s)", resp.Code, resp.Message)
+	}
+	if resp, _ := s.invoke("init_ring_exchange", "r4", at, legs, "n1", `{"2":"`+sig+`"}`); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("signature of another ring: code %d (%s)", resp.Code, resp.Message)
+	}
+
+	erasure := Erasure{}
+	decodePayload(t, mustInvoke(t, s, "erase_member", "3", "carol"), &erasure)
+	if strings.Join(erasure.Exchanges, ",") != "r1,r3" {
+		t.Errorf("erasure of carol %+v", erasure)
+	}
+	checkTxIds(t, "carol after the erasure", mustQuery(t, s, "findUserEx", "3", "carol"), CodeNoRecords, nil)
+}
+
+func TestBundleExchange(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "init_point", "1-a", "bob")
+	mustInvoke(t, s, "init_point", "1-b", "bob")
+	mustInvoke(t, s, "init_point", "2-a", "alice")
+	mustInvoke(t, s, "init_point", "2-b", "carol")
+	bundle := func(id string, related string) []string {
+		return []string{id, "Bob", "alice", "1", "2", "10", "20", "1480838400000", related}
+	}
+
+	tests := []struct {
+		name    string
+		related string
+		code    int
+	}{
+		{"not held by a member of the exchange", `[{"id":"2-b","owner":"carol"}]`, CodeParamError},
+		{"held by someone else", `[{"id":"2-b","owner":"alice"}]`, CodeNoPermissionRecord},
+		{"unknown point", `[{"id":"9-z","owner":"bob"}]`, CodeNoRecords},
+		{"listed twice", `[{"id":"1-a","owner":"bob"},{"id":"1-a","owner":"bob"}]`, CodeParamError},
+		{"empty", `[]`, CodeParamError},
+		{"one good, one bad", `[{"id":"1-a","owner":"bob"},{"id":"2-b","owner":"alice"}]`, CodeNoPermissionRecord},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("init_bundle_exchange", bundle("b0", tt.related)...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+	var p Point
+	decodePayload(t, mustQuery(t, s, "read", "1-a"), &p)
+	if p.Owner != "bob" {
+		t.Fatalf("a failed bundle moved 1-a to %s", p.Owner)
+	}
+	checkTxIds(t, "after the failures", mustQuery(t, s, "findLatest", "1", "10"), CodeNoRecords, nil)
+
+	mustInvoke(t, s, "init_bundle_exchange", bundle("b1", `[{"id":"1-a","owner":"Bob"},{"id":"1-b","owner":"bob"},{"id":"2-a","owner":"alice"}]`)...)
+	var all AllTx
+	decodePayload(t, mustQuery(t, s, "findLatest", "2", "1"), &all)
+	want := []Point{{Id: "1-a", Owner: "bob"}, {Id: "1-b", Owner: "bob"}, {Id: "2-a", Owner: "alice"}}
+	if len(all.TXs) != 1 || !reflect.DeepEqual(all.TXs[0].Related, want) || all.TXs[0].PointA != "10" {
+		t.Errorf("bundle as seller 2 sees it: %+v", all.TXs)
+	}
+	var points AllPoint
+	decodePayload(t, mustQuery(t, s, "findPointWithOwner", "alice"), &points)
+	if len(points.Points) != 2 || points.Points[0].Id != "1-a" || points.Points[1].Id != "1-b" {
+		t.Errorf("points of alice %+v", points)
+	}
+	decodePayload(t, mustQuery(t, s, "findPointWithOwner", "bob"), &points)
+	if len(points.Points) != 1 || points.Points[0].Id != "2-a" {
+		t.Errorf("points of bob %+v", points)
+	}
+	var hist PointHistory
+	decodePayload(t, mustQuery(t, s, "findPointHistory", "2-a"), &hist)
+	if len(hist.History) != 2 || hist.History[1] != (OwnerChange{PrevOwner: "alice", NewOwner: "bob", TxID: hist.History[1].TxID, Timestamp: hist.History[1].Timestamp}) {
+		t.Errorf("history of 2-a %+v", hist)
+	}
+	if resp, _ := s.invoke("init_bundle_exchange", bundle("b2", `[{"id":"1-a","owner":"bob"}]`)...); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("bob gives 1-a again: code %d", resp.Code)
+	}
+
+	//erasing alice of seller 2 also clears her from the points of seller 1 she got in the bundle
+	var erasure Erasure
+	decodePayload(t, mustInvoke(t, s, "erase_member", "2", "alice"), &erasure)
+	if strings.Join(erasure.Points, ",") != "1-a,1-b,2-a" {
+		t.Errorf("erasure of alice %+v", erasure)
+	}
+	decodePayload(t, mustQuery(t, s, "findLatest", "1", "1"), &all)
+	if all.TXs[0].Related[2].Owner != erasure.Replacement || all.TXs[0].Related[0].Owner != "bob" {
+		t.Errorf("bundle after the erasure %+v", all.TXs[0].Related)
+	}
+}
+
+func publicKeyPEM(key *ecdsa.PrivateKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestTransferPoints(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "credit_member", "1", "bob", "100")
+	transfer := func(key *ecdsa.PrivateKey, args ...string) Response {
+		resp, _ := s.invoke("transfer_points", append(args, signPayload(key, TransferPayload(args)))...)
+		return resp
+	}
+	bobKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	aliceKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if resp := transfer(bobKey, "1", "bob", "alice", "10", "n1"); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("transfer of a seller without transfers: code %d (%s)", resp.Code, resp.Message)
+	}
+	mustInvoke(t, s, "set_seller_policy", "1", `{"transfers":true,"max_transfer":50}`)
+	if resp := transfer(bobKey, "1", "bob", "alice", "10", "n1"); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("transfer of a member without a key: code %d (%s)", resp.Code, resp.Message)
+	}
+	mustInvoke(t, s, "register_member_key", "1", "bob", publicKeyPEM(bobKey))
+	mustInvoke(t, s, "register_member_key", "01", "alice", publicKeyPEM(aliceKey))
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	tests := []struct {
+		name string
+		key  *ecdsa.PrivateKey
+		args []string
+		code int
+	}{
+		{"signed by another key", other, []string{"1", "bob", "alice", "10", "n1"}, CodeNoPermissionRecord},
+		{"signed by the receiver", aliceKey, []string{"1", "bob", "alice", "10", "n1"}, CodeNoPermissionRecord},
+		{"to itself", bobKey, []string{"1", "bob", "bob", "10", "n1"}, CodeParamError},
+		{"no points", bobKey, []string{"1", "bob", "alice", "0", "n1"}, CodeParamError},
+		{"over the policy", bobKey, []string{"1", "bob", "alice", "60", "n1"}, CodeNoPermissionRecord},
+		{"gift", bobKey, []string{"1", "bob", "alice", "30", "n1"}, CodeRecorded},
+		{"nonce again", bobKey, []string{"1", "bob", "alice", "30", "n1"}, CodeConflict},
+		{"more than held", aliceKey, []string{"01", "alice", "carol", "31", "n1"}, CodeConflict},
+		{"nonce of another member", aliceKey, []string{"01", "alice", "carol", "30", "n1"}, CodeRecorded},
+	}
+	for _, tt := range tests {
+		if resp := transfer(tt.key, tt.args...); resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+	if resp, _ := s.invoke("transfer_points", "1", "bob", "alice", "10", "n4"); resp.Code != CodeParamError {
+		t.Errorf("unsigned transfer: code %d (%s)", resp.Code, resp.Message)
+	}
+
+	//the gift split 30 off bob's lot 1-1 into 1-2, which alice then handed on whole
+	for member, want := range map[string]Balance{"bob": {"1", "bob", 70, []string{"1-1"}}, "carol": {"1", "carol", 30, []string{"1-2"}}} {
+		var bal Balance
+		decodePayload(t, mustQuery(t, s, "findBalance", "1", member), &bal)
+		if !reflect.DeepEqual(bal, want) {
+			t.Errorf("balance of %s: %+v, want %+v", member, bal, want)
+		}
+	}
+	for _, m := range [][2]string{{"1", "alice"}, {"2", "bob"}} {
+		if resp, _ := s.query("findBalance", m[0], m[1]); resp.Code != CodeNoRecords {
+			t.Errorf("balance of %s at seller %s: code %d", m[1], m[0], resp.Code)
+		}
+	}
+	var points AllPoint
+	decodePayload(t, mustQuery(t, s, "findPointWithOwner", "carol"), &points)
+	if len(points.Points) != 1 || points.Points[0] != (Point{Id: "1-2", Owner: "carol", Points: 30}) {
+		t.Errorf("points of carol: %+v", points)
+	}
+	var hist PointHistory
+	decodePayload(t, mustQuery(t, s, "findPointHistory", "1-2"), &hist)
+	if len(hist.History) != 2 || hist.History[0].PrevOwner != "bob" || hist.History[0].NewOwner != "alice" || hist.History[1].NewOwner != "carol" {
+		t.Errorf("history of the split lot: %+v", hist)
+	}
+	var all AllTransfer
+	decodePayload(t, mustQuery(t, s, "findTransfers", "1", "carol"), &all)
+	if len(all.Transfers) != 1 || all.Transfers[0].From != "alice" || all.Transfers[0].Points != 30 || all.Transfers[0].Seller != "1" ||
+		!reflect.DeepEqual(all.Transfers[0].Lots, []string{"1-2"}) {
+		t.Errorf("transfers of carol: %+v", all)
+	}
+	if resp, _ := s.query("findLatest", "1", "10"); resp.Code != CodeNoRecords {
+		t.Errorf("transfers must not show up as exchanges: code %d", resp.Code)
+	}
+
+	var erasure Erasure
+	decodePayload(t, mustInvoke(t, s, "erase_member", "1", "carol"), &erasure)
+	if len(erasure.Transfers) != 1 || !erasure.Balance || !reflect.DeepEqual(erasure.Points, []string{"1-2"}) || erasure.MemberKey {
+		t.Errorf("erasure of a member with a transfer and a lot: %+v", erasure)
+	}
+	all = AllTransfer{}
+	decodePayload(t, mustQuery(t, s, "findTransfers", "1"), &all)
+	if len(all.Transfers) != 2 || all.Transfers[1].To != erasure.Replacement || all.Transfers[1].Erased != erasure.Id {
+		t.Errorf("transfers after erasure: %+v", all)
+	}
+	var bal Balance
+	decodePayload(t, mustQuery(t, s, "findBalance", "1", erasure.Replacement), &bal)
+	if bal.Points != 30 {
+		t.Errorf("balance of the erased member: %+v", bal)
+	}
+	decodePayload(t, mustInvoke(t, s, "erase_member", "1", "alice"), &erasure)
+	if !erasure.MemberKey {
+		t.Errorf("erasure of a member with a key: %+v", erasure)
+	}
+	if resp, _ := s.query("findMemberKey", "1", "alice"); resp.Code != CodeNoRecords {
+		t.Errorf("key of an erased member: code %d", resp.Code)
+	}
+}
+
+// The balances are the lots the members own: they change with the points that
+// are issued, handed over and redeemed, never with the amounts of an exchange
+// that moves no points.
+func TestBalancesFollowPoints(t *testing.T) {
+	s := newLedger(t)
+	mustInvoke(t, s, "credit_member", "1", "bob", "100")
+	mustInvoke(t, s, "credit_member", "2", "alice", "40")
+	balances := func(name string, want map[[2]string]int) {
+		for m, points := range want {
+			resp, _ := s.query("findBalance", m[0], m[1])
+			var bal Balance
+			if resp.Payload != nil {
+				json.Unmarshal(*resp.Payload, &bal)
+			}
+			if bal.Points != points || (points == 0) != (resp.Code == CodeNoRecords) {
+				t.Errorf("%s: %s at seller %s holds %+v (%d), want %d", name, m[1], m[0], bal, resp.Code, points)
+			}
+		}
+	}
+	balances("issued", map[[2]string]int{{"1", "bob"}: 100, {"2", "alice"}: 40, {"1", "alice"}: 0})
+
+	exchange(t, s, "t1", "60", "30", "1480838400000")
+	mustInvoke(t, s, "init_ring_exchange", "r1", "1480838401000", `[{"USER_ID":"bob","SELLER_ID":"1","POINT_IN":5,"POINT_OUT":5},`+
+		`{"USER_ID":"alice","SELLER_ID":"2","POINT_IN":5,"POINT_OUT":5}]`)
+	mustInvoke(t, s, "init_point", "1-a", "bob")
+	mustInvoke(t, s, "set_user", "1-a", "alice")
+	balances("exchanges without points", map[[2]string]int{{"1", "bob"}: 100, {"2", "alice"}: 40, {"1", "alice"}: 0})
+	if resp, _ := s.invoke("set_user", "1-1", "alice"); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("set_user on a lot with points: code %d (%s)", resp.Code, resp.Message)
+	}
+
+	mustInvoke(t, s, "init_bundle_exchange", "b1", "bob", "alice", "1", "2", "100", "40", "1480838402000",
+		`[{"id":"1-1","owner":"bob"},{"id":"2-1","owner":"alice"}]`)
+	balances("bundle", map[[2]string]int{{"1", "bob"}: 0, {"2", "bob"}: 40, {"1", "alice"}: 100, {"2", "alice"}: 0})
+	mustInvoke(t, s, "delete", "2-1")
+	balances("redeemed", map[[2]string]int{{"2", "bob"}: 0, {"1", "alice"}: 100})
+
+	if resp, _ := s.query("findTransfers", "1"); resp.Code != CodeNoRecords {
+		t.Errorf("exchanges show up as transfers: code %d", resp.Code)
+	}
+}
+
+func TestRegisterMemberKey(t *testing.T) {
+	s := newLedger(t)
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mustInvoke(t, s, "register_member_key", "1", "bob", publicKeyPEM(oldKey))
+	var mk MemberKey
+	decodePayload(t, mustQuery(t, s, "findMemberKey", "01", "bob"), &mk)
+	if mk.Seller != "1" || mk.User != "bob" || mk.PublicKey != publicKeyPEM(oldKey) || mk.TxID == "" {
+		t.Errorf("member key %+v", mk)
+	}
+
+	rotate := []string{"1", "bob", publicKeyPEM(newKey)}
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"replaced without a signature", rotate, CodeNoPermissionRecord},
+		{"signed by the new key", append(rotate, signPayload(newKey, MemberKeyPayload(rotate))), CodeNoPermissionRecord},
+		{"not a key", []string{"1", "alice", "key"}, CodeParamError},
+		{"erased member", []string{"1", "erased:tx1", publicKeyPEM(newKey)}, CodeParamError},
+		{"signed by the old key", append(rotate, signPayload(oldKey, MemberKeyPayload(rotate))), CodeRecorded},
+	}
+	for _, tt := range tests {
+		resp, _ := s.invoke("register_member_key", tt.args...)
+		if resp.Code != tt.code {
+			t.Errorf("%s: code %d, want %d (%s)", tt.name, resp.Code, tt.code, resp.Message)
+		}
+	}
+	mustInvoke(t, s, "init", "1")
+	decodePayload(t, mustQuery(t, s, "findMemberKey", "1", "bob"), &mk)
+	if mk.PublicKey != publicKeyPEM(newKey) {
+		t.Errorf("key after the rotation and a reset %+v", mk)
+	}
+	if resp, _ := s.query("findMemberKey", "1", "alice"); resp.Code != CodeNoRecords {
+		t.Errorf("key of a member without one: code %d", resp.Code)
+	}
+
+	registerSellerKey(t, s, "2")
+	if resp, _ := s.invoke("register_member_key", "2", "carol", publicKeyPEM(newKey)); resp.Code != CodeParamError {
+		t.Errorf("clear member of a seller with a key: code %d (%s)", resp.Code, resp.Message)
+	}
+	s.attrs = map[string]string{}
+	if resp, _ := s.invoke("register_member_key", "1", "dave", publicKeyPEM(newKey)); resp.Code != CodeNoPermissionRecord {
+		t.Errorf("member key without the admin role: code %d (%s)", resp.Code, resp.Message)
+	}
+}
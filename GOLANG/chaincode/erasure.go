@@ -0,0 +1,399 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Erasures are not derived state, Init keeps them as the evidence that the
+// requests were honoured.
+var erasureStr = "erasure" //object type of the composite keys that store each erasure, by seller and time
+
+// erasedPrefix starts what an erased member is replaced with, the erasure
+// transaction follows. The records of the member stay linked to each other,
+// for the member counts of the aggregates, but no longer to the member.
+var erasedPrefix = "erased:"
+
+// Erasure is the record of a member's identifiers removed from the state.
+// Amounts, sellers, times and the Merkle trees are left as they were. The
+// blocks of the channel still hold the transactions that wrote the member,
+// only the world state the queries read is cleared.
+//
+// That makes an erasure a removal from the queries, not an anonymisation. The
+// leaf of an erased exchange still hashes the record as it was, unsalted, and
+// everything in it but the member is still readable, so whoever can guess a
+// short member id can check the guess against the leaf. A salt would not help
+// as long as the leaf must verify from what is on the ledger: the chaincode
+// could only store it next to the leaf, or in the blocks that keep the record
+// anyway. Sellers that need more make their members pseudonymous, whose ids
+// cannot be guessed without the seller's key.
+//
+// A receipt fetched after the erasure carries it in Erased and only proves its
+// leaf, the record it would be checked against is gone; a receipt kept from
+// before still verifies in full.
+type Erasure struct {
+	Id              string   `json:"id"` //the erase_member transaction
+	Seller          string   `json:"SELLER_ID"`
+	Timestamp       string   `json:"time"`
+	Replacement     string   `json:"replacement"`
+	Exchanges       []string `json:"exchanges"`
+	Points          []string `json:"points"`
+	Reconciliations []string `json:"reconciliations"`
+	Transfers       []string `json:"transfers"`
+	Balance         bool     `json:"balance"`    //lots of the seller that carry points, the member's balance, now stand under the replacement
+	MemberKey       bool     `json:"member_key"` //the member's key and the nonces it signed were dropped
+}
+
+type AllErasure struct {
+	Erasures []Erasure `json:"erasure"`
+}
+
+// ============================================================================================================================
+// Erase Member - replace a member of a seller with an erased: token in its exchanges, points, reconciliations,
+// transfers and balance
+// ============================================================================================================================
+func (t *SimpleChaincode) erase_member(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", "member"
+	seller, _ := strconv.Atoi(args[0]) //checked by the registry
+	user := args[1]
+	if strings.HasPrefix(user, erasedPrefix) {
+		return nil, ParamError(user + " is already erased")
+	}
+	ms, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	erasure := Erasure{Id: stub.GetTxID(), Seller: strconv.Itoa(seller), Timestamp: ms,
+		Exchanges: []string{}, Points: []string{}, Reconciliations: []string{}, Transfers: []string{}}
+	erasure.Replacement = erasedPrefix + strings.ToLower(erasure.Id) //point owners are lower case
+
+	erased, err := eraseExchanges(stub, &erasure, user)
+	if err != nil {
+		return nil, err
+	}
+	bundled := make(map[string]bool) //points handed over in the member's exchanges, of any seller
+	for _, tx := range erased {
+		for _, p := range tx.Related {
+			bundled[p.Id] = true
+		}
+	}
+	err = erasePoints(stub, &erasure, strings.ToLower(user), bundled)
+	if err != nil {
+		return nil, err
+	}
+	err = eraseReconciliations(stub, &erasure, user)
+	if err != nil {
+		return nil, err
+	}
+	err = eraseTransfers(stub, &erasure, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(erased)+len(erasure.Points)+len(erasure.Reconciliations)+len(erasure.Transfers) == 0 && !erasure.Balance && !erasure.MemberKey {
+		return nil, NotFoundError("No records of " + user + " for seller " + erasure.Seller)
+	}
+
+	at, _ := strconv.ParseInt(ms, 10, 64)
+	key, err := stub.CreateCompositeKey(erasureStr, []string{erasure.Seller, fmt.Sprintf("%020d", at), erasure.Id}) //sorts like time
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	jsonAsBytes, _ := json.Marshal(erasure)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAsBytes, nil
+}
+
+// eraseExchanges - replace the member on the seller's sides of its exchanges, in the records, the lists and the
+// aggregate member counts. Returns the erased records by id.
+func eraseExchanges(stub shim.ChaincodeStubInterface, erasure *Erasure, user string) (map[string]Transaction, error) {
+	seller, _ := strconv.Atoi(erasure.Seller)
+	txs, err := sellerTxs(stub, seller, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	erased := make(map[string]Transaction)
+	sellerIds := make(map[string]bool) //the aggregates are keyed by the normalised seller
+	for _, tx := range txs {
+		changed := false
+		if sameSeller(tx.SellerA, erasure.Seller) && tx.TraderA == user {
+			tx.TraderA, changed = erasure.Replacement, true
+			sellerIds[normalSeller(tx.SellerA)] = true
+		}
+		if sameSeller(tx.SellerB, erasure.Seller) && tx.TraderB == user {
+			tx.TraderB, changed = erasure.Replacement, true
+			sellerIds[normalSeller(tx.SellerB)] = true
+		}
+		for i, leg := range tx.Legs {
+			if sameSeller(leg.Seller, erasure.Seller) && leg.User == user {
+				tx.Legs[i].User, changed = erasure.Replacement, true
+				sellerIds[normalSeller(leg.Seller)] = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		for i, p := range tx.Related {
+			if p.Owner == strings.ToLower(user) {
+				tx.Related[i].Owner = erasure.Replacement
+			}
+		}
+		tx.Erased = erasure.Id
+		recordKey, _ := stub.CreateCompositeKey(txRecordStr, []string{tx.Id})
+		jsonAsBytes, _ := json.Marshal(tx)
+		err = stub.PutState(recordKey, jsonAsBytes) //the leaf of its receipt keeps the hash of the record as it was
+		if err != nil {
+			return nil, err
+		}
+		erased[tx.Id] = tx
+		erasure.Exchanges = append(erasure.Exchanges, tx.Id)
+	}
+	if len(erased) == 0 {
+		return erased, nil
+	}
+
+	for _, listKey := range []string{minimalTxStr, transectionStr} {
+		listAsBytes, err := stub.GetState(listKey)
+		if err != nil {
+			return nil, errors.New("Failed to get TXs")
+		}
+		var list AllTx
+		json.Unmarshal(listAsBytes, &list)
+		changed := false
+		for i, tx := range list.TXs {
+			if e, ok := erased[tx.Id]; ok {
+				list.TXs[i], changed = e, true
+			}
+		}
+		if changed {
+			jsonAsBytes, _ := json.Marshal(list)
+			err = stub.PutState(listKey, jsonAsBytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	debugAsBytes, err := stub.GetState("_debug1") //the last exchange, older versions kept a copy
+	if err != nil {
+		return nil, errors.New("Failed to get _debug1")
+	}
+	debug := Transaction{}
+	json.Unmarshal(debugAsBytes, &debug)
+	if _, ok := erased[debug.Id]; ok {
+		err = stub.DelState("_debug1")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for sellerId := range sellerIds {
+		err = eraseAggregateMember(stub, sellerId, user, erasure.Replacement)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return erased, nil
+}
+
+// eraseAggregateMember - move the keys that counted the member in the aggregates of seller to its replacement
+func eraseAggregateMember(stub shim.ChaincodeStubInterface, seller string, user string, replacement string) error {
+	keysIter, err := stub.GetStateByPartialCompositeKey(aggregateMemberStr, []string{seller})
+	if err != nil {
+		return errors.New("Failed to get aggregate members of " + seller)
+	}
+	var counted [][]string
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			keysIter.Close()
+			return errors.New("Failed to get aggregate members of " + seller)
+		}
+		_, attrs, err := stub.SplitCompositeKey(kv.Key)
+		if err == nil && len(attrs) == 5 && attrs[4] == user {
+			counted = append(counted, attrs)
+		}
+	}
+	keysIter.Close()
+
+	for _, attrs := range counted {
+		oldKey, _ := stub.CreateCompositeKey(aggregateMemberStr, attrs)
+		newKey, _ := stub.CreateCompositeKey(aggregateMemberStr, append(attrs[:4:4], replacement))
+		err = stub.DelState(oldKey)
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(newKey, []byte("1"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// erasePoints - replace the member as the owner of the seller's points and in their history. The points of a
+// seller are the ones whose id starts with the seller and a dash, as init_point is called with, and the points
+// bundled with the member's exchanges.
+func erasePoints(stub shim.ChaincodeStubInterface, erasure *Erasure, owner string, bundled map[string]bool) error {
+	indexAsBytes, err := stub.GetState(pointIndexStr)
+	if err != nil {
+		return errors.New("Failed to get point index")
+	}
+	var pointIndex []string
+	json.Unmarshal(indexAsBytes, &pointIndex)
+
+	for _, id := range pointIndex {
+		if pointSeller(id) != erasure.Seller && !bundled[id] {
+			continue
+		}
+		changed := false
+		pointAsBytes, err := stub.GetState(id)
+		if err != nil {
+			return errors.New("Failed to get point " + id)
+		}
+		res := Point{}
+		json.Unmarshal(pointAsBytes, &res)
+		if pointAsBytes != nil && res.Owner == owner {
+			res.Owner, changed = erasure.Replacement, true
+			if res.Points > 0 && pointSeller(id) == erasure.Seller {
+				erasure.Balance = true
+			}
+			jsonAsBytes, _ := json.Marshal(res)
+			err = stub.PutState(id, jsonAsBytes)
+			if err != nil {
+				return err
+			}
+			err = removeFromOwnerIndex(stub, owner, id)
+			if err != nil {
+				return err
+			}
+			err = addToOwnerIndex(stub, res.Owner, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		histKey, err := stub.CreateCompositeKey(pointHistoryStr, []string{id})
+		if err != nil {
+			return ParamError(err.Error())
+		}
+		histAsBytes, err := stub.GetState(histKey)
+		if err != nil {
+			return errors.New("Failed to get point history")
+		}
+		hist := PointHistory{}
+		json.Unmarshal(histAsBytes, &hist)
+		histChanged := false
+		for i, change := range hist.History {
+			if change.PrevOwner == owner {
+				hist.History[i].PrevOwner, histChanged = erasure.Replacement, true
+			}
+			if change.NewOwner == owner {
+				hist.History[i].NewOwner, histChanged = erasure.Replacement, true
+			}
+		}
+		if histChanged {
+			jsonAsBytes, _ := json.Marshal(hist)
+			err = stub.PutState(histKey, jsonAsBytes)
+			if err != nil {
+				return err
+			}
+		}
+		if changed || histChanged {
+			erasure.Points = append(erasure.Points, id)
+		}
+	}
+	return nil
+}
+
+// eraseReconciliations - replace the member in the USER_ID mismatches of the seller's reconciliations. Their
+// RECORDS_SHA256 stays the hash of the records as the seller sent them.
+func eraseReconciliations(stub shim.ChaincodeStubInterface, erasure *Erasure, user string) error {
+	keysIter, err := stub.GetStateByPartialCompositeKey(reconciliationStr, []string{erasure.Seller})
+	if err != nil {
+		return errors.New("Failed to get the reconciliations of seller " + erasure.Seller)
+	}
+	changed := make(map[string]Reconciliation)
+	var keys []string
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			keysIter.Close()
+			return errors.New("Failed to get the reconciliations of seller " + erasure.Seller)
+		}
+		res := Reconciliation{}
+		json.Unmarshal(kv.Value, &res)
+		found := false
+		for i, m := range res.Mismatches {
+			if m.Field != "USER_ID" {
+				continue
+			}
+			if m.Ledger == user {
+				res.Mismatches[i].Ledger, found = erasure.Replacement, true
+			}
+			if m.Seller == user {
+				res.Mismatches[i].Seller, found = erasure.Replacement, true
+			}
+		}
+		if found {
+			changed[kv.Key] = res
+			keys = append(keys, kv.Key)
+		}
+	}
+	keysIter.Close()
+
+	for _, key := range keys {
+		jsonAsBytes, _ := json.Marshal(changed[key])
+		err = stub.PutState(key, jsonAsBytes)
+		if err != nil {
+			return err
+		}
+		erasure.Reconciliations = append(erasure.Reconciliations, changed[key].Id)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Find Erasures - the erasures of the members of a seller, oldest first, or the one with the given id
+// ============================================================================================================================
+func (t *SimpleChaincode) findErasures(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", *"id"*
+	seller, _ := strconv.Atoi(args[0]) //checked by the registry
+	id := ""
+	if len(args) == 2 {
+		id = args[1]
+	}
+
+	keysIter, err := stub.GetStateByPartialCompositeKey(erasureStr, []string{strconv.Itoa(seller)})
+	if err != nil {
+		return nil, errors.New("Failed to get the erasures of seller " + args[0])
+	}
+	defer keysIter.Close()
+
+	var all AllErasure
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get the erasures of seller " + args[0])
+		}
+		res := Erasure{}
+		json.Unmarshal(kv.Value, &res)
+		if id == "" || res.Id == id {
+			all.Erasures = append(all.Erasures, res)
+		}
+	}
+	if len(all.Erasures) == 0 {
+		return nil, NotFoundError("No erasures")
+	}
+	jsonAsBytes, _ := json.Marshal(all)
+	return jsonAsBytes, nil
+}
@@ -0,0 +1,89 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var pointHistoryStr = "pointhistory" //object type of the composite keys that store the ownership history of a point
+
+// OwnerChange is one entry of a point's provenance chain. The first entry of
+// every point has an empty prev_owner and records its creation, but for the
+// part of a lot a transfer split off, which starts with the member it came
+// from. A deleted point ends with an empty new_owner.
+type OwnerChange struct {
+	PrevOwner string `json:"prev_owner"`
+	NewOwner  string `json:"new_owner"`
+	TxID      string `json:"txID"`
+	Timestamp string `json:"time"` //ms since epoch, same format as EX_TIME
+}
+
+type PointHistory struct {
+	Id      string        `json:"id"`
+	History []OwnerChange `json:"history"`
+}
+
+// ============================================================================================================================
+// Tx Timestamp - timestamp of the running transaction in ms, as a string
+// ============================================================================================================================
+func txTimestamp(stub shim.ChaincodeStubInterface) (string, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return "", errors.New("Failed to get tx timestamp")
+	}
+	return strconv.FormatInt(ts.Seconds*1000+int64(ts.Nanos)/1000000, 10), nil
+}
+
+// ============================================================================================================================
+// Record Owner Change - append an ownership change to the history of a point
+// ============================================================================================================================
+func recordOwnerChange(stub shim.ChaincodeStubInterface, id string, prevOwner string, newOwner string) error {
+	ms, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	key, err := stub.CreateCompositeKey(pointHistoryStr, []string{id})
+	if err != nil {
+		return ParamError(err.Error())
+	}
+	histAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return errors.New("Failed to get point history")
+	}
+	hist := PointHistory{Id: id}
+	if histAsBytes != nil {
+		json.Unmarshal(histAsBytes, &hist)
+	}
+	hist.History = append(hist.History, OwnerChange{PrevOwner: prevOwner, NewOwner: newOwner, TxID: stub.GetTxID(), Timestamp: ms})
+
+	jsonAsBytes, _ := json.Marshal(hist)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// Find Point History - full provenance chain of a point, oldest first
+// ============================================================================================================================
+func (t *SimpleChaincode) findPointHistory(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0
+	// "point id"
+
+	key, err := stub.CreateCompositeKey(pointHistoryStr, []string{args[0]})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	histAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get point history")
+	}
+	if histAsBytes == nil {
+		return nil, NotFoundError("No history for point " + args[0])
+	}
+	hist := PointHistory{}
+	json.Unmarshal(histAsBytes, &hist)
+	jsonAsBytes, _ := json.Marshal(hist)
+	return jsonAsBytes, nil
+}
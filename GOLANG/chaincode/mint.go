@@ -0,0 +1,78 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var pointSeqStr = "pointseq" //object type of the composite keys that store the last point number of each seller, kept across init
+
+// mintPointId - the next free id under prefix, which ends with a dash. The seller is the part of the prefix before
+// the first dash and numbers its points with one sequence whatever the rest of the prefix, so ids never repeat. The
+// sequence is kept across init, and numbers taken by points created with an explicit id are skipped.
+func mintPointId(stub shim.ChaincodeStubInterface, prefix string) (string, error) {
+	seller := pointSeller(prefix)
+	if seller == "" {
+		return "", ParamError("A point id prefix must start with the seller")
+	}
+	seqKey, err := stub.CreateCompositeKey(pointSeqStr, []string{seller})
+	if err != nil {
+		return "", ParamError(err.Error())
+	}
+	seqAsBytes, err := stub.GetState(seqKey)
+	if err != nil {
+		return "", errors.New("Failed to get point sequence of seller " + seller)
+	}
+	seq, _ := strconv.ParseUint(string(seqAsBytes), 10, 64)
+	for {
+		seq++
+		id := prefix + strconv.FormatUint(seq, 10)
+		pointAsBytes, err := stub.GetState(id)
+		if err != nil {
+			return "", errors.New("Failed to get point id")
+		}
+		if pointAsBytes != nil {
+			continue //created with an explicit id, skip it
+		}
+		err = stub.PutState(seqKey, []byte(strconv.FormatUint(seq, 10)))
+		if err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+}
+
+// pointSeller - the seller a point belongs to, the part of its id before the first dash
+func pointSeller(id string) string {
+	return normalSeller(strings.SplitN(id, "-", 2)[0])
+}
+
+// createPoint - store a new point with its owner index and point index entries. Its history starts with prevOwner,
+// empty for a point that was issued, the member it was split from for the part of a lot a transfer hands over.
+func createPoint(stub shim.ChaincodeStubInterface, p Point, prevOwner string) error {
+	jsonAsBytes, _ := json.Marshal(p)
+	err := stub.PutState(p.Id, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	err = recordOwnerChange(stub, p.Id, prevOwner, p.Owner)
+	if err != nil {
+		return err
+	}
+	err = addToOwnerIndex(stub, p.Owner, p.Id)
+	if err != nil {
+		return err
+	}
+	indexAsBytes, err := stub.GetState(pointIndexStr)
+	if err != nil {
+		return errors.New("Failed to get point index")
+	}
+	var pointIndex []string
+	json.Unmarshal(indexAsBytes, &pointIndex)
+	jsonAsBytes, _ = json.Marshal(append(pointIndex, p.Id))
+	return stub.PutState(pointIndexStr, jsonAsBytes)
+}
@@ -0,0 +1,305 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// mockStub is an in-memory ChaincodeStubInterface for unit tests. It keeps the
+// world state in a map, numbers transactions, hands out a clock that advances
+// one second per transaction and rolls back the writes of failed invocations,
+// like a peer does. Stub methods the chaincode never calls are left to the
+// embedded nil interface and panic.
+type mockStub struct {
+	shim.ChaincodeStubInterface
+
+	cc     *SimpleChaincode
+	state  map[string][]byte
+	attrs  map[string]string //caller cert attributes, as fabric-ca would issue them
+	broken map[string]bool   //keys whose reads fail, as on a peer that cannot reach its state database
+	events []mockEvent
+	args   [][]byte
+	txNum  int
+	txID   string
+	now    time.Time
+}
+
+type mockEvent struct {
+	Name    string
+	Payload []byte
+}
+
+func newMockStub() *mockStub {
+	return &mockStub{
+		cc:    new(SimpleChaincode),
+		state: make(map[string][]byte),
+		attrs: map[string]string{roleAttr: roleAdmin},
+		now:   time.Date(2016, 12, 4, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+// ============================================================================================================================
+// Driving the chaincode
+// ============================================================================================================================
+func (s *mockStub) begin(function string, args []string) map[string][]byte {
+	s.txNum++
+	s.txID = "tx" + strconv.Itoa(s.txNum)
+	s.now = s.now.Add(time.Second)
+	s.args = [][]byte{[]byte(function)}
+	for _, a := range args {
+		s.args = append(s.args, []byte(a))
+	}
+	snapshot := make(map[string][]byte, len(s.state))
+	for k, v := range s.state {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+func (s *mockStub) end(snapshot map[string][]byte, discard bool) {
+	if discard {
+		s.state = snapshot //the peer discards the writes of a failed or evaluated transaction
+	}
+	s.txID = ""
+	s.args = nil
+}
+
+func (s *mockStub) deploy(args ...string) (Response, error) {
+	snapshot := s.begin("init", args)
+	res := s.cc.Init(s)
+	s.end(snapshot, res.Status >= shim.ERRORTHRESHOLD)
+	return decodeResponse(res)
+}
+
+func (s *mockStub) invoke(function string, args ...string) (Response, error) {
+	snapshot := s.begin(function, args)
+	res := s.cc.Invoke(s)
+	s.end(snapshot, res.Status >= shim.ERRORTHRESHOLD)
+	return decodeResponse(res)
+}
+
+// query evaluates a function without committing it, like a client that only asks one peer
+func (s *mockStub) query(function string, args ...string) (Response, error) {
+	snapshot := s.begin(function, args)
+	res := s.cc.Invoke(s)
+	s.end(snapshot, true)
+	return decodeResponse(res)
+}
+
+// decodeResponse reads the envelope from the payload, a failed invocation also returns its message as the error
+func decodeResponse(res pb.Response) (Response, error) {
+	var resp Response
+	var err error
+	if res.Status >= shim.ERRORTHRESHOLD {
+		err = errors.New(res.Message)
+	}
+	if jsonErr := json.Unmarshal(res.Payload, &resp); jsonErr != nil {
+		return resp, errors.New("not a Response envelope: " + string(res.Payload) + " " + res.Message)
+	}
+	return resp, err
+}
+
+// ============================================================================================================================
+// ChaincodeStubInterface
+// ============================================================================================================================
+func (s *mockStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *mockStub) GetStringArgs() []string {
+	var args []string
+	for _, a := range s.args {
+		args = append(args, string(a))
+	}
+	return args
+}
+
+func (s *mockStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+func (s *mockStub) GetTxID() string {
+	return s.txID
+}
+
+func (s *mockStub) GetChannelID() string {
+	return "ccpx"
+}
+
+func (s *mockStub) GetState(key string) ([]byte, error) {
+	if s.broken[key] {
+		return nil, errors.New("state database unavailable")
+	}
+	return s.state[key], nil
+}
+
+func (s *mockStub) PutState(key string, value []byte) error {
+	if s.txID == "" {
+		return errors.New("Cannot PutState outside of a transaction")
+	}
+	s.state[key] = value
+	return nil
+}
+
+func (s *mockStub) DelState(key string) error {
+	if s.txID == "" {
+		return errors.New("Cannot DelState outside of a transaction")
+	}
+	delete(s.state, key)
+	return nil
+}
+
+func (s *mockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *mockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, "\x00") || !strings.HasSuffix(compositeKey, "\x00") {
+		return "", nil, errors.New("not a composite key: " + compositeKey)
+	}
+	parts := strings.Split(compositeKey[1:len(compositeKey)-1], "\x00")
+	return parts[0], parts[1:], nil
+}
+
+// GetStateByPartialCompositeKey returns the composite keys that start with the given attributes, sorted
+func (s *mockStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for k := range s.state {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	it := &mockIterator{}
+	for _, k := range keys {
+		it.kvs = append(it.kvs, &queryresult.KV{Key: k, Value: s.state[k]})
+	}
+	return it, nil
+}
+
+// GetCreator returns a serialized identity whose certificate carries s.attrs the way fabric-ca encodes them
+func (s *mockStub) GetCreator() ([]byte, error) {
+	attrs, _ := json.Marshal(map[string]map[string]string{"attrs": s.attrs})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.txNum) + 1),
+		Subject:      pkix.Name{CommonName: "member"},
+		NotBefore:    s.now.Add(-time.Hour),
+		NotAfter:     s.now.Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: attrs},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	id := &msp.SerializedIdentity{
+		Mspid:   "CCPXMSP",
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+	return proto.Marshal(id)
+}
+
+func (s *mockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now.Unix(), Nanos: int32(s.now.Nanosecond())}, nil
+}
+
+func (s *mockStub) SetEvent(name string, payload []byte) error {
+	s.events = append(s.events, mockEvent{Name: name, Payload: payload})
+	return nil
+}
+
+// mockIterator walks a snapshot of the keys of a range query
+type mockIterator struct {
+	kvs []*queryresult.KV
+	pos int
+}
+
+func (it *mockIterator) HasNext() bool {
+	return it.pos < len(it.kvs)
+}
+
+func (it *mockIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more keys")
+	}
+	it.pos++
+	return it.kvs[it.pos-1], nil
+}
+
+func (it *mockIterator) Close() error {
+	return nil
+}
+
+// ============================================================================================================================
+// The mock itself
+// ============================================================================================================================
+func TestMockStubRollsBackFailedInvoke(t *testing.T) {
+	s := newMockStub()
+	if _, err := s.deploy("99"); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if _, err := s.invoke("init_point", "p1", "bob"); err != nil {
+		t.Fatalf("init_point: %v", err)
+	}
+	before := len(s.state)
+
+	resp, err := s.invoke("init_point", "p1", "alice")
+	if err == nil || resp.Code != CodeConflict {
+		t.Fatalf("expected a %d conflict, got %d %v", CodeConflict, resp.Code, err)
+	}
+	if len(s.state) != before {
+		t.Errorf("failed invoke left %d keys behind", len(s.state)-before)
+	}
+}
+
+func TestMockStubPartialCompositeKey(t *testing.T) {
+	s := newMockStub()
+	s.txID = "t"
+	for _, attrs := range [][]string{{"a", "2"}, {"a", "1"}, {"ab", "1"}, {"b", "1"}} {
+		key, _ := s.CreateCompositeKey("obj", attrs)
+		s.PutState(key, []byte{0x00})
+	}
+	it, _ := s.GetStateByPartialCompositeKey("obj", []string{"a"})
+	var got []string
+	for it.HasNext() {
+		kv, _ := it.Next()
+		_, attrs, _ := s.SplitCompositeKey(kv.Key)
+		got = append(got, strings.Join(attrs, "/"))
+	}
+	if len(got) != 2 || got[0] != "a/1" || got[1] != "a/2" {
+		t.Errorf("partial key a = %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var ownerIndexStr = "owner~point" //object type of the composite keys that pair an owner with each point it holds
+
+type AllPoint struct {
+	Points []Point `json:"points"`
+}
+
+func ownerIndexKey(stub shim.ChaincodeStubInterface, owner string, id string) (string, error) {
+	key, err := stub.CreateCompositeKey(ownerIndexStr, []string{strings.ToLower(owner), id})
+	if err != nil {
+		return "", ParamError(err.Error())
+	}
+	return key, nil
+}
+
+// ============================================================================================================================
+// Get Owner Index - ids of the points held by owner, sorted
+// ============================================================================================================================
+func getOwnerIndex(stub shim.ChaincodeStubInterface, owner string) ([]string, error) {
+	keysIter, err := stub.GetStateByPartialCompositeKey(ownerIndexStr, []string{strings.ToLower(owner)})
+	if err != nil {
+		return nil, errors.New("Failed to get owner index")
+	}
+	defer keysIter.Close()
+
+	var ownerIndex []string
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get owner index")
+		}
+		_, attrs, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(attrs) != 2 {
+			continue
+		}
+		ownerIndex = append(ownerIndex, attrs[1])
+	}
+	return ownerIndex, nil
+}
+
+// ============================================================================================================================
+// Add To Owner Index - remember that owner holds point id
+// ============================================================================================================================
+func addToOwnerIndex(stub shim.ChaincodeStubInterface, owner string, id string) error {
+	key, err := ownerIndexKey(stub, owner, id)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte{0x00}) //the key is the index, the value only has to exist
+}
+
+// ============================================================================================================================
+// Remove From Owner Index - forget that owner holds point id
+// ============================================================================================================================
+func removeFromOwnerIndex(stub shim.ChaincodeStubInterface, owner string, id string) error {
+	key, err := ownerIndexKey(stub, owner, id)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// ============================================================================================================================
+// Find Point With Owner - all points held by an owner
+// ============================================================================================================================
+func (t *SimpleChaincode) findPointWithOwner(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0
+	// "owner"
+
+	ownerIndex, err := getOwnerIndex(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ownerIndex) == 0 {
+		return nil, NotFoundError("No points for " + args[0])
+	}
+	var related AllPoint
+	for _, id := range ownerIndex {
+		pointAsBytes, err := stub.GetState(id)
+		if err != nil {
+			return nil, errors.New("Failed to get point " + id)
+		}
+		res := Point{}
+		json.Unmarshal(pointAsBytes, &res) //un stringify it aka JSON.parse()
+		related.Points = append(related.Points, res)
+	}
+	jsonAsBytes, _ := json.Marshal(related)
+	return jsonAsBytes, nil
+}
@@ -0,0 +1,147 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var sellerPolicyStr = "sellerpolicy" //object type of the composite keys that store the policy of each seller, kept across init
+
+// SellerPolicy is how the chaincode treats the records of one seller
+type SellerPolicy struct {
+	Seller       string `json:"SELLER_ID"`
+	Pseudonymous bool   `json:"pseudonymous"`           //its members only appear on the ledger as pseudonyms, see package pseudonym
+	Transfers    bool   `json:"transfers"`              //its members may transfer its points to each other, see transfer_points
+	MaxTransfer  int    `json:"max_transfer,omitempty"` //most points one transfer may move, 0 is no limit
+	TxID         string `json:"txID"`                   //last change
+	Timestamp    string `json:"time"`
+}
+
+// sellerPolicy - the policy of a seller, the zero policy when it never set one
+func sellerPolicy(stub shim.ChaincodeStubInterface, seller string) (SellerPolicy, string, error) {
+	policy := SellerPolicy{Seller: normalSeller(seller)}
+	key, err := stub.CreateCompositeKey(sellerPolicyStr, []string{policy.Seller})
+	if err != nil {
+		return policy, "", ParamError(err.Error())
+	}
+	policyAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return policy, "", errors.New("Failed to get the policy of seller " + seller)
+	}
+	if policyAsBytes != nil {
+		json.Unmarshal(policyAsBytes, &policy)
+	}
+	return policy, key, nil
+}
+
+// ============================================================================================================================
+// Set Seller Policy - change the policy of a seller, the fields left out of POLICY keep their value
+// ============================================================================================================================
+func (t *SimpleChaincode) set_seller_policy(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0           1
+	// "seller", "{"pseudonymous":true}"
+	policy, key, err := sellerPolicy(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal([]byte(args[1]), &fields)
+	for name := range fields {
+		if name == "SELLER_ID" || name == "txID" || name == "time" {
+			return nil, ParamError("POLICY cannot set " + name)
+		}
+	}
+	if err := json.Unmarshal([]byte(args[1]), &policy); err != nil {
+		return nil, ParamError("POLICY must be a JSON object of policy fields: " + err.Error())
+	}
+	if policy.MaxTransfer < 0 {
+		return nil, ParamError("max_transfer cannot be negative")
+	}
+
+	policy.Seller = normalSeller(args[0])
+	policy.TxID = stub.GetTxID()
+	policy.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	jsonAsBytes, _ := json.Marshal(policy)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Find Seller Policy - the policy of a seller
+// ============================================================================================================================
+func (t *SimpleChaincode) findSellerPolicy(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0
+	// "seller"
+	policy, _, err := sellerPolicy(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	jsonAsBytes, _ := json.Marshal(policy)
+	return jsonAsBytes, nil
+}
+
+// checkPseudonyms - the members of pseudonymous sellers must come as pseudonyms. A seller that registered a key is
+// pseudonymous whatever its policy says: it signs its records on its own side, so it hashes its members there too.
+func checkPseudonyms(stub shim.ChaincodeStubInterface, members ...[2]string) error {
+	for _, m := range members { //seller, member
+		if pseudonym.Is(m[1]) {
+			continue
+		}
+		policy, _, err := sellerPolicy(stub, m[0])
+		if err != nil {
+			return err
+		}
+		if policy.Pseudonymous {
+			return ParamError("Seller " + m[0] + " records its members as pseudonyms, " + m[1] + " is not one")
+		}
+		sk, err := sellerKey(stub, m[0])
+		if err != nil {
+			return err
+		}
+		if sk != nil {
+			return ParamError("Seller " + m[0] + " has a key and records its members as pseudonyms, " + m[1] + " is not one")
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Find User Exchanges - the exchanges of a member of a seller, oldest first. The member is what the ledger holds, the
+// pseudonym for pseudonymous sellers.
+// ============================================================================================================================
+func (t *SimpleChaincode) findUserEx(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", "member"
+	seller, _ := strconv.Atoi(args[0]) //checked by the registry
+	user := args[1]
+
+	txs, err := sellerTxs(stub, seller, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	var processed AllTx
+	for _, tx := range txs {
+		for _, side := range tx.sides() {
+			if sameSeller(side.Seller, strconv.Itoa(seller)) && side.User == user {
+				processed.TXs = append(processed.TXs, tx)
+				break
+			}
+		}
+	}
+	if len(processed.TXs) == 0 {
+		return nil, NotFoundError("No records")
+	}
+	jsonAsBytes, _ := json.Marshal(processed)
+	return jsonAsBytes, nil
+}
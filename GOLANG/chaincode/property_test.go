@@ -0,0 +1,440 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// The conservation harness drives long random sequences of issue
+// (credit_member), exchange (init_bundle_exchange handing lots over), reverse
+// (the bundle that hands them back), transfer (transfer_points), redeem
+// (delete), hand over (set_user, always refused for lots) and plain exchange
+// (init_transaction) calls, valid and invalid, against a model of the lots the
+// ledger should hold. After every step it checks the point records, the owner
+// index, the histories and the balances against that model, and the supply of
+// each seller against what was issued and redeemed, counted from the steps
+// alone.
+
+var propSellers = []string{"1", "2", "3"}
+var propMembers = []string{"ann", "bob", "cat", "dan", "eve"}
+
+// propLot is a lot as the model expects it on the ledger
+type propLot struct {
+	seller string
+	owner  string
+	points int
+	first  string //prev_owner of the first history entry, the sender for a lot split off by a transfer
+}
+
+// propBundle is an accepted bundle exchange, what a reverse step hands back
+type propBundle struct {
+	id           string
+	userA, userB string
+	given        []Point //lot and the member that gave it
+}
+
+// propModel is what the ledger must hold after the successful calls so far
+type propModel struct {
+	lots     map[string]*propLot
+	gone     map[string]bool //redeemed lots, their history ends with an empty owner
+	seq      map[string]int  //seller -> last lot number minted
+	issued   map[string]int  //seller -> points issued, from the issue steps only
+	redeemed map[string]int  //seller -> points redeemed, from the redeem steps only
+	bundles  []propBundle
+	txs      int
+	nonces   map[[2]string]string //seller, member -> a nonce it signed
+}
+
+func TestPointConservation(t *testing.T) {
+	seeds, steps := 20, 300
+	if testing.Short() {
+		seeds, steps = 3, 100
+	}
+	for seed := int64(1); seed <= int64(seeds); seed++ {
+		runConservation(t, seed, steps)
+		if t.Failed() {
+			t.Fatalf("invariant broken with seed %d", seed)
+		}
+	}
+}
+
+func runConservation(t *testing.T, seed int64, steps int) {
+	r := rand.New(rand.NewSource(seed))
+	s := newLedger(t)
+	m := &propModel{lots: make(map[string]*propLot), gone: make(map[string]bool), seq: make(map[string]int),
+		issued: make(map[string]int), redeemed: make(map[string]int), nonces: make(map[[2]string]string)}
+	exTime := int64(1480838400000)
+
+	keys := make(map[[2]string]*ecdsa.PrivateKey)
+	for _, seller := range propSellers {
+		mustInvoke(t, s, "set_seller_policy", seller, `{"transfers":true}`)
+		for _, member := range propMembers {
+			key, _ := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+			keys[[2]string{seller, member}] = key
+			mustInvoke(t, s, "register_member_key", seller, member, publicKeyPEM(key))
+		}
+	}
+
+	for step := 0; step < steps && !t.Failed(); step++ {
+		var op string
+		var args []string
+		var apply func()
+		ok := true
+		switch r.Intn(7) {
+		case 0: //issue, sometimes nothing
+			op = "credit_member"
+			seller := propSellers[r.Intn(len(propSellers))]
+			member := propMembers[r.Intn(len(propMembers))]
+			points := r.Intn(200)
+			args = []string{seller, member, strconv.Itoa(points)}
+			ok = points > 0
+			apply = func() {
+				m.mint(seller, member, points, "")
+				m.issued[seller] += points
+			}
+		case 1: //exchange handing lots over, sometimes of a lot the member does not hold or between a member and itself
+			op = "init_bundle_exchange"
+			exTime += int64(r.Intn(36 * 3600 * 1000))
+			b := propBundle{id: "b" + strconv.Itoa(step), userA: m.holder(r), userB: m.holder(r)}
+			for _, giver := range []string{b.userA, b.userB} {
+				for _, id := range m.pick(r, giver, 1+r.Intn(2)) {
+					b.given = append(b.given, Point{Id: id, Owner: giver})
+				}
+			}
+			if len(b.given) == 0 {
+				continue
+			}
+			if r.Intn(10) == 0 {
+				b.given[0].Owner = propMembers[r.Intn(len(propMembers))] //may still be the owner
+			}
+			ok = b.userA != b.userB && m.holds(b.given)
+			args = m.bundleArgs(b, b.userA, b.userB, exTime)
+			apply = func() {
+				m.handBack(b.given, b.userA, b.userB)
+				m.bundles = append(m.bundles, b)
+				m.txs++
+			}
+		case 2: //reverse an accepted bundle, sometimes under its own txID, refused once a lot moved on or was redeemed
+			if len(m.bundles) == 0 {
+				continue
+			}
+			op = "init_bundle_exchange"
+			orig := m.bundles[r.Intn(len(m.bundles))]
+			exTime += int64(r.Intn(36 * 3600 * 1000))
+			rev := propBundle{id: "v" + strconv.Itoa(step), userA: orig.userB, userB: orig.userA}
+			for _, p := range orig.given {
+				receiver := orig.userA
+				if p.Owner == orig.userA {
+					receiver = orig.userB
+				}
+				rev.given = append(rev.given, Point{Id: p.Id, Owner: receiver})
+			}
+			if r.Intn(8) == 0 {
+				rev.id = orig.id
+			}
+			ok = rev.id != orig.id && m.holds(rev.given)
+			args = m.bundleArgs(rev, rev.userA, rev.userB, exTime)
+			apply = func() {
+				m.handBack(rev.given, rev.userA, rev.userB)
+				m.bundles = append(m.bundles, rev)
+				m.txs++
+			}
+		case 3: //transfer, sometimes of more than held, to itself, signed by another member or with a nonce used before
+			op = "transfer_points"
+			seller, from := propSellers[r.Intn(len(propSellers))], m.holder(r)
+			if id := m.pick(r, from, 1); len(id) > 0 {
+				seller = m.lots[id[0]].seller
+			}
+			to := propMembers[r.Intn(len(propMembers))]
+			sender := [2]string{seller, from}
+			held := m.balance(seller, from)
+			points := 1 + r.Intn(held+1)
+			nonce := "n" + strconv.Itoa(step)
+			signer := keys[sender]
+			switch r.Intn(8) {
+			case 0:
+				points = held + 1 + r.Intn(10)
+			case 1:
+				signer = keys[[2]string{seller, propMembers[r.Intn(len(propMembers))]}] //may still be the sender
+			case 2:
+				if used, ok := m.nonces[sender]; ok {
+					nonce = used
+				}
+			}
+			args = []string{seller, from, to, strconv.Itoa(points), nonce}
+			args = append(args, signPayload(signer, TransferPayload(args)))
+			ok = from != to && points <= held && signer == keys[sender] && nonce != m.nonces[sender]
+			apply = func() {
+				m.transfer(seller, from, to, points)
+				m.nonces[sender] = nonce
+			}
+		case 4: //redeem a lot, sometimes one already redeemed
+			op = "delete"
+			id := m.any(r)
+			if id == "" || r.Intn(2) == 0 {
+				continue
+			}
+			lot := m.lots[id]
+			args = []string{id}
+			apply = func() {
+				delete(m.lots, id)
+				m.gone[id] = true
+				m.redeemed[lot.seller] += lot.points
+			}
+			if r.Intn(8) == 0 && len(m.gone) > 0 {
+				for id := range m.gone {
+					args = []string{id} //a deleted key reads as nothing, delete accepts it and moves nothing
+					break
+				}
+				apply = func() {}
+			}
+		case 5: //hand a lot over with set_user, never allowed for a lot with points
+			id := m.any(r)
+			if id == "" {
+				continue
+			}
+			op = "set_user"
+			args = []string{id, propMembers[r.Intn(len(propMembers))]}
+			ok = false
+		case 6: //exchange that moves no lots, sometimes with an amount that must be refused
+			op = "init_transaction"
+			exTime += int64(r.Intn(36 * 3600 * 1000))
+			pointB := strconv.Itoa(r.Intn(1000))
+			if r.Intn(10) == 0 {
+				pointB = "-" + pointB + "1"
+				ok = false
+			}
+			args = []string{"t" + strconv.Itoa(step), propMembers[r.Intn(len(propMembers))], propMembers[r.Intn(len(propMembers))],
+				propSellers[r.Intn(len(propSellers))], propSellers[r.Intn(len(propSellers))], strconv.Itoa(r.Intn(1000)), pointB,
+				strconv.FormatInt(exTime, 10)}
+			apply = func() { m.txs++ }
+		}
+
+		resp, err := s.invoke(op, args...)
+		if ok && err != nil {
+			t.Errorf("step %d: %s %v failed: %v", step, op, args, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("step %d: %s %v should have been refused, got %d", step, op, args, resp.Code)
+		}
+		if ok && apply != nil {
+			apply()
+		}
+		checkInvariants(t, s, m, step)
+	}
+}
+
+// mint adds the next lot of seller, as the chaincode numbers them
+func (m *propModel) mint(seller string, owner string, points int, first string) {
+	m.seq[seller]++
+	m.lots[seller+"-"+strconv.Itoa(m.seq[seller])] = &propLot{seller: seller, owner: owner, points: points, first: first}
+}
+
+// owned returns the lots of owner, of seller or of every seller when it is "", in id order
+func (m *propModel) owned(seller string, owner string) []string {
+	var ids []string
+	for id, lot := range m.lots {
+		if lot.owner == owner && (seller == "" || lot.seller == seller) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (m *propModel) balance(seller string, owner string) int {
+	held := 0
+	for _, id := range m.owned(seller, owner) {
+		held += m.lots[id].points
+	}
+	return held
+}
+
+// pick returns up to n random lots of owner
+func (m *propModel) pick(r *rand.Rand, owner string, n int) []string {
+	ids := m.owned("", owner)
+	r.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+// holder returns the owner of a random live lot, or a random member when there is none
+func (m *propModel) holder(r *rand.Rand) string {
+	if id := m.any(r); id != "" {
+		return m.lots[id].owner
+	}
+	return propMembers[r.Intn(len(propMembers))]
+}
+
+// any returns a random live lot, or "" when there is none
+func (m *propModel) any(r *rand.Rand) string {
+	ids := make([]string, 0, len(m.lots))
+	for id := range m.lots {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	sort.Strings(ids)
+	return ids[r.Intn(len(ids))]
+}
+
+// holds tells whether every lot is live and held by the member said to give it
+func (m *propModel) holds(given []Point) bool {
+	for _, p := range given {
+		if lot, ok := m.lots[p.Id]; !ok || lot.owner != p.Owner {
+			return false
+		}
+	}
+	return true
+}
+
+// handBack gives every lot to the other member of the exchange
+func (m *propModel) handBack(given []Point, userA string, userB string) {
+	for _, p := range given {
+		if p.Owner == userA {
+			m.lots[p.Id].owner = userB
+		} else {
+			m.lots[p.Id].owner = userA
+		}
+	}
+}
+
+// transfer moves points of seller as transfer_points is specified to: whole lots of the sender in id order, the last
+// one split when it is worth more than what is left
+func (m *propModel) transfer(seller string, from string, to string, points int) {
+	for _, id := range m.owned(seller, from) {
+		lot := m.lots[id]
+		if points == 0 {
+			return
+		}
+		if lot.points <= points {
+			lot.owner = to
+			points -= lot.points
+			continue
+		}
+		lot.points -= points
+		m.mint(seller, to, points, from)
+		return
+	}
+}
+
+func (m *propModel) bundleArgs(b propBundle, userA string, userB string, exTime int64) []string {
+	pointA, pointB := 0, 0
+	for _, p := range b.given {
+		if lot, ok := m.lots[p.Id]; ok && p.Owner == userA {
+			pointA += lot.points
+		} else if ok {
+			pointB += lot.points
+		}
+	}
+	related, _ := json.Marshal(b.given)
+	return []string{b.id, userA, userB, "1", "2", strconv.Itoa(pointA), strconv.Itoa(pointB), strconv.FormatInt(exTime, 10), string(related)}
+}
+
+func checkInvariants(t *testing.T, s *mockStub, m *propModel, step int) {
+	//the point index lists every live lot once, and each record is the lot the model expects
+	var index []string
+	json.Unmarshal(s.state[pointIndexStr], &index)
+	supply := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, id := range index {
+		var p Point
+		json.Unmarshal(s.state[id], &p)
+		lot, live := m.lots[id]
+		if seen[id] || !live || p.Id != id || p.Owner != lot.owner || p.Points != lot.points || p.Points <= 0 {
+			t.Errorf("step %d: point %s on the ledger %+v, model %+v, listed before %v", step, id, p, lot, seen[id])
+			continue
+		}
+		seen[id] = true
+		supply[pointSeller(id)] += p.Points
+	}
+	if len(seen) != len(m.lots) {
+		t.Errorf("step %d: %d lots listed, model %d", step, len(seen), len(m.lots))
+	}
+
+	//the points of a seller are what was issued less what was redeemed, whatever moved in between
+	for _, seller := range propSellers {
+		if want := m.issued[seller] - m.redeemed[seller]; supply[seller] != want {
+			t.Errorf("step %d: seller %s has %d points on the ledger, issued %d redeemed %d", step, seller, supply[seller], m.issued[seller], m.redeemed[seller])
+		}
+	}
+
+	//the owner index pairs every live lot with its owner, once
+	listed := make(map[string]int)
+	it, _ := s.GetStateByPartialCompositeKey(ownerIndexStr, nil)
+	for it.HasNext() {
+		kv, _ := it.Next()
+		_, attrs, _ := s.SplitCompositeKey(kv.Key)
+		owner, id := attrs[0], attrs[1]
+		listed[id]++
+		if lot, live := m.lots[id]; !live || lot.owner != owner {
+			t.Errorf("step %d: owner index lists %s under %s, model %+v", step, id, owner, lot)
+		}
+	}
+
+	//the history of a lot is a chain from its first owner to its owner, a redeemed lot's ends with nobody
+	for id := range m.gone {
+		m.lots[id] = &propLot{} //checked like a live lot owned by nobody
+	}
+	for id, lot := range m.lots {
+		if !m.gone[id] && listed[id] != 1 {
+			t.Errorf("step %d: %s listed %d times in the owner index", step, id, listed[id])
+		}
+		var hist PointHistory
+		histKey, _ := s.CreateCompositeKey(pointHistoryStr, []string{id})
+		json.Unmarshal(s.state[histKey], &hist)
+		n := len(hist.History)
+		if n == 0 || hist.History[n-1].NewOwner != lot.owner || (!m.gone[id] && hist.History[0].PrevOwner != lot.first) {
+			t.Errorf("step %d: history of %s %+v, model %+v", step, id, hist.History, lot)
+			continue
+		}
+		for i := 1; i < n; i++ {
+			if hist.History[i].PrevOwner != hist.History[i-1].NewOwner {
+				t.Errorf("step %d: history of %s breaks at %d: %+v", step, id, i, hist.History)
+			}
+		}
+	}
+	for id := range m.gone {
+		delete(m.lots, id)
+	}
+
+	//every member holds what its lots are worth, none has a balance without lots
+	for _, member := range propMembers {
+		for _, seller := range propSellers {
+			resp, _ := s.query("findBalance", seller, member)
+			var bal Balance
+			if resp.Payload != nil {
+				json.Unmarshal(*resp.Payload, &bal)
+			}
+			want := m.owned(seller, member)
+			if bal.Points != m.balance(seller, member) || len(bal.Lots) != len(want) || (len(want) == 0) != (resp.Code == CodeNoRecords) {
+				t.Errorf("step %d: %s holds %+v of seller %s (%d), model %d in %v", step, member, bal, seller, resp.Code, m.balance(seller, member), want)
+			}
+		}
+		var points AllPoint
+		if resp, _ := s.query("findPointWithOwner", member); resp.Payload != nil {
+			json.Unmarshal(*resp.Payload, &points)
+		}
+		if len(points.Points) != len(m.owned("", member)) {
+			t.Errorf("step %d: findPointWithOwner %s lists %d lots, model %d", step, member, len(points.Points), len(m.owned("", member)))
+		}
+	}
+
+	//every accepted exchange is recorded once
+	var all AllTx
+	if resp, _ := s.query("findExchanges"); resp.Payload != nil {
+		json.Unmarshal(*resp.Payload, &all)
+	}
+	if len(all.TXs) != m.txs {
+		t.Fatalf("step %d: %d exchanges recorded, want %d", step, len(all.TXs), m.txs)
+	}
+}
@@ -0,0 +1,169 @@
+package chaincode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/merkle"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var merkleStr = "merkle"         //object type of the composite keys that store the accumulator of each period
+var merkleLeafStr = "merkleleaf" //object type of the keys that store the leaves of a period, in the order they were added
+var merklePosStr = "merklepos"   //object type of the keys that tell where an exchange is in the tree of its period
+
+// receiptPeriod is the period whose tree an exchange goes into, the UTC day of its EX_TIME
+var receiptPeriod = "day"
+
+// PeriodRoot is the tree of the exchanges of one period as it stands
+type PeriodRoot struct {
+	Period string `json:"period"`
+	Size   uint64 `json:"size"`
+	Root   string `json:"root"` //hex
+}
+
+// leafPosition is where an exchange is in the tree of its period
+type leafPosition struct {
+	Period string `json:"period"`
+	Index  uint64 `json:"index"`
+}
+
+// ============================================================================================================================
+// Add Receipt Leaf - append a recorded exchange to the tree of its period
+// ============================================================================================================================
+func addReceiptLeaf(stub shim.ChaincodeStubInterface, id string, exTime int64, record []byte) error {
+	period, err := aggregateBucket(receiptPeriod, exTime)
+	if err != nil {
+		return err
+	}
+	accKey, err := stub.CreateCompositeKey(merkleStr, []string{period})
+	if err != nil {
+		return ParamError(err.Error())
+	}
+	accAsBytes, err := stub.GetState(accKey)
+	if err != nil {
+		return errors.New("Failed to get the tree of " + period)
+	}
+	acc := merkle.Accumulator{}
+	if accAsBytes != nil {
+		json.Unmarshal(accAsBytes, &acc)
+	}
+
+	leaf := merkle.LeafHash(record)
+	leafKey, err := stub.CreateCompositeKey(merkleLeafStr, []string{period, fmt.Sprintf("%020d", acc.Size)})
+	if err != nil {
+		return ParamError(err.Error())
+	}
+	err = stub.PutState(leafKey, []byte(hex.EncodeToString(leaf)))
+	if err != nil {
+		return err
+	}
+	posKey, err := stub.CreateCompositeKey(merklePosStr, []string{id})
+	if err != nil {
+		return ParamError(err.Error())
+	}
+	jsonAsBytes, _ := json.Marshal(leafPosition{Period: period, Index: acc.Size})
+	err = stub.PutState(posKey, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+
+	acc.Add(leaf)
+	jsonAsBytes, _ = json.Marshal(acc)
+	return stub.PutState(accKey, jsonAsBytes)
+}
+
+// periodLeaves - the leaves of the tree of a period, in order
+func periodLeaves(stub shim.ChaincodeStubInterface, period string) ([][]byte, error) {
+	keysIter, err := stub.GetStateByPartialCompositeKey(merkleLeafStr, []string{period})
+	if err != nil {
+		return nil, errors.New("Failed to get the leaves of " + period)
+	}
+	defer keysIter.Close()
+
+	var leaves [][]byte
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get the leaves of " + period)
+		}
+		leaf, err := hex.DecodeString(string(kv.Value))
+		if err != nil {
+			return nil, errors.New("Corrupt leaf " + kv.Key)
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+// ============================================================================================================================
+// Find Receipt - the record of an exchange with its inclusion proof in the tree of its period
+// ============================================================================================================================
+func (t *SimpleChaincode) findReceipt(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0
+	// "txID"
+	id := args[0]
+	posKey, err := stub.CreateCompositeKey(merklePosStr, []string{id})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	posAsBytes, err := stub.GetState(posKey)
+	if err != nil {
+		return nil, errors.New("Failed to get the receipt of " + id)
+	}
+	if posAsBytes == nil {
+		return nil, NotFoundError("No records for " + id)
+	}
+	pos := leafPosition{}
+	json.Unmarshal(posAsBytes, &pos)
+
+	recordKey, _ := stub.CreateCompositeKey(txRecordStr, []string{id})
+	record, err := stub.GetState(recordKey)
+	if err != nil {
+		return nil, errors.New("Failed to get tx " + id)
+	}
+	leaves, err := periodLeaves(stub, pos.Period)
+	if err != nil {
+		return nil, err
+	}
+	if pos.Index >= uint64(len(leaves)) {
+		return nil, errors.New("The tree of " + pos.Period + " misses leaves")
+	}
+
+	receipt := merkle.Receipt{Record: record, Period: pos.Period, Index: pos.Index, Size: uint64(len(leaves)),
+		Leaf: hex.EncodeToString(leaves[pos.Index]), Root: hex.EncodeToString(merkle.Root(leaves)), Proof: []string{}}
+	tx := Transaction{}
+	json.Unmarshal(record, &tx)
+	receipt.Erased = tx.Erased //the leaf is the record before its members were erased
+	for _, p := range merkle.Proof(leaves, int(pos.Index)) {
+		receipt.Proof = append(receipt.Proof, hex.EncodeToString(p))
+	}
+	jsonAsBytes, _ := json.Marshal(receipt)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Find Merkle Root - the root of the tree of a period, for the sellers to compare receipts against
+// ============================================================================================================================
+func (t *SimpleChaincode) findMerkleRoot(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0
+	// "2016-12-04"
+	period := args[0]
+	accKey, err := stub.CreateCompositeKey(merkleStr, []string{period})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	accAsBytes, err := stub.GetState(accKey)
+	if err != nil {
+		return nil, errors.New("Failed to get the tree of " + period)
+	}
+	if accAsBytes == nil {
+		return nil, NotFoundError("No records for " + period)
+	}
+	acc := merkle.Accumulator{}
+	json.Unmarshal(accAsBytes, &acc)
+	jsonAsBytes, _ := json.Marshal(PeriodRoot{Period: period, Size: acc.Size, Root: hex.EncodeToString(acc.Root())})
+	return jsonAsBytes, nil
+}
@@ -0,0 +1,242 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var reconciliationStr = "reconciliation" //object type of the composite keys that store the result of each reconciliation
+
+// SellerRecord is one exchange as a seller's own system has it: its member
+// and its points in the exchange. POINTS and EX_TIME may be sent as JSON
+// numbers or as numeric strings.
+type SellerRecord struct {
+	Id     string      `json:"txID"`
+	User   string      `json:"USER_ID"`
+	Points json.Number `json:"POINTS"`
+	Time   json.Number `json:"EX_TIME"` //ms since epoch
+}
+
+// Mismatch is a field of an exchange the ledger and the seller disagree on
+type Mismatch struct {
+	Id     string `json:"txID"`
+	Field  string `json:"field"` //USER_ID, POINTS or EX_TIME
+	Ledger string `json:"ledger"`
+	Seller string `json:"seller"`
+}
+
+// Reconciliation is the outcome of comparing a seller's records of a period
+// with the ledger. It is kept on the ledger for audit, RECORDS_SHA256 is the
+// hash of the records as submitted so the seller can show which list it sent.
+type Reconciliation struct {
+	Id              string     `json:"id"` //the reconcile transaction
+	Seller          string     `json:"SELLER_ID"`
+	From            string     `json:"START_TIME"`
+	To              string     `json:"END_TIME"`
+	Timestamp       string     `json:"time"`
+	RecordsHash     string     `json:"RECORDS_SHA256"`
+	Submitted       int        `json:"submitted"`
+	Matched         int        `json:"matched"`
+	MissingOnLedger []string   `json:"missing_on_ledger"`
+	MissingAtSeller []string   `json:"missing_at_seller"`
+	Mismatches      []Mismatch `json:"mismatches"`
+}
+
+type AllReconciliation struct {
+	Reconciliations []Reconciliation `json:"reconciliation"`
+}
+
+// ============================================================================================================================
+// Reconcile - diff a seller's records of a period against the ledger and record the result
+// ============================================================================================================================
+func (t *SimpleChaincode) reconcile(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1       2       3
+	// "seller", "from", "to", "[{txID, USER_ID, POINTS, EX_TIME}, ...]"
+	seller, _ := strconv.Atoi(args[0]) //numbers are checked by the registry
+	from, _ := strconv.ParseInt(args[1], 10, 64)
+	to, _ := strconv.ParseInt(args[2], 10, 64)
+	if from > to {
+		return nil, ParamError("START_TIME is after END_TIME")
+	}
+	var records []SellerRecord
+	if err := json.Unmarshal([]byte(args[3]), &records); err != nil {
+		return nil, ParamError("RECORDS must be a list of {txID, USER_ID, POINTS, EX_TIME}: " + err.Error())
+	}
+	seen := make(map[string]bool)
+	for i, rec := range records {
+		if rec.Id == "" {
+			return nil, ParamError(fmt.Sprintf("Record %d has no txID", i))
+		}
+		if seen[rec.Id] {
+			return nil, ParamError("Record " + rec.Id + " is listed twice")
+		}
+		seen[rec.Id] = true
+		if _, err := rec.Points.Int64(); err != nil {
+			return nil, ParamError("POINTS of record " + rec.Id + " is not a whole number")
+		}
+		if _, err := rec.Time.Int64(); err != nil {
+			return nil, ParamError("EX_TIME of record " + rec.Id + " is not a timestamp in ms")
+		}
+	}
+
+	ms, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(args[3]))
+	res := Reconciliation{Id: stub.GetTxID(), Seller: strconv.Itoa(seller), From: args[1], To: args[2], Timestamp: ms,
+		RecordsHash: hex.EncodeToString(sum[:]), Submitted: len(records),
+		MissingOnLedger: []string{}, MissingAtSeller: []string{}, Mismatches: []Mismatch{}}
+
+	txs, err := sellerTxs(stub, seller, from, to)
+	if err != nil {
+		return nil, err
+	}
+	ledger := make(map[string]Transaction)
+	for _, tx := range txs {
+		ledger[tx.Id] = tx
+		if !seen[tx.Id] {
+			res.MissingAtSeller = append(res.MissingAtSeller, tx.Id)
+		}
+	}
+
+	for _, rec := range records {
+		tx, ok := ledger[rec.Id]
+		if !ok { //the seller may date it outside the period, the ledger then disagrees on the time
+			tx, ok, err = sellerTx(stub, res.Seller, rec.Id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !ok {
+			res.MissingOnLedger = append(res.MissingOnLedger, rec.Id)
+			continue
+		}
+		diff := compareRecord(res.Seller, tx, rec)
+		if len(diff) == 0 {
+			res.Matched++
+		}
+		res.Mismatches = append(res.Mismatches, diff...)
+	}
+
+	at, _ := strconv.ParseInt(ms, 10, 64)
+	key, err := stub.CreateCompositeKey(reconciliationStr, []string{res.Seller, fmt.Sprintf("%020d", at), res.Id}) //sorts like time
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	jsonAsBytes, _ := json.Marshal(res)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAsBytes, nil
+}
+
+// sellerTx - the exchange id when seller took part in it
+func sellerTx(stub shim.ChaincodeStubInterface, seller string, id string) (Transaction, bool, error) {
+	tx := Transaction{}
+	recordKey, err := stub.CreateCompositeKey(txRecordStr, []string{id})
+	if err != nil {
+		return tx, false, nil //not an id the ledger could hold
+	}
+	txAsBytes, err := stub.GetState(recordKey)
+	if err != nil {
+		return tx, false, errors.New("Failed to get tx " + id)
+	}
+	if txAsBytes == nil {
+		return tx, false, nil
+	}
+	json.Unmarshal(txAsBytes, &tx)
+	for _, side := range tx.sides() {
+		if sameSeller(side.Seller, seller) {
+			return tx, true, nil
+		}
+	}
+	return tx, false, nil
+}
+
+// sameSeller - seller ids are matched as numbers, like the seller~time~tx index does
+func sameSeller(id string, seller string) bool {
+	return normalSeller(id) == seller
+}
+
+// compareRecord - the fields of the seller's side of tx that rec disagrees on. An exchange
+// between several members of the same seller matches any of their sides.
+func compareRecord(seller string, tx Transaction, rec SellerRecord) []Mismatch {
+	var sides [][2]string
+	for _, side := range tx.sides() {
+		if sameSeller(side.Seller, seller) {
+			sides = append(sides, [2]string{side.User, side.Out})
+		}
+	}
+
+	var best []Mismatch
+	for i, side := range sides {
+		var diff []Mismatch
+		if side[0] != rec.User {
+			diff = append(diff, Mismatch{Id: tx.Id, Field: "USER_ID", Ledger: side[0], Seller: rec.User})
+		}
+		if !sameNumber(side[1], rec.Points) {
+			diff = append(diff, Mismatch{Id: tx.Id, Field: "POINTS", Ledger: side[1], Seller: rec.Points.String()})
+		}
+		if i == 0 || len(diff) < len(best) {
+			best = diff
+		}
+	}
+	if !sameNumber(tx.Timestamp, rec.Time) {
+		best = append(best, Mismatch{Id: tx.Id, Field: "EX_TIME", Ledger: tx.Timestamp, Seller: rec.Time.String()})
+	}
+	return best
+}
+
+func sameNumber(ledger string, seller json.Number) bool {
+	a, errA := strconv.ParseInt(ledger, 10, 64)
+	b, errB := seller.Int64()
+	if errA != nil || errB != nil {
+		return ledger == seller.String()
+	}
+	return a == b
+}
+
+// ============================================================================================================================
+// Find Reconciliations - the recorded reconciliations of a seller, oldest first, or the one with the given id
+// ============================================================================================================================
+func (t *SimpleChaincode) findReconciliations(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", *"id"*
+	seller, _ := strconv.Atoi(args[0]) //checked by the registry
+	id := ""
+	if len(args) == 2 {
+		id = args[1]
+	}
+
+	keysIter, err := stub.GetStateByPartialCompositeKey(reconciliationStr, []string{strconv.Itoa(seller)})
+	if err != nil {
+		return nil, errors.New("Failed to get reconciliations")
+	}
+	defer keysIter.Close()
+
+	var processed AllReconciliation
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get reconciliations")
+		}
+		res := Reconciliation{}
+		json.Unmarshal(kv.Value, &res)
+		if id == "" || res.Id == id {
+			processed.Reconciliations = append(processed.Reconciliations, res)
+		}
+	}
+	if len(processed.Reconciliations) == 0 {
+		return nil, NotFoundError("No records")
+	}
+	jsonAsBytes, _ := json.Marshal(processed)
+	return jsonAsBytes, nil
+}
@@ -0,0 +1,384 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// kinds of chaincode functions
+const (
+	kindInvoke = "invoke"
+	kindQuery  = "query"
+)
+
+// argument types
+const (
+	argString = "string" //non-empty string
+	argInt    = "int"    //numeric string, ms timestamps included
+	argAmount = "amount" //numeric string, zero or more points
+	argTime   = "time"   //numeric string, ms since epoch, not before 1970
+	argJSON   = "json"   //JSON document
+)
+
+var roleAttr = "role"   //cert attribute holding the caller's role
+var roleAdmin = "admin" //may reset and write raw state
+
+// ArgSpec describes one positional argument of a chaincode function
+type ArgSpec struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+type handlerFunc func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error)
+
+// FunctionSpec declares a chaincode function: how it is called, who may call it
+// and which arguments it takes. Optional arguments always come last. Callers
+// may pass the arguments positionally or as one JSON object keyed by name.
+type FunctionSpec struct {
+	Name    string      `json:"name"`
+	Kind    string      `json:"kind"`
+	Role    string      `json:"role,omitempty"`
+	Args    []ArgSpec   `json:"args"`
+	Doc     string      `json:"doc"`
+	handler handlerFunc `json:"-"`
+}
+
+type AllFunction struct {
+	Functions []FunctionSpec `json:"functions"`
+}
+
+var functions []FunctionSpec          //the API catalogue, in declaration order
+var registry map[string]*FunctionSpec //name -> spec
+
+func init() {
+	functions = []FunctionSpec{
+		{Name: "init", Kind: kindInvoke, Role: roleAdmin, Doc: "reset all the things",
+			Args: []ArgSpec{{Name: "abc", Type: argInt}},
+			handler: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+				res, err := t.reset(stub, args)
+				if err != nil {
+					err = InitError(err.Error())
+				}
+				return res, err
+			}},
+		{Name: "delete", Kind: kindInvoke, Role: roleAdmin, Doc: "remove a point, or any key, from state",
+			Args:    []ArgSpec{{Name: "id", Type: argString}},
+			handler: (*SimpleChaincode).Delete},
+		{Name: "write", Kind: kindInvoke, Role: roleAdmin, Doc: "write a raw variable into state",
+			Args:    []ArgSpec{{Name: "name", Type: argString}, {Name: "value", Type: argString}},
+			handler: (*SimpleChaincode).Write},
+		{Name: "init_point", Kind: kindInvoke, Doc: "create a new point",
+			Args:    []ArgSpec{{Name: "id", Type: argString}, {Name: "owner", Type: argString}},
+			handler: (*SimpleChaincode).init_point},
+		{Name: "set_user", Kind: kindInvoke, Doc: "change the owner of a point that carries no points",
+			Args:    []ArgSpec{{Name: "id", Type: argString}, {Name: "owner", Type: argString}},
+			handler: (*SimpleChaincode).set_user},
+		{Name: "init_transaction", Kind: kindInvoke, Doc: "record an exchange between two members of two sellers",
+			Args: []ArgSpec{
+				{Name: "txID", Type: argString},
+				{Name: "USER_A_ID", Type: argString},
+				{Name: "USER_B_ID", Type: argString},
+				{Name: "SELLER_A_ID", Type: argString},
+				{Name: "SELLER_B_ID", Type: argString},
+				{Name: "POINT_A", Type: argAmount},
+				{Name: "POINT_B", Type: argAmount},
+				{Name: "EX_TIME", Type: argTime},
+				{Name: "NONCE", Type: argString, Optional: true},
+				{Name: "SIGNATURE_A", Type: argString, Optional: true},
+				{Name: "SIGNATURE_B", Type: argString, Optional: true},
+			},
+			handler: (*SimpleChaincode).init_transaction},
+		{Name: "init_bundle_exchange", Kind: kindInvoke, Doc: "record an exchange that also hands point lots over, each to the other member",
+			Args: []ArgSpec{
+				{Name: "txID", Type: argString},
+				{Name: "USER_A_ID", Type: argString},
+				{Name: "USER_B_ID", Type: argString},
+				{Name: "SELLER_A_ID", Type: argString},
+				{Name: "SELLER_B_ID", Type: argString},
+				{Name: "POINT_A", Type: argAmount},
+				{Name: "POINT_B", Type: argAmount},
+				{Name: "EX_TIME", Type: argTime},
+				{Name: "RELATED", Type: argJSON},
+				{Name: "NONCE", Type: argString, Optional: true},
+				{Name: "SIGNATURE_A", Type: argString, Optional: true},
+				{Name: "SIGNATURE_B", Type: argString, Optional: true},
+			},
+			handler: (*SimpleChaincode).init_bundle_exchange},
+		{Name: "init_ring_exchange", Kind: kindInvoke, Doc: "record an exchange between the members of several sellers, each leg giving its points to the next",
+			Args: []ArgSpec{
+				{Name: "txID", Type: argString},
+				{Name: "EX_TIME", Type: argTime},
+				{Name: "LEGS", Type: argJSON},
+				{Name: "NONCE", Type: argString, Optional: true},
+				{Name: "SIGNATURES", Type: argJSON, Optional: true},
+			},
+			handler: (*SimpleChaincode).init_ring_exchange},
+		{Name: "register_seller_key", Kind: kindInvoke, Role: roleAdmin, Doc: "set the ECDSA public key a seller signs its exchanges with",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argString}, {Name: "PUBLIC_KEY", Type: argString}},
+			handler: (*SimpleChaincode).register_seller_key},
+		{Name: "set_seller_policy", Kind: kindInvoke, Role: roleAdmin, Doc: "change how the chaincode treats the records of a seller",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argString}, {Name: "POLICY", Type: argJSON}},
+			handler: (*SimpleChaincode).set_seller_policy},
+		{Name: "reconcile", Kind: kindInvoke, Doc: "diff a seller's records of a period against the ledger and record the result",
+			Args: []ArgSpec{
+				{Name: "SELLER_ID", Type: argInt},
+				{Name: "START_TIME", Type: argTime},
+				{Name: "END_TIME", Type: argTime},
+				{Name: "RECORDS", Type: argJSON},
+			},
+			handler: (*SimpleChaincode).reconcile},
+		{Name: "erase_member", Kind: kindInvoke, Role: roleAdmin, Doc: "replace a member of a seller with an erased token in its exchanges, points, reconciliations, transfers and balance, and drop its key",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "USER_ID", Type: argString}},
+			handler: (*SimpleChaincode).erase_member},
+		{Name: "credit_member", Kind: kindInvoke, Role: roleAdmin, Doc: "issue points of a seller to one of its members as a new lot",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "USER_ID", Type: argString}, {Name: "POINTS", Type: argAmount}},
+			handler: (*SimpleChaincode).credit_member},
+		{Name: "register_member_key", Kind: kindInvoke, Role: roleAdmin, Doc: "set the ECDSA public key a member signs its transfers with, a new key must be signed by the old one",
+			Args: []ArgSpec{
+				{Name: "SELLER_ID", Type: argInt},
+				{Name: "USER_ID", Type: argString},
+				{Name: "PUBLIC_KEY", Type: argString},
+				{Name: "SIGNATURE", Type: argString, Optional: true},
+			},
+			handler: (*SimpleChaincode).register_member_key},
+		{Name: "transfer_points", Kind: kindInvoke, Doc: "move points of a seller from one of its members to another, signed by the sending member",
+			Args: []ArgSpec{
+				{Name: "SELLER_ID", Type: argInt},
+				{Name: "FROM_ID", Type: argString},
+				{Name: "TO_ID", Type: argString},
+				{Name: "POINTS", Type: argAmount},
+				{Name: "NONCE", Type: argString},
+				{Name: "SIGNATURE", Type: argString},
+			},
+			handler: (*SimpleChaincode).transfer_points},
+		{Name: "test", Kind: kindInvoke, Role: roleAdmin, Doc: "debug function, does nothing",
+			Args:    []ArgSpec{{Name: "name", Type: argString}, {Name: "value", Type: argString}},
+			handler: (*SimpleChaincode).test},
+
+		{Name: "read", Kind: kindQuery, Doc: "read a raw variable from state",
+			Args:    []ArgSpec{{Name: "key", Type: argString}},
+			handler: (*SimpleChaincode).read},
+		{Name: "findExchanges", Kind: kindQuery, Doc: "every exchange on the ledger, oldest first",
+			handler: (*SimpleChaincode).findExchanges},
+		{Name: "findLatest", Kind: kindQuery, Doc: "the last exchanges of a seller",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "RECORD_NUM", Type: argInt}},
+			handler: (*SimpleChaincode).findLatest},
+		{Name: "findRange", Kind: kindQuery, Doc: "the exchanges of a seller between two timestamps (ms)",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "START_TIME", Type: argTime}, {Name: "END_TIME", Type: argTime}},
+			handler: (*SimpleChaincode).findRange},
+		{Name: "findAggregate", Kind: kindQuery, Doc: "exchange totals of a seller per day, week or month",
+			Args: []ArgSpec{
+				{Name: "SELLER_ID", Type: argString},
+				{Name: "PERIOD", Type: argString},
+				{Name: "START_TIME", Type: argTime},
+				{Name: "END_TIME", Type: argTime},
+				{Name: "PARTNER_ID", Type: argString, Optional: true},
+			},
+			handler: (*SimpleChaincode).findAggregate},
+		{Name: "findUserEx", Kind: kindQuery, Doc: "the exchanges of a member of a seller, by the id or pseudonym the ledger holds",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "USER_ID", Type: argString}},
+			handler: (*SimpleChaincode).findUserEx},
+		{Name: "findPointHistory", Kind: kindQuery, Doc: "ownership history of a point",
+			Args:    []ArgSpec{{Name: "id", Type: argString}},
+			handler: (*SimpleChaincode).findPointHistory},
+		{Name: "findPointWithOwner", Kind: kindQuery, Doc: "all points held by an owner",
+			Args:    []ArgSpec{{Name: "owner", Type: argString}},
+			handler: (*SimpleChaincode).findPointWithOwner},
+		{Name: "findReconciliations", Kind: kindQuery, Doc: "the recorded reconciliations of a seller, or one of them",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "id", Type: argString, Optional: true}},
+			handler: (*SimpleChaincode).findReconciliations},
+		{Name: "findErasures", Kind: kindQuery, Doc: "the erasures of the members of a seller, or one of them",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "id", Type: argString, Optional: true}},
+			handler: (*SimpleChaincode).findErasures},
+		{Name: "findBalance", Kind: kindQuery, Doc: "what a member holds of the points of its seller, summed over its lots",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "USER_ID", Type: argString}},
+			handler: (*SimpleChaincode).findBalance},
+		{Name: "findTransfers", Kind: kindQuery, Doc: "the transfers between the members of a seller, or those of one member",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "USER_ID", Type: argString, Optional: true}},
+			handler: (*SimpleChaincode).findTransfers},
+		{Name: "findReceipt", Kind: kindQuery, Doc: "an exchange with its Merkle inclusion proof in the tree of its day",
+			Args:    []ArgSpec{{Name: "txID", Type: argString}},
+			handler: (*SimpleChaincode).findReceipt},
+		{Name: "findMerkleRoot", Kind: kindQuery, Doc: "the Merkle root of the exchanges of a day (UTC, 2006-01-02)",
+			Args:    []ArgSpec{{Name: "PERIOD", Type: argString}},
+			handler: (*SimpleChaincode).findMerkleRoot},
+		{Name: "findSellerKey", Kind: kindQuery, Doc: "the public key a seller signs its exchanges with",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argString}},
+			handler: (*SimpleChaincode).findSellerKey},
+		{Name: "findMemberKey", Kind: kindQuery, Doc: "the public key a member signs its transfers with",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argInt}, {Name: "USER_ID", Type: argString}},
+			handler: (*SimpleChaincode).findMemberKey},
+		{Name: "findSellerPolicy", Kind: kindQuery, Doc: "how the chaincode treats the records of a seller",
+			Args:    []ArgSpec{{Name: "SELLER_ID", Type: argString}},
+			handler: (*SimpleChaincode).findSellerPolicy},
+		{Name: "describe", Kind: kindQuery, Doc: "this catalogue",
+			Args:    []ArgSpec{},
+			handler: (*SimpleChaincode).describe},
+	}
+
+	registry = make(map[string]*FunctionSpec)
+	for i := range functions {
+		registry[functions[i].Name] = &functions[i]
+	}
+}
+
+// ============================================================================================================================
+// Dispatch - check the arguments and the caller's role, then run the function
+// ============================================================================================================================
+func (t *SimpleChaincode) dispatch(stub shim.ChaincodeStubInterface, spec *FunctionSpec, args []string) ([]byte, error) {
+	args, err := spec.parseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	err = spec.checkRole(stub)
+	if err != nil {
+		return nil, err
+	}
+	return spec.handler(t, stub, args)
+}
+
+// ============================================================================================================================
+// Parse Args - accept the positional form or a single JSON object with named fields, e.g. {"txID":..,"USER_A_ID":..}
+// and return the validated positional arguments
+// ============================================================================================================================
+func (spec *FunctionSpec) parseArgs(args []string) ([]string, error) {
+	if len(args) == 1 && strings.HasPrefix(strings.TrimSpace(args[0]), "{") &&
+		!(len(spec.Args) == 1 && spec.Args[0].Type == argJSON) { //a lone JSON argument stays positional
+		named, err := spec.namedArgs(args[0])
+		if err != nil {
+			return nil, err
+		}
+		args = named
+	}
+	return args, spec.validate(args)
+}
+
+// ============================================================================================================================
+// Named Args - turn a JSON object argument into positional arguments in declaration order
+// ============================================================================================================================
+func (spec *FunctionSpec) namedArgs(obj string) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(obj), &fields); err != nil {
+		return nil, ParamError("Argument object of " + spec.Name + " is not valid JSON")
+	}
+
+	known := make(map[string]bool)
+	for _, a := range spec.Args {
+		known[a.Name] = true
+	}
+	for name := range fields {
+		if !known[name] {
+			return nil, ParamError("Unknown argument " + name + " for " + spec.Name)
+		}
+	}
+
+	args := make([]string, len(spec.Args))
+	last := 0
+	for i, a := range spec.Args {
+		raw, ok := fields[a.Name]
+		if !ok || string(raw) == "null" {
+			if !a.Optional {
+				return nil, ParamError("Missing argument " + a.Name + " for " + spec.Name)
+			}
+			continue
+		}
+		var str string
+		if json.Unmarshal(raw, &str) == nil {
+			args[i] = str
+		} else {
+			args[i] = string(raw) //numbers, or JSON documents for json arguments
+		}
+		last = i + 1
+	}
+	return args[:last], nil //trailing optionals left out, like the positional form
+}
+
+// ============================================================================================================================
+// Validate - check the positional arguments against the declared schema
+// ============================================================================================================================
+func (spec *FunctionSpec) validate(args []string) error {
+	required := 0
+	for _, a := range spec.Args {
+		if !a.Optional {
+			required++
+		}
+	}
+	if len(args) < required || len(args) > len(spec.Args) {
+		if required == len(spec.Args) {
+			return ParamError("Incorrect number of arguments. Expecting " + strconv.Itoa(required))
+		}
+		return ParamError("Incorrect number of arguments. Expecting " + strconv.Itoa(required) + " to " + strconv.Itoa(len(spec.Args)))
+	}
+
+	for i, val := range args {
+		a := spec.Args[i]
+		if a.Optional && len(val) == 0 {
+			continue
+		}
+		switch a.Type {
+		case argString:
+			if len(val) == 0 {
+				return ParamError(ordinal(i+1) + " argument " + a.Name + " must be a non-empty string")
+			}
+		case argInt:
+			if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+				return ParamError(ordinal(i+1) + " argument " + a.Name + " must be a numeric string")
+			}
+		case argAmount:
+			if n, err := strconv.Atoi(val); err != nil || n < 0 {
+				return ParamError(ordinal(i+1) + " argument " + a.Name + " must be a non-negative numeric string")
+			}
+		case argTime:
+			if n, err := strconv.ParseInt(val, 10, 64); err != nil || n < 0 {
+				return ParamError(ordinal(i+1) + " argument " + a.Name + " must be a non-negative ms timestamp")
+			}
+		case argJSON:
+			var v interface{}
+			if json.Unmarshal([]byte(val), &v) != nil {
+				return ParamError(ordinal(i+1) + " argument " + a.Name + " must be a JSON document")
+			}
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Check Role - the caller's role cert attribute must match the role the function requires
+// ============================================================================================================================
+func (spec *FunctionSpec) checkRole(stub shim.ChaincodeStubInterface) error {
+	if len(spec.Role) == 0 {
+		return nil
+	}
+	role, found, err := cid.GetAttributeValue(stub, roleAttr) //fabric-ca attribute of the creator's cert
+	if err != nil || !found || role != spec.Role {
+		return PermissionError(spec.Name + " requires the " + spec.Role + " role")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Describe - the full API catalogue, for client generation
+// ============================================================================================================================
+func (t *SimpleChaincode) describe(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	jsonAsBytes, _ := json.Marshal(AllFunction{Functions: functions})
+	return jsonAsBytes, nil
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
@@ -0,0 +1,114 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// CCPX response codes, see "etc for ref/Reponse_code"
+const (
+	CodeRecorded            = 100 //record successfully
+	CodeNoPermissionRecord  = 200 //have no permission to record
+	CodeValidationFailed    = 201 //validation between nodes fails
+	CodeEnquiryOK           = 300 //enquiry successfully
+	CodeNoPermissionEnquiry = 400 //have no permission to enquiry
+	CodeNoRecords           = 401 //no records
+	CodeParamError          = 500 //parameter error
+	CodeConflict            = 501 //conflicts between requests
+	CodeLedgerError         = 502 //the ledger could not be read or written
+	CodeInitError           = 600 //init error
+)
+
+// Response is the envelope every chaincode function answers with. The field
+// names are the ones the webservice has always sent to the sellers.
+type Response struct {
+	Code    int              `json:"respond"`
+	Message string           `json:"msg"`
+	Payload *json.RawMessage `json:"content"`
+}
+
+// The error types below decide the code of a failed call. Any other error is a
+// ledger failure, a GetState or PutState that did not go through, and answers
+// CodeLedgerError.
+
+// ParamError - the arguments of the call are wrong
+type ParamError string
+
+func (e ParamError) Error() string { return string(e) }
+
+// ConflictError - the call clashes with what is already on the ledger
+type ConflictError string
+
+func (e ConflictError) Error() string { return string(e) }
+
+// NotFoundError - there is nothing on the ledger for this request
+type NotFoundError string
+
+func (e NotFoundError) Error() string { return string(e) }
+
+// PermissionError - the caller may not make this call
+type PermissionError string
+
+func (e PermissionError) Error() string { return string(e) }
+
+// InitError - the chaincode state could not be (re)initialised
+type InitError string
+
+func (e InitError) Error() string { return string(e) }
+
+// ============================================================================================================================
+// Error Code - map an error to its CCPX response code, query tells which 2xx/4xx family applies
+// ============================================================================================================================
+func errorCode(err error, query bool) int {
+	switch err.(type) {
+	case ParamError:
+		return CodeParamError
+	case ConflictError:
+		return CodeConflict
+	case NotFoundError:
+		return CodeNoRecords
+	case PermissionError:
+		if query {
+			return CodeNoPermissionEnquiry
+		}
+		return CodeNoPermissionRecord
+	case InitError:
+		return CodeInitError
+	}
+	return CodeLedgerError
+}
+
+// ============================================================================================================================
+// Respond - wrap the result of a chaincode function into a Response envelope
+// Queries always answer with the envelope so clients can read the code. Failed invocations must still answer with an
+// error status so the peer endorses nothing; the message and the payload then both carry the envelope.
+// ============================================================================================================================
+func respond(res []byte, err error, query bool) pb.Response {
+	resp := Response{Code: CodeRecorded, Message: "record successfully"}
+	if query {
+		resp.Code = CodeEnquiryOK
+		resp.Message = "enquiry successfully"
+	}
+	if err != nil {
+		resp.Code = errorCode(err, query)
+		resp.Message = err.Error()
+		res = nil
+	}
+
+	if res != nil {
+		var v interface{}
+		if json.Unmarshal(res, &v) != nil { //raw state that is not JSON goes out as a JSON string
+			res, _ = json.Marshal(string(res))
+		}
+		payload := json.RawMessage(res)
+		resp.Payload = &payload
+	}
+
+	jsonAsBytes, _ := json.Marshal(&resp)
+	if err != nil && !query {
+		return pb.Response{Status: shim.ERROR, Message: string(jsonAsBytes), Payload: jsonAsBytes}
+	}
+	return shim.Success(jsonAsBytes)
+}
@@ -0,0 +1,179 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// ringPayloadVersion heads the payload the sellers of a ring exchange sign, so
+// that it never verifies as the payload of a two-party exchange
+var ringPayloadVersion = "ccpx-ring-v1"
+
+// Leg is one member of a ring exchange: User of Seller gives POINT_OUT of
+// Seller's points to the next leg and receives POINT_IN, what the previous leg
+// gives. The last leg gives to the first.
+type Leg struct {
+	User   string `json:"USER_ID"`
+	Seller string `json:"SELLER_ID"`
+	In     string `json:"POINT_IN"`
+	Out    string `json:"POINT_OUT"`
+}
+
+// ringLeg is a leg as init_ring_exchange takes it, amounts as JSON numbers or numeric strings
+type ringLeg struct {
+	User   string      `json:"USER_ID"`
+	Seller string      `json:"SELLER_ID"`
+	In     json.Number `json:"POINT_IN"`
+	Out    json.Number `json:"POINT_OUT"`
+}
+
+// RingPayload is what the sellers of a ring exchange sign: the arguments of
+// init_ring_exchange from txID to NONCE exactly as they are passed, one per
+// line after a version line. The signature is ASN.1 ECDSA over its SHA-256.
+func RingPayload(args []string) []byte {
+	return []byte(ringPayloadVersion + "\n" + strings.Join(args, "\n"))
+}
+
+// sides - the members of an exchange as legs, a two-party exchange is a ring of two
+func (tx Transaction) sides() []Leg {
+	if len(tx.Legs) > 0 {
+		return tx.Legs
+	}
+	return []Leg{{User: tx.TraderA, Seller: tx.SellerA, In: tx.PointB, Out: tx.PointA},
+		{User: tx.TraderB, Seller: tx.SellerB, In: tx.PointA, Out: tx.PointB}}
+}
+
+// ============================================================================================================================
+// Init Ring Exchange - record an exchange between the members of N sellers, each giving its points to the next one.
+// POINT_IN of a leg must be what the leg before gives. The ring is listed in findLatest/findRange of every seller on
+// it, with its legs under "legs" and the A and B fields empty; the sellers with a key sign it as a whole, their
+// signatures keyed by seller.
+// ============================================================================================================================
+func (t *SimpleChaincode) init_ring_exchange(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0        1          2                                                        3          4
+	// "txID", "EX_TIME", "[{USER_ID, SELLER_ID, POINT_IN, POINT_OUT}, ...]", *"NONCE"*, *"{"SELLER_ID":"SIGNATURE"}"*
+	exTime, _ := strconv.ParseInt(args[1], 10, 64) //checked by the registry
+	legs, err := parseLegs(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := ""
+	if len(args) > 3 {
+		nonce = args[3]
+	}
+	signatures := map[string]string{}
+	if len(args) > 4 {
+		var given map[string]string
+		if err := json.Unmarshal([]byte(args[4]), &given); err != nil {
+			return nil, ParamError("SIGNATURES must be a JSON object of signatures by seller")
+		}
+		for seller, sig := range given {
+			signatures[normalSeller(seller)] = sig
+		}
+	}
+	var sides []signedSide
+	var members [][2]string
+	for _, leg := range legs {
+		sides = append(sides, signedSide{leg.Seller, signatures[normalSeller(leg.Seller)], "the signature of seller " + leg.Seller})
+		members = append(members, [2]string{leg.Seller, leg.User})
+	}
+	err = checkSignatures(stub, args[0], RingPayload([]string{args[0], args[1], args[2], nonce}), nonce, sides)
+	if err != nil {
+		return nil, err
+	}
+	err = checkPseudonyms(stub, members...)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := Transaction{Id: args[0], Timestamp: args[1], Legs: legs}
+	recordKey, err := stub.CreateCompositeKey(txRecordStr, []string{ring.Id})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	recAsBytes, err := stub.GetState(recordKey)
+	if err != nil {
+		return nil, errors.New("Failed to get tx " + ring.Id)
+	}
+	if recAsBytes != nil {
+		return nil, ConflictError("This transaction already exists")
+	}
+	jsonAsBytes, _ := json.Marshal(ring)
+	err = stub.PutState(recordKey, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = addReceiptLeaf(stub, ring.Id, exTime, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, leg := range legs {
+		indexKey, err := sellerTxKey(stub, leg.Seller, exTime, ring.Id)
+		if err != nil {
+			return nil, ParamError(err.Error())
+		}
+		err = stub.PutState(indexKey, []byte{0x00}) //a seller on several legs is indexed once
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//what a leg gives counts against the seller of the next leg, what it receives against the seller of the one before
+	var aggSides []aggregateSide
+	for i, leg := range legs {
+		next, prev := legs[(i+1)%len(legs)], legs[(i+len(legs)-1)%len(legs)]
+		out, _ := strconv.Atoi(leg.Out)
+		in, _ := strconv.Atoi(leg.In)
+		shares := []partnerShare{{partner: next.Seller, out: out}, {partner: prev.Seller, in: in}}
+		aggSides = append(aggSides, aggregateSide{leg.Seller, leg.User, shares})
+	}
+	err = addAggregates(stub, aggSides, exTime) //a seller on several legs counts the ring once
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// parseLegs - the legs of a ring, each receiving what the previous one gives
+func parseLegs(v string) ([]Leg, error) {
+	var given []ringLeg
+	dec := json.NewDecoder(strings.NewReader(v))
+	dec.UseNumber()
+	if err := dec.Decode(&given); err != nil {
+		return nil, ParamError("LEGS must be a list of {USER_ID, SELLER_ID, POINT_IN, POINT_OUT}: " + err.Error())
+	}
+	if len(given) < 2 {
+		return nil, ParamError("A ring exchange needs at least two legs")
+	}
+	legs := make([]Leg, len(given))
+	seen := make(map[[2]string]bool)
+	for i, g := range given {
+		if g.User == "" || g.Seller == "" {
+			return nil, ParamError(fmt.Sprintf("Leg %d needs a USER_ID and a SELLER_ID", i+1))
+		}
+		member := [2]string{normalSeller(g.Seller), g.User}
+		if seen[member] {
+			return nil, ParamError("Member " + g.User + " of seller " + g.Seller + " is on two legs")
+		}
+		seen[member] = true
+		in, errIn := strconv.Atoi(g.In.String())
+		out, errOut := strconv.Atoi(g.Out.String())
+		if errIn != nil || errOut != nil || in < 0 || out < 0 {
+			return nil, ParamError(fmt.Sprintf("The points of leg %d must be non-negative numbers", i+1))
+		}
+		legs[i] = Leg{User: g.User, Seller: g.Seller, In: strconv.Itoa(in), Out: strconv.Itoa(out)}
+	}
+	for i, leg := range legs {
+		prev := legs[(i+len(legs)-1)%len(legs)]
+		if leg.In != prev.Out {
+			return nil, ParamError(fmt.Sprintf("Leg %d receives %s points but the leg before gives %s", i+1, leg.In, prev.Out))
+		}
+	}
+	return legs, nil
+}
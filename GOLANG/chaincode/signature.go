@@ -0,0 +1,210 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Seller keys and used nonces are not derived state, Init keeps them so that a
+// reset does not let old signed exchanges be replayed.
+var sellerKeyStr = "sellerkey"     //object type of the composite keys that store the public key of each seller
+var sellerNonceStr = "sellernonce" //object type of the keys that remember the nonces a seller signed
+
+// exchangePayloadVersion heads the payload the sellers sign, so that a signature
+// never verifies for anything but an exchange of this format
+var exchangePayloadVersion = "ccpx-exchange-v1"
+
+// SellerKey is the ECDSA public key a seller signs its exchanges with
+type SellerKey struct {
+	Seller    string `json:"SELLER_ID"`
+	PublicKey string `json:"PUBLIC_KEY"` //PEM, PKIX
+	TxID      string `json:"txID"`       //registration
+	Timestamp string `json:"time"`
+}
+
+// ExchangePayload is what the sellers of an exchange sign: the arguments of
+// init_transaction from txID to NONCE exactly as they are passed, one per line
+// after a version line. The signature is ASN.1 ECDSA over its SHA-256.
+func ExchangePayload(args []string) []byte {
+	return []byte(exchangePayloadVersion + "\n" + strings.Join(args, "\n"))
+}
+
+// ============================================================================================================================
+// Register Seller Key - set or replace the public key a seller signs its exchanges with
+// ============================================================================================================================
+func (t *SimpleChaincode) register_seller_key(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0           1
+	// "seller", "-----BEGIN PUBLIC KEY-----..." or base64 DER
+	seller := normalSeller(args[0])
+	pub, err := parsePublicKey(args[1])
+	if err != nil {
+		return nil, err
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+
+	ms, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	key, err := stub.CreateCompositeKey(sellerKeyStr, []string{seller})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	sk := SellerKey{Seller: seller, PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		TxID: stub.GetTxID(), Timestamp: ms}
+	jsonAsBytes, _ := json.Marshal(sk)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAsBytes, nil
+}
+
+func parsePublicKey(v string) (*ecdsa.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(v)); block != nil {
+		der = block.Bytes
+	} else if b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v)); err == nil {
+		der = b
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, ParamError("PUBLIC_KEY must be a PEM or base64 PKIX public key")
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ParamError("PUBLIC_KEY must be an ECDSA key")
+	}
+	return pub, nil
+}
+
+// normalSeller - seller ids are matched as numbers, like the seller~time~tx index does
+func normalSeller(seller string) string {
+	if n, err := strconv.Atoi(seller); err == nil {
+		return strconv.Itoa(n)
+	}
+	return seller
+}
+
+// sellerKey - the registered key of a seller, nil when it has none
+func sellerKey(stub shim.ChaincodeStubInterface, seller string) (*SellerKey, error) {
+	key, err := stub.CreateCompositeKey(sellerKeyStr, []string{normalSeller(seller)})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	skAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get the key of seller " + seller)
+	}
+	if skAsBytes == nil {
+		return nil, nil
+	}
+	sk := SellerKey{}
+	json.Unmarshal(skAsBytes, &sk)
+	return &sk, nil
+}
+
+// ============================================================================================================================
+// Check Exchange Signatures - every seller of an exchange that registered a key must have signed it, with a nonce it
+// never used before. Sellers without a key are not checked, so that they can move over one at a time.
+// ============================================================================================================================
+func checkExchangeSignatures(stub shim.ChaincodeStubInterface, args []string) error {
+	//	0        1          2          3            4            5          6          7         8        9              10
+	//["txID", "USER_A_ID", "USER_B_ID", "SELLER_A_ID", "SELLER_B_ID", "POINT_A", "POINT_B", "EX_TIME", *"NONCE"*, *"SIGNATURE_A"*, *"SIGNATURE_B"*]
+	opt := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	nonce := opt(8)
+	payload := ExchangePayload(append(append([]string{}, args[:8]...), nonce))
+	return checkSignatures(stub, args[0], payload, nonce, []signedSide{{args[3], opt(9), "SIGNATURE_A"}, {args[4], opt(10), "SIGNATURE_B"}})
+}
+
+// signedSide is a seller of an exchange with the signature it gave, name is the argument that holds it
+type signedSide struct{ seller, sig, name string }
+
+// checkSignatures - every side whose seller registered a key must have signed payload, and the signing sellers
+// must not have used nonce before. A seller on several sides signs once.
+func checkSignatures(stub shim.ChaincodeStubInterface, id string, payload []byte, nonce string, sides []signedSide) error {
+	digest := sha256.Sum256(payload)
+	var unique []signedSide
+	at := make(map[string]int)
+	for _, side := range sides {
+		if i, ok := at[normalSeller(side.seller)]; ok {
+			if unique[i].sig == "" {
+				unique[i].sig = side.sig
+			}
+			continue
+		}
+		at[normalSeller(side.seller)] = len(unique)
+		unique = append(unique, side)
+	}
+	for _, side := range unique {
+		sk, err := sellerKey(stub, side.seller)
+		if err != nil {
+			return err
+		}
+		if sk == nil {
+			continue
+		}
+		if side.sig == "" {
+			return PermissionError("Seller " + side.seller + " signs its exchanges, " + side.name + " is missing")
+		}
+		if nonce == "" {
+			return ParamError("NONCE is required with signed exchanges")
+		}
+		pub, err := parsePublicKey(sk.PublicKey)
+		if err != nil {
+			return err
+		}
+		sig, err := base64.StdEncoding.DecodeString(side.sig)
+		if err != nil || !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return PermissionError(side.name + " is not the signature of seller " + side.seller)
+		}
+
+		nonceKey, err := stub.CreateCompositeKey(sellerNonceStr, []string{sk.Seller, nonce})
+		if err != nil {
+			return ParamError(err.Error())
+		}
+		used, err := stub.GetState(nonceKey)
+		if err != nil {
+			return errors.New("Failed to get nonce " + nonce)
+		}
+		if used != nil {
+			return ConflictError("Seller " + side.seller + " already used nonce " + nonce)
+		}
+		err = stub.PutState(nonceKey, []byte(id))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Find Seller Key - the public key a seller signs its exchanges with
+// ============================================================================================================================
+func (t *SimpleChaincode) findSellerKey(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0
+	// "seller"
+	sk, err := sellerKey(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if sk == nil {
+		return nil, NotFoundError("No key for seller " + args[0])
+	}
+	jsonAsBytes, _ := json.Marshal(sk)
+	return jsonAsBytes, nil
+}
@@ -0,0 +1,529 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Transfers, member keys and the nonces members signed are not derived from
+// the exchanges, Init keeps them.
+//
+// A balance is not stored, it is what the points a member owns are worth: the
+// lots of the seller, the points whose id starts with it, that carry points.
+// credit_member issues such a lot and delete redeems one; transfer_points and
+// bundle exchanges hand them over with their history, and set_user refuses
+// them. So findBalance, findPointWithOwner and findPointHistory always agree.
+// init_transaction and ring exchanges only record what the sellers settled
+// themselves, they move no lots and leave the balances as they are.
+//
+// A seller opts in to transfers with its policy, which may cap them. The
+// sending member authorises each transfer with its own ECDSA key, registered
+// by the admin and then only replaced with a signature of the old key, so the
+// admin can issue and redeem points but cannot move a member's. A nonce is
+// good for one transfer of a member. Transfers are not exchanges: they are
+// not in findLatest/findRange, the aggregates or the Merkle trees.
+var transferStr = "transfer"       //object type of the composite keys that store each transfer, by seller and time
+var memberKeyStr = "memberkey"     //object type of the composite keys that store the public key of a member of a seller
+var memberNonceStr = "membernonce" //object type of the keys that remember the nonces a member signed
+
+// transferPayloadVersion heads the payload a member signs for a transfer, so
+// that it never verifies as the payload of an exchange
+var transferPayloadVersion = "ccpx-transfer-v1"
+
+// memberKeyPayloadVersion heads the payload a member signs with its old key to
+// have a new one registered
+var memberKeyPayloadVersion = "ccpx-member-key-v1"
+
+// Balance is what a member holds of the points of its seller, and the lots
+// that make it up
+type Balance struct {
+	Seller string   `json:"SELLER_ID"`
+	User   string   `json:"USER_ID"`
+	Points int      `json:"POINTS"`
+	Lots   []string `json:"lots"`
+}
+
+// Transfer is the record of points of one seller moved from a member to
+// another. Transfers are kept apart from the exchanges: they are not in the
+// exchange lists, the aggregates or the Merkle trees.
+type Transfer struct {
+	Id        string   `json:"id"` //the transfer_points transaction
+	Seller    string   `json:"SELLER_ID"`
+	From      string   `json:"FROM_ID"`
+	To        string   `json:"TO_ID"`
+	Points    int      `json:"POINTS"`
+	Nonce     string   `json:"nonce"`
+	Lots      []string `json:"lots"` //the lots the receiver got, the last one split off a larger lot when it had to
+	Timestamp string   `json:"time"`
+	Erased    string   `json:"erased,omitempty"` //the erase_member transaction that replaced a member
+}
+
+type AllTransfer struct {
+	Transfers []Transfer `json:"transfer"`
+}
+
+// MemberKey is the ECDSA public key a member signs its transfers with. The
+// member holds the private key, the seller only has the public key registered.
+type MemberKey struct {
+	Seller    string `json:"SELLER_ID"`
+	User      string `json:"USER_ID"`
+	PublicKey string `json:"PUBLIC_KEY"` //PEM, PKIX
+	TxID      string `json:"txID"`       //registration
+	Timestamp string `json:"time"`
+}
+
+// TransferPayload is what the sending member signs to authorise a transfer:
+// the arguments of transfer_points from SELLER_ID to NONCE exactly as they are
+// passed, one per line after a version line. The signature is ASN.1 ECDSA over
+// its SHA-256.
+func TransferPayload(args []string) []byte {
+	return []byte(transferPayloadVersion + "\n" + strings.Join(args, "\n"))
+}
+
+// MemberKeyPayload is what a member signs with the key it has to replace it:
+// the arguments of register_member_key from SELLER_ID to PUBLIC_KEY exactly as
+// they are passed, one per line after a version line.
+func MemberKeyPayload(args []string) []byte {
+	return []byte(memberKeyPayloadVersion + "\n" + strings.Join(args, "\n"))
+}
+
+// memberKey - the registered key of a member of a seller, nil when it has none
+func memberKey(stub shim.ChaincodeStubInterface, seller string, user string) (*MemberKey, string, error) {
+	key, err := stub.CreateCompositeKey(memberKeyStr, []string{normalSeller(seller), user})
+	if err != nil {
+		return nil, "", ParamError(err.Error())
+	}
+	mkAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, "", errors.New("Failed to get the key of " + user)
+	}
+	if mkAsBytes == nil {
+		return nil, key, nil
+	}
+	mk := MemberKey{}
+	json.Unmarshal(mkAsBytes, &mk)
+	return &mk, key, nil
+}
+
+// verifyMemberSignature - sig must be the base64 signature of payload by the registered key mk
+func verifyMemberSignature(mk *MemberKey, payload []byte, sig string, name string) error {
+	pub, err := parsePublicKey(mk.PublicKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(payload)
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || !ecdsa.VerifyASN1(pub, digest[:], raw) {
+		return PermissionError(name + " is not the signature of " + mk.User)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Register Member Key - set the public key a member signs its transfers with. Once it has one, only a SIGNATURE of
+// the new key by the old one replaces it, so that the admin cannot take over the points of a member.
+// ============================================================================================================================
+func (t *SimpleChaincode) register_member_key(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1         2                                    3
+	// "seller", "member", "-----BEGIN PUBLIC KEY-----...", *"SIGNATURE"*
+	seller := normalSeller(args[0])
+	if strings.HasPrefix(args[1], erasedPrefix) {
+		return nil, ParamError("Erased members cannot have a key")
+	}
+	err := checkPseudonyms(stub, [2]string{seller, args[1]})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parsePublicKey(args[2])
+	if err != nil {
+		return nil, err
+	}
+	old, key, err := memberKey(stub, seller, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if old != nil {
+		if len(args) < 4 || args[3] == "" {
+			return nil, PermissionError(args[1] + " has a key, its SIGNATURE of the new one is missing")
+		}
+		err = verifyMemberSignature(old, MemberKeyPayload(args[:3]), args[3], "SIGNATURE")
+		if err != nil {
+			return nil, err
+		}
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+
+	ms, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	mk := MemberKey{Seller: seller, User: args[1], PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		TxID: stub.GetTxID(), Timestamp: ms}
+	jsonAsBytes, _ := json.Marshal(mk)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAsBytes, nil
+}
+
+// heldLots - the lots of a seller a member owns that carry points, in id order
+func heldLots(stub shim.ChaincodeStubInterface, seller string, user string) ([]Point, error) {
+	ids, err := getOwnerIndex(stub, user)
+	if err != nil {
+		return nil, err
+	}
+	var lots []Point
+	for _, id := range ids {
+		if pointSeller(id) != seller {
+			continue
+		}
+		pointAsBytes, err := stub.GetState(id)
+		if err != nil {
+			return nil, errors.New("Failed to get point " + id)
+		}
+		res := Point{}
+		json.Unmarshal(pointAsBytes, &res)
+		if res.Points > 0 {
+			lots = append(lots, res)
+		}
+	}
+	return lots, nil
+}
+
+// balance - what a member holds of the points of a seller, the sum of its lots
+func balance(stub shim.ChaincodeStubInterface, seller string, user string) (Balance, []Point, error) {
+	bal := Balance{Seller: normalSeller(seller), User: user, Lots: []string{}}
+	lots, err := heldLots(stub, bal.Seller, user)
+	if err != nil {
+		return bal, nil, err
+	}
+	for _, p := range lots {
+		bal.Points += p.Points
+		bal.Lots = append(bal.Lots, p.Id)
+	}
+	return bal, lots, nil
+}
+
+// handOver - move points worth of lots to owner, in the order given. The last lot it needs is split when it is worth
+// more than what is left to move: it keeps the rest and a new lot of the seller goes to owner. Answers the ids of the
+// lots owner received.
+func handOver(stub shim.ChaincodeStubInterface, seller string, lots []Point, owner string, points int) ([]string, error) {
+	var moved []string
+	for _, p := range lots {
+		if points == 0 {
+			break
+		}
+		if p.Points <= points {
+			err := movePoint(stub, p, owner)
+			if err != nil {
+				return nil, err
+			}
+			points -= p.Points
+			moved = append(moved, p.Id)
+			continue
+		}
+		id, err := mintPointId(stub, seller+"-")
+		if err != nil {
+			return nil, err
+		}
+		err = createPoint(stub, Point{Id: id, Owner: owner, Points: points}, p.Owner)
+		if err != nil {
+			return nil, err
+		}
+		p.Points -= points
+		jsonAsBytes, _ := json.Marshal(p)
+		err = stub.PutState(p.Id, jsonAsBytes)
+		if err != nil {
+			return nil, err
+		}
+		moved = append(moved, id)
+		points = 0
+	}
+	return moved, nil
+}
+
+// ============================================================================================================================
+// Credit Member - issue points of a seller to one of its members, as a new lot of the seller
+// ============================================================================================================================
+func (t *SimpleChaincode) credit_member(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1         2
+	// "seller", "member", "points"
+	points, _ := strconv.Atoi(args[2]) //checked by the registry
+	if points == 0 {
+		return nil, ParamError("POINTS must be more than 0")
+	}
+	err := checkPseudonyms(stub, [2]string{args[0], args[1]})
+	if err != nil {
+		return nil, err
+	}
+	bal, _, err := balance(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	id, err := mintPointId(stub, bal.Seller+"-")
+	if err != nil {
+		return nil, err
+	}
+	err = createPoint(stub, Point{Id: id, Owner: strings.ToLower(args[1]), Points: points}, "") //owners are lower case
+	if err != nil {
+		return nil, err
+	}
+	bal.Points += points //the writes of a transaction are not visible to its reads, add the lot by hand
+	bal.Lots = append(bal.Lots, id)
+	jsonAsBytes, _ := json.Marshal(bal)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Transfer Points - move points of a seller from one of its members to another, by handing over lots of the sender.
+// The sending member authorises the transfer by signing it with its registered key, the seller must allow transfers
+// in its policy and the sender must hold the points.
+// ============================================================================================================================
+func (t *SimpleChaincode) transfer_points(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1       2       3         4         5
+	// "seller", "from", "to", "points", "NONCE", "SIGNATURE"
+	seller := normalSeller(args[0])
+	from, to := args[1], args[2]
+	points, _ := strconv.Atoi(args[3]) //checked by the registry
+	if points == 0 {
+		return nil, ParamError("POINTS must be more than 0")
+	}
+	if from == to {
+		return nil, ParamError(from + " cannot transfer points to itself")
+	}
+	if strings.HasPrefix(from, erasedPrefix) || strings.HasPrefix(to, erasedPrefix) {
+		return nil, ParamError("Erased members cannot transfer points")
+	}
+
+	policy, _, err := sellerPolicy(stub, seller)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.Transfers {
+		return nil, PermissionError("Seller " + args[0] + " does not allow transfers between its members")
+	}
+	if policy.MaxTransfer > 0 && points > policy.MaxTransfer {
+		return nil, PermissionError(fmt.Sprintf("Seller %s allows at most %d points per transfer", args[0], policy.MaxTransfer))
+	}
+	err = checkPseudonyms(stub, [2]string{seller, from}, [2]string{seller, to})
+	if err != nil {
+		return nil, err
+	}
+	mk, _, err := memberKey(stub, seller, from)
+	if err != nil {
+		return nil, err
+	}
+	if mk == nil {
+		return nil, PermissionError(from + " has no key to authorise transfers with")
+	}
+	err = verifyMemberSignature(mk, TransferPayload(args[:5]), args[5], "SIGNATURE")
+	if err != nil {
+		return nil, err
+	}
+	nonceKey, err := stub.CreateCompositeKey(memberNonceStr, []string{seller, from, args[4]})
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	used, err := stub.GetState(nonceKey)
+	if err != nil {
+		return nil, errors.New("Failed to get nonce " + args[4])
+	}
+	if used != nil {
+		return nil, ConflictError(from + " already used nonce " + args[4])
+	}
+	err = stub.PutState(nonceKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	sent, lots, err := balance(stub, seller, from)
+	if err != nil {
+		return nil, err
+	}
+	if sent.Points < points {
+		return nil, ConflictError(fmt.Sprintf("%s holds %d points of seller %s, not %d", from, sent.Points, args[0], points))
+	}
+	moved, err := handOver(stub, seller, lots, strings.ToLower(to), points) //owners are lower case
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := Transfer{Id: stub.GetTxID(), Seller: seller, From: from, To: to, Points: points, Nonce: args[4], Lots: moved, Timestamp: ms}
+	at, _ := strconv.ParseInt(ms, 10, 64)
+	key, err := stub.CreateCompositeKey(transferStr, []string{seller, fmt.Sprintf("%020d", at), transfer.Id}) //sorts like time
+	if err != nil {
+		return nil, ParamError(err.Error())
+	}
+	jsonAsBytes, _ := json.Marshal(transfer)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAsBytes, nil
+}
+
+// eraseTransfers - replace the member in the seller's transfers and drop its key
+func eraseTransfers(stub shim.ChaincodeStubInterface, erasure *Erasure, user string) error {
+	keysIter, err := stub.GetStateByPartialCompositeKey(transferStr, []string{erasure.Seller})
+	if err != nil {
+		return errors.New("Failed to get the transfers of seller " + erasure.Seller)
+	}
+	changed := make(map[string]Transfer)
+	var keys []string
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			keysIter.Close()
+			return errors.New("Failed to get the transfers of seller " + erasure.Seller)
+		}
+		res := Transfer{}
+		json.Unmarshal(kv.Value, &res)
+		found := false
+		if res.From == user {
+			res.From, found = erasure.Replacement, true
+		}
+		if res.To == user {
+			res.To, found = erasure.Replacement, true
+		}
+		if found {
+			res.Erased = erasure.Id
+			changed[kv.Key] = res
+			keys = append(keys, kv.Key)
+		}
+	}
+	keysIter.Close()
+
+	for _, key := range keys {
+		jsonAsBytes, _ := json.Marshal(changed[key])
+		err = stub.PutState(key, jsonAsBytes)
+		if err != nil {
+			return err
+		}
+		erasure.Transfers = append(erasure.Transfers, changed[key].Id)
+	}
+
+	return eraseMemberKey(stub, erasure, user)
+}
+
+// eraseMemberKey - drop the key of the member and the nonces it signed, an erased member transfers nothing
+func eraseMemberKey(stub shim.ChaincodeStubInterface, erasure *Erasure, user string) error {
+	mk, key, err := memberKey(stub, erasure.Seller, user)
+	if err != nil {
+		return err
+	}
+	if mk == nil {
+		return nil
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return err
+	}
+	keysIter, err := stub.GetStateByPartialCompositeKey(memberNonceStr, []string{erasure.Seller, user})
+	if err != nil {
+		return errors.New("Failed to get the nonces of " + user)
+	}
+	var keys []string
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			keysIter.Close()
+			return errors.New("Failed to get the nonces of " + user)
+		}
+		keys = append(keys, kv.Key)
+	}
+	keysIter.Close()
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	erasure.MemberKey = true
+	return nil
+}
+
+// ============================================================================================================================
+// Find Member Key - the public key a member signs its transfers with
+// ============================================================================================================================
+func (t *SimpleChaincode) findMemberKey(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", "member"
+	mk, _, err := memberKey(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if mk == nil {
+		return nil, NotFoundError("No key for " + args[1] + " at seller " + args[0])
+	}
+	jsonAsBytes, _ := json.Marshal(mk)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Find Balance - what a member holds of the points of its seller
+// ============================================================================================================================
+func (t *SimpleChaincode) findBalance(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", "member"
+	bal, _, err := balance(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(bal.Lots) == 0 {
+		return nil, NotFoundError("No points of seller " + args[0] + " held by " + args[1])
+	}
+	jsonAsBytes, _ := json.Marshal(bal)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// Find Transfers - the transfers between the members of a seller, oldest first, or those a member sent or received
+// ============================================================================================================================
+func (t *SimpleChaincode) findTransfers(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//   0         1
+	// "seller", *"member"*
+	seller, _ := strconv.Atoi(args[0]) //checked by the registry
+	user := ""
+	if len(args) == 2 {
+		user = args[1]
+	}
+
+	keysIter, err := stub.GetStateByPartialCompositeKey(transferStr, []string{strconv.Itoa(seller)})
+	if err != nil {
+		return nil, errors.New("Failed to get the transfers of seller " + args[0])
+	}
+	defer keysIter.Close()
+
+	var all AllTransfer
+	for keysIter.HasNext() {
+		kv, err := keysIter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get the transfers of seller " + args[0])
+		}
+		res := Transfer{}
+		json.Unmarshal(kv.Value, &res)
+		if user == "" || res.From == user || res.To == user {
+			all.Transfers = append(all.Transfers, res)
+		}
+	}
+	if len(all.Transfers) == 0 {
+		return nil, NotFoundError("No transfers")
+	}
+	jsonAsBytes, _ := json.Marshal(all)
+	return jsonAsBytes, nil
+}
@@ -0,0 +1,652 @@
+// Package client is the typed Go SDK of the CCPX chaincode. It encodes the
+// arguments of each chaincode function, decodes the Response envelope and
+// turns failure codes into Go errors, see Error.
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/merkle"
+)
+
+// Transport carries chaincode calls to a peer or a simulator. Both return the
+// chaincode's Response envelope; a transport whose peer only acknowledges
+// invocations returns the transaction id and a nil envelope.
+type Transport interface {
+	Invoke(function string, args []string) (txID string, envelope []byte, err error)
+	Query(function string, args []string) (envelope []byte, err error)
+}
+
+// The chaincode's JSON formats
+type (
+	Transaction  = chaincode.Transaction
+	AllTx        = chaincode.AllTx
+	Point        = chaincode.Point
+	PointHistory = chaincode.PointHistory
+	OwnerChange  = chaincode.OwnerChange
+	Aggregate    = chaincode.Aggregate
+	FunctionSpec = chaincode.FunctionSpec
+
+	Reconciliation = chaincode.Reconciliation
+	Mismatch       = chaincode.Mismatch
+	PeriodRoot     = chaincode.PeriodRoot
+	SellerKey      = chaincode.SellerKey
+	MemberKey      = chaincode.MemberKey
+	SellerPolicy   = chaincode.SellerPolicy
+	Erasure        = chaincode.Erasure
+	Leg            = chaincode.Leg
+	Balance        = chaincode.Balance
+	PointTransfer  = chaincode.Transfer
+)
+
+// raw state key the chaincode keeps its list of points under
+const pointIndexKey = "_pointindex"
+
+// Exchange is an exchange to record: UserA of SellerA gives PointsA of SellerA's
+// points to UserB of SellerB for PointsB of SellerB's points.
+type Exchange struct {
+	ID      string
+	UserA   string
+	UserB   string
+	SellerA string
+	SellerB string
+	PointsA int
+	PointsB int
+	Time    time.Time
+
+	// Sellers that registered a key sign the exchange, see Sign. Nonce is
+	// any string the signing sellers never used before.
+	Nonce      string
+	SignatureA string
+	SignatureB string
+
+	// Related are point lots handed over with the exchange, each with the
+	// member holding it as Owner. Each goes to the other member.
+	Related []Point
+}
+
+// function is the chaincode function that records the exchange
+func (ex Exchange) function() string {
+	if len(ex.Related) > 0 {
+		return "init_bundle_exchange"
+	}
+	return "init_transaction"
+}
+
+// signed are the arguments of the exchange the sellers sign, up to the nonce
+func (ex Exchange) signed() []string {
+	args := []string{ex.ID, ex.UserA, ex.UserB, ex.SellerA, ex.SellerB,
+		strconv.Itoa(ex.PointsA), strconv.Itoa(ex.PointsB), Millis(ex.Time)}
+	if len(ex.Related) > 0 {
+		raw, _ := json.Marshal(ex.Related)
+		args = append(args, string(raw))
+	}
+	return append(args, ex.Nonce)
+}
+
+// Payload is what the sellers of the exchange sign
+func (ex Exchange) Payload() []byte {
+	if len(ex.Related) > 0 {
+		return chaincode.BundlePayload(ex.signed())
+	}
+	return chaincode.ExchangePayload(ex.signed())
+}
+
+// Sign signs the exchange with the key of one of its sellers and returns the
+// signature for SignatureA or SignatureB
+func (ex Exchange) Sign(key *ecdsa.PrivateKey) (string, error) {
+	return sign(key, ex.Payload())
+}
+
+// sign is the base64 ASN.1 ECDSA signature of the SHA-256 of payload
+func sign(key *ecdsa.PrivateKey, payload []byte) (string, error) {
+	h := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Ring is a ring exchange to record: the member of each leg gives PointsOut
+// of its seller's points to the next leg, the last one to the first, and
+// receives PointsIn, what the previous leg gives.
+type Ring struct {
+	ID   string
+	Time time.Time
+	Legs []RingLeg
+
+	// Sellers that registered a key sign the ring, see Sign. Signatures
+	// are keyed by seller.
+	Nonce      string
+	Signatures map[string]string
+}
+
+// RingLeg is one member of a Ring
+type RingLeg struct {
+	User      string
+	Seller    string
+	PointsIn  int
+	PointsOut int
+}
+
+// signed are the arguments of init_ring_exchange the sellers sign
+func (r Ring) signed() []string {
+	legs := make([]chaincode.Leg, len(r.Legs))
+	for i, l := range r.Legs {
+		legs[i] = chaincode.Leg{User: l.User, Seller: l.Seller, In: strconv.Itoa(l.PointsIn), Out: strconv.Itoa(l.PointsOut)}
+	}
+	raw, _ := json.Marshal(legs)
+	return []string{r.ID, Millis(r.Time), string(raw), r.Nonce}
+}
+
+// Payload is what the sellers of the ring sign
+func (r Ring) Payload() []byte {
+	return chaincode.RingPayload(r.signed())
+}
+
+// Sign signs the ring with the key of one of its sellers and returns the
+// signature to put in Signatures under that seller
+func (r Ring) Sign(key *ecdsa.PrivateKey) (string, error) {
+	return sign(key, r.Payload())
+}
+
+// Transfer moves Points of Seller's points from its member From to its member
+// To. From authorises it by signing it with its own key, see Sign; Nonce is any
+// string From never signed before.
+type Transfer struct {
+	Seller    string
+	From      string
+	To        string
+	Points    int
+	Nonce     string
+	Signature string
+}
+
+// signed are the arguments of the transfer the sender signs, up to the nonce
+func (tr Transfer) signed() []string {
+	return []string{tr.Seller, tr.From, tr.To, strconv.Itoa(tr.Points), tr.Nonce}
+}
+
+// Payload is what the sender signs
+func (tr Transfer) Payload() []byte {
+	return chaincode.TransferPayload(tr.signed())
+}
+
+// Sign signs the transfer with the key of the member From and returns the
+// signature for Signature
+func (tr Transfer) Sign(key *ecdsa.PrivateKey) (string, error) {
+	return sign(key, tr.Payload())
+}
+
+// Record is an exchange as a seller's own system has it, for Reconcile: its
+// member User gave or received Points of the seller's points.
+type Record struct {
+	TxID   string
+	User   string
+	Points int
+	Time   time.Time
+}
+
+// Client calls the CCPX chaincode through a Transport
+type Client struct {
+	t Transport
+}
+
+// New returns a client on top of t
+func New(t Transport) *Client {
+	return &Client{t: t}
+}
+
+// Millis is how the chaincode writes a time, ms since epoch
+func Millis(tm time.Time) string {
+	return strconv.FormatInt(tm.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// decode reads an envelope, failure codes come back as *Error
+func decode(function string, envelope []byte) (chaincode.Response, error) {
+	var resp chaincode.Response
+	if err := json.Unmarshal(envelope, &resp); err != nil {
+		return resp, errors.New("ccpx: " + function + ": not a Response envelope: " + string(envelope))
+	}
+	if resp.Code != chaincode.CodeRecorded && resp.Code != chaincode.CodeEnquiryOK {
+		return resp, &Error{Function: function, Code: resp.Code, Message: resp.Message}
+	}
+	return resp, nil
+}
+
+// Invoke calls any invoke function and returns the transaction id
+func (c *Client) Invoke(function string, args ...string) (string, error) {
+	txID, envelope, err := c.t.Invoke(function, args)
+	if err != nil {
+		return "", err
+	}
+	if envelope != nil {
+		if _, err := decode(function, envelope); err != nil {
+			return txID, err
+		}
+	}
+	return txID, nil
+}
+
+// Query calls any query function and decodes its content into v, v may be nil
+func (c *Client) Query(v interface{}, function string, args ...string) error {
+	envelope, err := c.t.Query(function, args)
+	if err != nil {
+		return err
+	}
+	resp, err := decode(function, envelope)
+	if err != nil {
+		return err
+	}
+	if v == nil || resp.Payload == nil {
+		return nil
+	}
+	if err := json.Unmarshal(*resp.Payload, v); err != nil {
+		return errors.New("ccpx: " + function + ": " + err.Error())
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Invocations
+// ============================================================================================================================
+
+// Init resets the chaincode state, abc is the test variable it starts with
+func (c *Client) Init(abc int) (string, error) {
+	return c.Invoke("init", strconv.Itoa(abc))
+}
+
+// RecordExchange records an exchange between two members of two sellers, with
+// the point lots of Related when there are some
+func (c *Client) RecordExchange(ex Exchange) (string, error) {
+	args := ex.signed()
+	switch {
+	case ex.SignatureB != "":
+		args = append(args, ex.SignatureA, ex.SignatureB)
+	case ex.SignatureA != "":
+		args = append(args, ex.SignatureA)
+	case ex.Nonce == "":
+		args = args[:len(args)-1]
+	}
+	return c.Invoke(ex.function(), args...)
+}
+
+// RecordRing records an exchange between the members of several sellers in one transaction
+func (c *Client) RecordRing(r Ring) (string, error) {
+	args := r.signed()
+	switch {
+	case len(r.Signatures) > 0:
+		raw, _ := json.Marshal(r.Signatures)
+		args = append(args, string(raw))
+	case r.Nonce == "":
+		args = args[:3]
+	}
+	return c.Invoke("init_ring_exchange", args...)
+}
+
+// CreatePoint issues a new point to owner
+func (c *Client) CreatePoint(id string, owner string) (string, error) {
+	return c.Invoke("init_point", id, owner)
+}
+
+// IssuePoint creates a point for owner under an id the chaincode mints from
+// prefix, which starts with the seller: "1" gives "1-1", "1-2" and so on, and
+// "1-2016114" gives "1-2016114-3" after them. A transport whose peer only
+// acknowledges invocations gives no point, find it with PointsOf once the
+// transaction is committed.
+func (c *Client) IssuePoint(prefix string, owner string) (*Point, string, error) {
+	txID, envelope, err := c.t.Invoke("init_point", []string{prefix + "-", owner})
+	if err != nil || envelope == nil {
+		return nil, txID, err
+	}
+	resp, err := decode("init_point", envelope)
+	if err != nil || resp.Payload == nil {
+		return nil, txID, err
+	}
+	var res Point
+	if err := json.Unmarshal(*resp.Payload, &res); err != nil {
+		return nil, txID, errors.New("ccpx: init_point: " + err.Error())
+	}
+	return &res, txID, nil
+}
+
+// TransferPoint hands a point over to a new owner
+func (c *Client) TransferPoint(id string, owner string) (string, error) {
+	return c.Invoke("set_user", id, owner)
+}
+
+// DeletePoint redeems a point, its history stays on the ledger
+func (c *Client) DeletePoint(id string) (string, error) {
+	return c.Invoke("delete", id)
+}
+
+// Reconcile compares the records of seller between from and to with the
+// ledger, which keeps the result. A transport whose peer only acknowledges
+// invocations gives no result, read it with Reconciliation once the
+// transaction is committed.
+func (c *Client) Reconcile(seller string, from time.Time, to time.Time, records []Record) (*Reconciliation, string, error) {
+	list := make([]chaincode.SellerRecord, len(records))
+	for i, r := range records {
+		list[i] = chaincode.SellerRecord{Id: r.TxID, User: r.User,
+			Points: json.Number(strconv.Itoa(r.Points)), Time: json.Number(Millis(r.Time))}
+	}
+	raw, _ := json.Marshal(list)
+	txID, envelope, err := c.t.Invoke("reconcile", []string{seller, Millis(from), Millis(to), string(raw)})
+	if err != nil || envelope == nil {
+		return nil, txID, err
+	}
+	resp, err := decode("reconcile", envelope)
+	if err != nil || resp.Payload == nil {
+		return nil, txID, err
+	}
+	var res Reconciliation
+	if err := json.Unmarshal(*resp.Payload, &res); err != nil {
+		return nil, txID, errors.New("ccpx: reconcile: " + err.Error())
+	}
+	return &res, txID, nil
+}
+
+// EraseMember replaces member user of seller with an erased: token in its
+// exchanges, points, reconciliations, transfers and balance, amounts and
+// sellers stay. A transport whose peer only acknowledges invocations gives no
+// result, read it with Erasure once the transaction is committed.
+func (c *Client) EraseMember(seller string, user string) (*Erasure, string, error) {
+	txID, envelope, err := c.t.Invoke("erase_member", []string{seller, user})
+	if err != nil || envelope == nil {
+		return nil, txID, err
+	}
+	resp, err := decode("erase_member", envelope)
+	if err != nil || resp.Payload == nil {
+		return nil, txID, err
+	}
+	var res Erasure
+	if err := json.Unmarshal(*resp.Payload, &res); err != nil {
+		return nil, txID, errors.New("ccpx: erase_member: " + err.Error())
+	}
+	return &res, txID, nil
+}
+
+// RegisterSellerKey sets the public key seller signs its exchanges with, an
+// ECDSA key in PEM. From then on its exchanges must carry its signature.
+func (c *Client) RegisterSellerKey(seller string, publicKeyPEM string) (string, error) {
+	return c.Invoke("register_seller_key", seller, publicKeyPEM)
+}
+
+// RegisterMemberKey sets the public key user of seller signs its transfers
+// with, an ECDSA key in PEM. A member that has a key already signs the new one
+// with it: oldKey is that key, nil for the first one.
+func (c *Client) RegisterMemberKey(seller string, user string, publicKeyPEM string, oldKey *ecdsa.PrivateKey) (string, error) {
+	args := []string{seller, user, publicKeyPEM}
+	if oldKey != nil {
+		sig, err := sign(oldKey, chaincode.MemberKeyPayload(args))
+		if err != nil {
+			return "", err
+		}
+		args = append(args, sig)
+	}
+	return c.Invoke("register_member_key", args...)
+}
+
+// SetSellerPolicy changes the policy of seller, change holds the fields to
+// set, e.g. map[string]interface{}{"pseudonymous": true}
+func (c *Client) SetSellerPolicy(seller string, change interface{}) (string, error) {
+	raw, err := json.Marshal(change)
+	if err != nil {
+		return "", err
+	}
+	return c.Invoke("set_seller_policy", seller, string(raw))
+}
+
+// CreditMember issues points of seller to its member user, as a new lot of
+// the seller, and returns the new balance. A transport whose peer only acknowledges
+// invocations gives no balance, read it with Balance once the transaction is
+// committed.
+func (c *Client) CreditMember(seller string, user string, points int) (*Balance, string, error) {
+	var bal Balance
+	txID, ok, err := c.invokeResult(&bal, "credit_member", seller, user, strconv.Itoa(points))
+	if !ok {
+		return nil, txID, err
+	}
+	return &bal, txID, nil
+}
+
+// RecordTransfer moves points between two members of a seller and returns the
+// transfer as recorded. A transport whose peer only acknowledges invocations
+// gives no record, find it with Transfers once the transaction is committed.
+func (c *Client) RecordTransfer(tr Transfer) (*PointTransfer, string, error) {
+	var res PointTransfer
+	txID, ok, err := c.invokeResult(&res, "transfer_points", append(tr.signed(), tr.Signature)...)
+	if !ok {
+		return nil, txID, err
+	}
+	return &res, txID, nil
+}
+
+// invokeResult invokes function and decodes the payload it answers into v,
+// ok is false when there is none
+func (c *Client) invokeResult(v interface{}, function string, args ...string) (txID string, ok bool, err error) {
+	txID, envelope, err := c.t.Invoke(function, args)
+	if err != nil || envelope == nil {
+		return txID, false, err
+	}
+	resp, err := decode(function, envelope)
+	if err != nil || resp.Payload == nil {
+		return txID, false, err
+	}
+	if err := json.Unmarshal(*resp.Payload, v); err != nil {
+		return txID, false, errors.New("ccpx: " + function + ": " + err.Error())
+	}
+	return txID, true, nil
+}
+
+// WriteKey writes a raw variable into the chaincode state
+func (c *Client) WriteKey(key string, value string) (string, error) {
+	return c.Invoke("write", key, value)
+}
+
+// ============================================================================================================================
+// Queries - no records answers an error matching ErrNotFound
+// ============================================================================================================================
+
+// LatestExchanges returns the last n exchanges seller took part in, oldest first
+func (c *Client) LatestExchanges(seller string, n int) ([]Transaction, error) {
+	var all AllTx
+	err := c.Query(&all, "findLatest", seller, strconv.Itoa(n))
+	return all.TXs, err
+}
+
+// ExchangesInRange returns the exchanges of seller between from and to, both included
+func (c *Client) ExchangesInRange(seller string, from time.Time, to time.Time) ([]Transaction, error) {
+	var all AllTx
+	err := c.Query(&all, "findRange", seller, Millis(from), Millis(to))
+	return all.TXs, err
+}
+
+// UserExchanges returns the exchanges of a member of seller, oldest first. The
+// member of a pseudonymous seller is given by its pseudonym.
+func (c *Client) UserExchanges(seller string, user string) ([]Transaction, error) {
+	var all AllTx
+	err := c.Query(&all, "findUserEx", seller, user)
+	return all.TXs, err
+}
+
+// Aggregates returns the exchange totals of seller per "day", "week" or "month"
+// between from and to, with one partner seller or with all of them when partner is ""
+func (c *Client) Aggregates(seller string, period string, from time.Time, to time.Time, partner string) ([]Aggregate, error) {
+	var all chaincode.AllAggregate
+	args := []string{seller, period, Millis(from), Millis(to)}
+	if partner != "" {
+		args = append(args, partner)
+	}
+	err := c.Query(&all, "findAggregate", args...)
+	return all.Aggs, err
+}
+
+// Reconciliations returns the reconciliations recorded for seller, oldest first
+func (c *Client) Reconciliations(seller string) ([]Reconciliation, error) {
+	var all chaincode.AllReconciliation
+	err := c.Query(&all, "findReconciliations", seller)
+	return all.Reconciliations, err
+}
+
+// Reconciliation reads the reconciliation recorded by transaction txID
+func (c *Client) Reconciliation(seller string, txID string) (*Reconciliation, error) {
+	var all chaincode.AllReconciliation
+	if err := c.Query(&all, "findReconciliations", seller, txID); err != nil {
+		return nil, err
+	}
+	if len(all.Reconciliations) == 0 {
+		return nil, ErrNotFound
+	}
+	return &all.Reconciliations[0], nil
+}
+
+// Erasures returns the erasures of the members of seller, oldest first
+func (c *Client) Erasures(seller string) ([]Erasure, error) {
+	var all chaincode.AllErasure
+	err := c.Query(&all, "findErasures", seller)
+	return all.Erasures, err
+}
+
+// Erasure reads the erasure recorded by transaction txID
+func (c *Client) Erasure(seller string, txID string) (*Erasure, error) {
+	var all chaincode.AllErasure
+	if err := c.Query(&all, "findErasures", seller, txID); err != nil {
+		return nil, err
+	}
+	if len(all.Erasures) == 0 {
+		return nil, ErrNotFound
+	}
+	return &all.Erasures[0], nil
+}
+
+// Receipt returns the receipt of an exchange, check it with its Verify method
+func (c *Client) Receipt(txID string) (*merkle.Receipt, error) {
+	var r merkle.Receipt
+	if err := c.Query(&r, "findReceipt", txID); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// MerkleRoot returns the root of the tree of the exchanges of a UTC day, e.g. 2016-12-04
+func (c *Client) MerkleRoot(period string) (*PeriodRoot, error) {
+	var root PeriodRoot
+	if err := c.Query(&root, "findMerkleRoot", period); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// SellerKey returns the public key seller signs its exchanges with
+func (c *Client) SellerKey(seller string) (*SellerKey, error) {
+	var sk SellerKey
+	if err := c.Query(&sk, "findSellerKey", seller); err != nil {
+		return nil, err
+	}
+	return &sk, nil
+}
+
+// MemberKey returns the public key user of seller signs its transfers with
+func (c *Client) MemberKey(seller string, user string) (*MemberKey, error) {
+	var mk MemberKey
+	if err := c.Query(&mk, "findMemberKey", seller, user); err != nil {
+		return nil, err
+	}
+	return &mk, nil
+}
+
+// SellerPolicy returns the policy of seller
+func (c *Client) SellerPolicy(seller string) (*SellerPolicy, error) {
+	var policy SellerPolicy
+	if err := c.Query(&policy, "findSellerPolicy", seller); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Balance reads what member user holds of the points of seller
+func (c *Client) Balance(seller string, user string) (*Balance, error) {
+	var bal Balance
+	if err := c.Query(&bal, "findBalance", seller, user); err != nil {
+		return nil, err
+	}
+	return &bal, nil
+}
+
+// Transfers returns the transfers between the members of seller, oldest
+// first, or those user sent or received when it is not empty
+func (c *Client) Transfers(seller string, user string) ([]PointTransfer, error) {
+	args := []string{seller}
+	if user != "" {
+		args = append(args, user)
+	}
+	var all chaincode.AllTransfer
+	err := c.Query(&all, "findTransfers", args...)
+	return all.Transfers, err
+}
+
+// Point reads one point
+func (c *Client) Point(id string) (*Point, error) {
+	var p Point
+	if err := c.Query(&p, "read", id); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PointsOf returns the points held by owner
+func (c *Client) PointsOf(owner string) ([]Point, error) {
+	var all chaincode.AllPoint
+	err := c.Query(&all, "findPointWithOwner", owner)
+	return all.Points, err
+}
+
+// PointHistory returns the ownership history of a point, oldest first
+func (c *Client) PointHistory(id string) (*PointHistory, error) {
+	var hist PointHistory
+	if err := c.Query(&hist, "findPointHistory", id); err != nil {
+		return nil, err
+	}
+	return &hist, nil
+}
+
+// PointIDs returns the ids of every point on the ledger
+func (c *Client) PointIDs() ([]string, error) {
+	var ids []string
+	err := c.Query(&ids, "read", pointIndexKey)
+	return ids, err
+}
+
+// Exchanges returns every exchange on the ledger, oldest first
+func (c *Client) Exchanges() ([]Transaction, error) {
+	var all AllTx
+	err := c.Query(&all, "findExchanges")
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return all.TXs, err
+}
+
+// ReadKey reads a raw variable, values that are not JSON come back as a JSON string
+func (c *Client) ReadKey(key string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	err := c.Query(&raw, "read", key)
+	return raw, err
+}
+
+// Describe returns the catalogue of the chaincode functions
+func (c *Client) Describe() ([]FunctionSpec, error) {
+	var all chaincode.AllFunction
+	err := c.Query(&all, "describe")
+	return all.Functions, err
+}
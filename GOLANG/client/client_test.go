@@ -0,0 +1,483 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// stubTransport runs the real chaincode in process on a shimtest stub
+type stubTransport struct {
+	stub *shimtest.MockStub
+	n    int
+}
+
+func newStubClient(t *testing.T) *Client {
+	c := &stubTransport{stub: shimtest.NewMockStub("ccpx", new(chaincode.SimpleChaincode))}
+	if res := c.stub.MockInit("deploy", [][]byte{[]byte("init"), []byte("99")}); res.Status != 200 {
+		t.Fatalf("init: %s", res.Message)
+	}
+	return New(c)
+}
+
+func (c *stubTransport) Invoke(function string, args []string) (string, []byte, error) {
+	c.n++
+	txID := "tx" + strconv.Itoa(c.n)
+	argv := [][]byte{[]byte(function)}
+	for _, a := range args {
+		argv = append(argv, []byte(a))
+	}
+	return txID, c.stub.MockInvoke(txID, argv).Payload, nil
+}
+
+func (c *stubTransport) Query(function string, args []string) ([]byte, error) {
+	_, envelope, err := c.Invoke(function, args)
+	return envelope, err
+}
+
+var day = time.Date(2016, 12, 4, 0, 0, 0, 0, time.UTC)
+
+func TestExchanges(t *testing.T) {
+	c := newStubClient(t)
+	for i, seller := range []string{"2", "3", "2"} {
+		ex := Exchange{ID: "t" + strconv.Itoa(i), UserA: "bob", UserB: "alice", SellerA: "1", SellerB: seller,
+			PointsA: 10 * (i + 1), PointsB: 5, Time: day.Add(time.Duration(i) * time.Hour)}
+		if _, err := c.RecordExchange(ex); err != nil {
+			t.Fatalf("RecordExchange %d: %v", i, err)
+		}
+	}
+
+	txs, err := c.LatestExchanges("1", 2)
+	if err != nil || len(txs) != 2 || txs[0].Id != "t1" || txs[1].PointA != "30" {
+		t.Errorf("LatestExchanges: %+v %v", txs, err)
+	}
+	txs, err = c.ExchangesInRange("2", day, day.Add(90*time.Minute))
+	if err != nil || len(txs) != 1 || txs[0].Id != "t0" || txs[0].Timestamp != Millis(day) {
+		t.Errorf("ExchangesInRange: %+v %v", txs, err)
+	}
+	if _, err := c.LatestExchanges("9", 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LatestExchanges of an unknown seller: %v", err)
+	}
+	aggs, err := c.Aggregates("1", "day", day, day, "3")
+	if err != nil || len(aggs) != 1 || aggs[0].PointsOut != 20 || aggs[0].Partner != "3" {
+		t.Errorf("Aggregates: %+v %v", aggs, err)
+	}
+	all, err := c.Exchanges()
+	if err != nil || len(all) != 3 {
+		t.Errorf("Exchanges: %+v %v", all, err)
+	}
+
+	_, err = c.RecordExchange(Exchange{ID: "t0", UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2", Time: day})
+	if !errors.Is(err, ErrConflict) || Code(err) != chaincode.CodeConflict {
+		t.Errorf("recording t0 twice: %v", err)
+	}
+	_, err = c.RecordExchange(Exchange{ID: "t9", UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2", PointsA: -1, Time: day})
+	if !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("negative points: %v", err)
+	}
+}
+
+func TestIssuePoint(t *testing.T) {
+	c := newStubClient(t)
+	for i, want := range []string{"1-2016114-1", "1-2016114-2"} {
+		p, txID, err := c.IssuePoint("1-2016114", "Bob")
+		if err != nil || txID == "" || p == nil || p.Id != want || p.Owner != "bob" {
+			t.Fatalf("IssuePoint %d: %+v %s %v, want %s", i, p, txID, err, want)
+		}
+	}
+	if _, err := c.CreatePoint("1-2016114-3", "alice"); err != nil {
+		t.Fatalf("CreatePoint: %v", err)
+	}
+	if p, _, err := c.IssuePoint("1-2016114", "bob"); err != nil || p.Id != "1-2016114-4" {
+		t.Errorf("IssuePoint after an explicit id: %+v %v", p, err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	c := newStubClient(t)
+	for i := 0; i < 3; i++ {
+		ex := Exchange{ID: "t" + strconv.Itoa(i), UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2",
+			PointsA: 10, PointsB: 5, Time: day.Add(time.Duration(i) * time.Hour)}
+		if _, err := c.RecordExchange(ex); err != nil {
+			t.Fatalf("RecordExchange %d: %v", i, err)
+		}
+	}
+
+	res, txID, err := c.Reconcile("1", day, day.Add(24*time.Hour), []Record{
+		{TxID: "t0", User: "bob", Points: 10, Time: day},
+		{TxID: "t1", User: "bob", Points: 12, Time: day.Add(time.Hour)},
+		{TxID: "t7", User: "bob", Points: 1, Time: day},
+	})
+	if err != nil || res.Matched != 1 || len(res.Mismatches) != 1 || res.Mismatches[0].Field != "POINTS" ||
+		len(res.MissingOnLedger) != 1 || len(res.MissingAtSeller) != 1 || res.MissingAtSeller[0] != "t2" {
+		t.Fatalf("Reconcile: %+v %v", res, err)
+	}
+	got, err := c.Reconciliation("1", txID)
+	if err != nil || got.Id != txID || got.RecordsHash != res.RecordsHash {
+		t.Errorf("Reconciliation: %+v %v", got, err)
+	}
+	if all, err := c.Reconciliations("2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Reconciliations of a seller that never reconciled: %+v %v", all, err)
+	}
+	if _, _, err := c.Reconcile("1", day, day, []Record{{TxID: "t0"}, {TxID: "t0"}}); !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("a record listed twice: %v", err)
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	c := newStubClient(t)
+	for i := 0; i < 3; i++ {
+		ex := Exchange{ID: "t" + strconv.Itoa(i), UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2",
+			PointsA: 10, PointsB: 5, Time: day.Add(time.Duration(i) * time.Hour)}
+		if _, err := c.RecordExchange(ex); err != nil {
+			t.Fatalf("RecordExchange %d: %v", i, err)
+		}
+	}
+	r, err := c.Receipt("t1")
+	if err != nil || r.Verify() != nil || r.Index != 1 {
+		t.Fatalf("Receipt: %+v %v", r, err)
+	}
+	root, err := c.MerkleRoot("2016-12-04")
+	if err != nil || root.Root != r.Root || root.Size != 3 {
+		t.Errorf("MerkleRoot: %+v %v", root, err)
+	}
+	if _, err := c.Receipt("t9"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Receipt of an unknown exchange: %v", err)
+	}
+}
+
+// asAdmin makes the calls of c with a certificate carrying the admin role
+func asAdmin(t *testing.T, c *Client) {
+	cert, _ := identity(t, "admin")
+	creator, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: "CCPXMSP", IdBytes: cert})
+	c.t.(*stubTransport).stub.Creator = creator
+}
+
+// identity is a PEM certificate and its key, with role as the fabric-ca attribute when set
+func identity(t *testing.T, role string) ([]byte, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "user"},
+		NotBefore:    day.Add(-time.Hour),
+		NotAfter:     day.Add(24 * time.Hour),
+	}
+	if role != "" {
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: []byte(`{"attrs":{"role":"` + role + `"}}`)}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}
+
+func TestSignedExchange(t *testing.T) {
+	c := newStubClient(t)
+	asAdmin(t, c)
+	keys := make(map[string]*ecdsa.PrivateKey)
+	for _, seller := range []string{"1", "2"} {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if _, err := c.RegisterSellerKey(seller, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))); err != nil {
+			t.Fatalf("RegisterSellerKey %s: %v", seller, err)
+		}
+		keys[seller] = key
+	}
+
+	psnKey := []byte("0123456789abcdef")
+	ex := Exchange{ID: "t1", UserA: pseudonym.Of(psnKey, "1", "bob"), UserB: pseudonym.Of(psnKey, "2", "alice"),
+		SellerA: "1", SellerB: "2", PointsA: 10, PointsB: 5, Time: day, Nonce: "n1"}
+	if _, err := c.RecordExchange(ex); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("unsigned exchange: %v", err)
+	}
+	ex.SignatureA, _ = ex.Sign(keys["1"])
+	ex.SignatureB, _ = ex.Sign(keys["2"])
+	if _, err := c.RecordExchange(ex); err != nil {
+		t.Errorf("signed exchange: %v", err)
+	}
+	ex.ID = "t2"
+	if _, err := c.RecordExchange(ex); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("signatures of another exchange: %v", err)
+	}
+	ex.SignatureA, _ = ex.Sign(keys["1"])
+	ex.SignatureB, _ = ex.Sign(keys["2"])
+	if _, err := c.RecordExchange(ex); !errors.Is(err, ErrConflict) {
+		t.Errorf("nonce used twice: %v", err)
+	}
+	if sk, err := c.SellerKey("2"); err != nil || sk.Seller != "2" {
+		t.Errorf("SellerKey: %+v %v", sk, err)
+	}
+}
+
+func TestPseudonymousSeller(t *testing.T) {
+	c := newStubClient(t)
+	asAdmin(t, c)
+	if _, err := c.SetSellerPolicy("1", map[string]interface{}{"pseudonymous": true}); err != nil {
+		t.Fatalf("SetSellerPolicy: %v", err)
+	}
+	if policy, err := c.SellerPolicy("1"); err != nil || !policy.Pseudonymous {
+		t.Errorf("SellerPolicy: %+v %v", policy, err)
+	}
+	ex := Exchange{ID: "t1", UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2", PointsA: 10, PointsB: 5, Time: day}
+	if _, err := c.RecordExchange(ex); !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("member in clear: %v", err)
+	}
+	ex.UserA = pseudonym.Of([]byte("0123456789abcdef"), "1", "bob")
+	if _, err := c.RecordExchange(ex); err != nil {
+		t.Errorf("member as a pseudonym: %v", err)
+	}
+	if txs, err := c.UserExchanges("1", ex.UserA); err != nil || len(txs) != 1 {
+		t.Errorf("UserExchanges: %+v %v", txs, err)
+	}
+}
+
+func TestRecordTransfer(t *testing.T) {
+	c := newStubClient(t)
+	asAdmin(t, c)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if _, err := c.RegisterMemberKey("1", "bob", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil); err != nil {
+		t.Fatalf("RegisterMemberKey: %v", err)
+	}
+	if bal, _, err := c.CreditMember("1", "bob", 50); err != nil || bal.Points != 50 {
+		t.Fatalf("CreditMember: %+v %v", bal, err)
+	}
+
+	tr := Transfer{Seller: "1", From: "bob", To: "alice", Points: 20, Nonce: "n1"}
+	tr.Signature, _ = tr.Sign(key)
+	if _, _, err := c.RecordTransfer(tr); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("transfer before the seller allows them: %v", err)
+	}
+	if _, err := c.SetSellerPolicy("1", map[string]interface{}{"transfers": true}); err != nil {
+		t.Fatalf("SetSellerPolicy: %v", err)
+	}
+	res, txID, err := c.RecordTransfer(tr)
+	if err != nil || res.Id != txID || res.Points != 20 || res.To != "alice" {
+		t.Fatalf("RecordTransfer: %+v %s %v", res, txID, err)
+	}
+	tr.Points, tr.Nonce = 40, "n2"
+	tr.Signature, _ = tr.Sign(key)
+	if _, _, err := c.RecordTransfer(tr); !errors.Is(err, ErrConflict) {
+		t.Errorf("transfer of more than bob holds: %v", err)
+	}
+	if bal, err := c.Balance("1", "alice"); err != nil || bal.Points != 20 {
+		t.Errorf("Balance: %+v %v", bal, err)
+	}
+	if all, err := c.Transfers("1", "bob"); err != nil || len(all) != 1 || all[0].Id != txID {
+		t.Errorf("Transfers: %+v %v", all, err)
+	}
+	if all, err := c.Transfers("1", "carol"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Transfers of a member without any: %+v %v", all, err)
+	}
+
+	next, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ = x509.MarshalPKIXPublicKey(&next.PublicKey)
+	nextPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if _, err := c.RegisterMemberKey("1", "bob", nextPEM, nil); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("replacing the key of bob without his signature: %v", err)
+	}
+	if _, err := c.RegisterMemberKey("1", "bob", nextPEM, key); err != nil {
+		t.Errorf("RegisterMemberKey signed by the old key: %v", err)
+	}
+	if mk, err := c.MemberKey("1", "bob"); err != nil || mk.PublicKey != nextPEM {
+		t.Errorf("MemberKey: %+v %v", mk, err)
+	}
+}
+
+func TestEraseMember(t *testing.T) {
+	c := newStubClient(t)
+	asAdmin(t, c)
+	ex := Exchange{ID: "t1", UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2", PointsA: 10, PointsB: 5, Time: day}
+	if _, err := c.RecordExchange(ex); err != nil {
+		t.Fatalf("RecordExchange: %v", err)
+	}
+	erasure, txID, err := c.EraseMember("1", "bob")
+	if err != nil || erasure == nil || erasure.Id != txID || len(erasure.Exchanges) != 1 {
+		t.Fatalf("EraseMember: %+v %s %v", erasure, txID, err)
+	}
+	txs, err := c.UserExchanges("1", erasure.Replacement)
+	if err != nil || len(txs) != 1 || txs[0].PointA != "10" || txs[0].TraderB != "alice" {
+		t.Errorf("exchanges of the erased member: %+v %v", txs, err)
+	}
+	if got, err := c.Erasure("1", txID); err != nil || got.Replacement != erasure.Replacement {
+		t.Errorf("Erasure: %+v %v", got, err)
+	}
+	if _, _, err := c.EraseMember("1", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("erasing bob twice: %v", err)
+	}
+	if r, err := c.Receipt("t1"); err != nil || r.Erased != txID || r.Verify() != nil {
+		t.Errorf("Receipt: %+v %v", r, err)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	c := newStubClient(t)
+	for id, owner := range map[string]string{"1-a": "bob", "2-a": "alice"} {
+		if _, err := c.CreatePoint(id, owner); err != nil {
+			t.Fatalf("CreatePoint: %v", err)
+		}
+	}
+	ex := Exchange{ID: "b1", UserA: "bob", UserB: "alice", SellerA: "1", SellerB: "2", PointsA: 10, PointsB: 5, Time: day,
+		Related: []Point{{Id: "1-a", Owner: "bob"}, {Id: "2-a", Owner: "bob"}}}
+	if _, err := c.RecordExchange(ex); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("bundle with a point bob does not hold: %v", err)
+	}
+	ex.Related[1].Owner = "alice"
+	if _, err := c.RecordExchange(ex); err != nil {
+		t.Fatalf("RecordExchange: %v", err)
+	}
+	if p, err := c.Point("2-a"); err != nil || p.Owner != "bob" {
+		t.Errorf("Point 2-a: %+v %v", p, err)
+	}
+	txs, err := c.LatestExchanges("1", 1)
+	if err != nil || len(txs) != 1 || len(txs[0].Related) != 2 {
+		t.Errorf("LatestExchanges: %+v %v", txs, err)
+	}
+}
+
+func TestRecordRing(t *testing.T) {
+	c := newStubClient(t)
+	asAdmin(t, c)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if _, err := c.RegisterSellerKey("2", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))); err != nil {
+		t.Fatalf("RegisterSellerKey: %v", err)
+	}
+	ring := Ring{ID: "r1", Time: day, Legs: []RingLeg{
+		{User: "bob", Seller: "1", PointsIn: 30, PointsOut: 10},
+		{User: pseudonym.Of([]byte("0123456789abcdef"), "2", "alice"), Seller: "2", PointsIn: 10, PointsOut: 20},
+		{User: "carol", Seller: "3", PointsIn: 20, PointsOut: 30},
+	}}
+	if _, err := c.RecordRing(ring); !errors.Is(err, ErrNoPermission) {
+		t.Errorf("unsigned ring: %v", err)
+	}
+	ring.Nonce = "n1"
+	sig, err := ring.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring.Signatures = map[string]string{"2": sig}
+	if _, err := c.RecordRing(ring); err != nil {
+		t.Fatalf("RecordRing: %v", err)
+	}
+	txs, err := c.LatestExchanges("3", 1)
+	if err != nil || len(txs) != 1 || len(txs[0].Legs) != 3 || txs[0].Legs[2] != (Leg{User: "carol", Seller: "3", In: "20", Out: "30"}) {
+		t.Errorf("LatestExchanges of seller 3: %+v %v", txs, err)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	c := newStubClient(t)
+	if _, err := c.CreatePoint("p1", "Bob"); err != nil {
+		t.Fatalf("CreatePoint: %v", err)
+	}
+	if _, err := c.TransferPoint("p1", "alice"); err != nil {
+		t.Fatalf("TransferPoint: %v", err)
+	}
+
+	p, err := c.Point("p1")
+	if err != nil || p.Owner != "alice" {
+		t.Errorf("Point: %+v %v", p, err)
+	}
+	points, err := c.PointsOf("alice")
+	if err != nil || len(points) != 1 || points[0].Id != "p1" {
+		t.Errorf("PointsOf: %+v %v", points, err)
+	}
+	if _, err := c.PointsOf("bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PointsOf bob: %v", err)
+	}
+	hist, err := c.PointHistory("p1")
+	if err != nil || len(hist.History) != 2 || hist.History[1].PrevOwner != "bob" {
+		t.Errorf("PointHistory: %+v %v", hist, err)
+	}
+	ids, err := c.PointIDs()
+	if err != nil || len(ids) != 1 {
+		t.Errorf("PointIDs: %v %v", ids, err)
+	}
+	raw, err := c.ReadKey("abc")
+	if err != nil || string(raw) != `99` {
+		t.Errorf("ReadKey: %s %v", raw, err)
+	}
+
+	if _, err := c.CreatePoint("p1", "bob"); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreatePoint twice: %v", err)
+	}
+	if _, err := c.TransferPoint("p9", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("TransferPoint of a missing point: %v", err)
+	}
+	if _, err := c.DeletePoint("p1"); !errors.Is(err, ErrNoPermission) { //the stub caller has no admin role
+		t.Errorf("DeletePoint without the admin role: %v", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	c := newStubClient(t)
+	specs, err := c.Describe()
+	if err != nil || len(specs) == 0 {
+		t.Fatalf("Describe: %v %v", specs, err)
+	}
+	for _, f := range specs {
+		if f.Name == "findLatest" && (len(f.Args) != 2 || f.Args[0].Name != "SELLER_ID") {
+			t.Errorf("findLatest spec %+v", f)
+		}
+	}
+}
+
+func TestAcknowledgedInvoke(t *testing.T) {
+	c := New(ackTransport{})
+	txID, err := c.CreatePoint("p1", "bob")
+	if err != nil || txID != "uuid-1" {
+		t.Errorf("CreatePoint through a peer that only acknowledges: %s %v", txID, err)
+	}
+	if err := c.Query(nil, "describe"); err == nil {
+		t.Error("garbage envelope accepted")
+	}
+}
+
+func TestEmptyAnswer(t *testing.T) {
+	c := New(emptyTransport{})
+	if r, err := c.Reconciliation("1", "t1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Reconciliation from an empty answer: %+v %v", r, err)
+	}
+	if e, err := c.Erasure("1", "t1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Erasure from an empty answer: %+v %v", e, err)
+	}
+}
+
+// ackTransport is a peer that only acknowledges invocations and answers garbage to queries
+type ackTransport struct{}
+
+func (ackTransport) Invoke(function string, args []string) (string, []byte, error) {
+	return "uuid-1", nil, nil
+}
+
+func (ackTransport) Query(function string, args []string) ([]byte, error) {
+	return []byte("Error: chaincode not found"), nil
+}
+
+// emptyTransport answers every query with an enquiry ok and no content
+type emptyTransport struct{}
+
+func (emptyTransport) Invoke(function string, args []string) (string, []byte, error) {
+	return "uuid-1", nil, nil
+}
+
+func (emptyTransport) Query(function string, args []string) ([]byte, error) {
+	return []byte(`{"respond":300,"msg":"ok","content":{}}`), nil
+}
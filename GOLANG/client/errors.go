@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+)
+
+// The chaincode's response codes as Go errors, test them with errors.Is
+var (
+	ErrNoPermission = errors.New("ccpx: no permission")
+	ErrValidation   = errors.New("ccpx: validation between nodes failed")
+	ErrNotFound     = errors.New("ccpx: no records")
+	ErrInvalidArgs  = errors.New("ccpx: parameter error")
+	ErrConflict     = errors.New("ccpx: conflicts with the ledger")
+	ErrLedger       = errors.New("ccpx: ledger error")
+	ErrInit         = errors.New("ccpx: init error")
+)
+
+// Error is a call the chaincode answered with a failure code
+type Error struct {
+	Function string
+	Code     int    //CCPX response code, see chaincode.Code*
+	Message  string //the chaincode's own message
+}
+
+func (e *Error) Error() string {
+	return "ccpx: " + e.Function + ": " + strconv.Itoa(e.Code) + " " + e.Message
+}
+
+// Is makes errors.Is(err, ErrNotFound) and friends work on the code
+func (e *Error) Is(target error) bool {
+	switch e.Code {
+	case chaincode.CodeNoPermissionRecord, chaincode.CodeNoPermissionEnquiry:
+		return target == ErrNoPermission
+	case chaincode.CodeValidationFailed:
+		return target == ErrValidation
+	case chaincode.CodeNoRecords:
+		return target == ErrNotFound
+	case chaincode.CodeParamError:
+		return target == ErrInvalidArgs
+	case chaincode.CodeConflict:
+		return target == ErrConflict
+	case chaincode.CodeLedgerError:
+		return target == ErrLedger
+	case chaincode.CodeInitError:
+		return target == ErrInit
+	}
+	return false
+}
+
+// Code returns the CCPX response code of a failed call, or 0 when err did not come from the chaincode
+func Code(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
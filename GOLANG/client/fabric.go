@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/gateway"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FabricTransport calls the chaincode through the Gateway gRPC service of a
+// Fabric 2.4 or later peer, signing every proposal and transaction as the
+// identity of MSPID with Cert and Key, the way the Fabric Gateway SDKs do.
+// Queries are evaluated on one peer. Invocations are endorsed, signed,
+// submitted and waited for, Invoke returns once the transaction committed
+// valid, with the envelope the chaincode answered.
+type FabricTransport struct {
+	Conn      *grpc.ClientConn
+	Channel   string
+	Chaincode string //name the chaincode was committed under
+	MSPID     string
+	Cert      []byte //PEM certificate of the identity
+	Key       *ecdsa.PrivateKey
+	Timeout   time.Duration //of each call and of the wait for a commit, default 30s
+}
+
+// DialFabric connects to the Gateway service of the peer at addr (host:port),
+// over TLS when tlsCA names the PEM file of the CA of the peer's TLS
+// certificate. The connection is made lazily, on the first call.
+func DialFabric(addr string, tlsCA string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if tlsCA != "" {
+		raw, err := os.ReadFile(tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, errors.New(tlsCA + ": no PEM certificate")
+		}
+		creds = credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	}
+	return grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+}
+
+// OpenFabric dials the peer at addr, see DialFabric, and returns a transport
+// calling chaincode on channel as the identity of mspID whose certificate and
+// private key are the PEM files certFile and keyFile
+func OpenFabric(addr string, tlsCA string, channel string, chaincode string, mspID string, certFile string, keyFile string) (*FabricTransport, error) {
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ReadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := DialFabric(addr, tlsCA)
+	if err != nil {
+		return nil, err
+	}
+	return &FabricTransport{Conn: conn, Channel: channel, Chaincode: chaincode, MSPID: mspID, Cert: cert, Key: key}, nil
+}
+
+// ReadPrivateKey reads an ECDSA private key, PEM in SEC 1 or PKCS #8 form
+func ReadPrivateKey(file string) (*ecdsa.PrivateKey, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New(file + ": not PEM")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New(file + ": not an ECDSA key")
+	}
+	return ec, nil
+}
+
+// Query evaluates function on a peer, the chaincode answers queries with the envelope
+func (c *FabricTransport) Query(function string, args []string) ([]byte, error) {
+	txID, proposal, err := c.propose(function, args)
+	if err != nil {
+		return nil, errors.New(function + ": " + err.Error())
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := gateway.NewGatewayClient(c.Conn).Evaluate(ctx, &gateway.EvaluateRequest{TransactionId: txID, ChannelId: c.Channel, ProposedTransaction: proposal})
+	if env := fabricEnvelope(err); env != nil {
+		return env, nil
+	}
+	if err != nil {
+		return nil, errors.New(function + ": " + status.Convert(err).Message())
+	}
+	return res.GetResult().GetPayload(), nil
+}
+
+// Invoke endorses function, signs and submits the transaction and waits for its commit
+func (c *FabricTransport) Invoke(function string, args []string) (string, []byte, error) {
+	txID, proposal, err := c.propose(function, args)
+	if err != nil {
+		return "", nil, errors.New(function + ": " + err.Error())
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	gw := gateway.NewGatewayClient(c.Conn)
+	endorsed, err := gw.Endorse(ctx, &gateway.EndorseRequest{TransactionId: txID, ChannelId: c.Channel, ProposedTransaction: proposal})
+	if env := fabricEnvelope(err); env != nil {
+		return txID, env, nil //refused by the chaincode, nothing was submitted
+	}
+	if err != nil {
+		return "", nil, errors.New(function + ": " + status.Convert(err).Message())
+	}
+	tx := endorsed.GetPreparedTransaction()
+	envelope, err := endorsedPayload(tx)
+	if err != nil {
+		return "", nil, errors.New(function + ": " + err.Error())
+	}
+	if tx.Signature, err = c.sign(tx.Payload); err != nil {
+		return "", nil, errors.New(function + ": " + err.Error())
+	}
+	if _, err := gw.Submit(ctx, &gateway.SubmitRequest{TransactionId: txID, ChannelId: c.Channel, PreparedTransaction: tx}); err != nil {
+		return "", nil, errors.New(function + ": " + status.Convert(err).Message())
+	}
+
+	creator, _ := c.creator()
+	req, _ := proto.Marshal(&gateway.CommitStatusRequest{TransactionId: txID, ChannelId: c.Channel, Identity: creator})
+	sig, err := c.sign(req)
+	if err != nil {
+		return "", nil, errors.New(function + ": " + err.Error())
+	}
+	committed, err := gw.CommitStatus(ctx, &gateway.SignedCommitStatusRequest{Request: req, Signature: sig})
+	if err != nil {
+		return txID, nil, fmt.Errorf("%s: transaction %s submitted, commit unknown: %s", function, txID, status.Convert(err).Message())
+	}
+	if committed.Result != pb.TxValidationCode_VALID {
+		return txID, nil, fmt.Errorf("%s: transaction %s not committed: %s", function, txID, committed.Result)
+	}
+	return txID, envelope, nil
+}
+
+func (c *FabricTransport) context() (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// creator is the serialized identity the peer checks the signatures against
+func (c *FabricTransport) creator() ([]byte, error) {
+	return proto.Marshal(&msp.SerializedIdentity{Mspid: c.MSPID, IdBytes: c.Cert})
+}
+
+// propose builds the signed proposal to call function, and the transaction id the peer derives from it
+func (c *FabricTransport) propose(function string, args []string) (string, *pb.SignedProposal, error) {
+	if c.Conn == nil || c.Key == nil || len(c.Cert) == 0 {
+		return "", nil, errors.New("no connection or identity")
+	}
+	creator, err := c.creator()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(append(nonce, creator...))
+	txID := hex.EncodeToString(sum[:])
+
+	ccID := &pb.ChaincodeID{Name: c.Chaincode}
+	ext, _ := proto.Marshal(&pb.ChaincodeHeaderExtension{ChaincodeId: ccID})
+	chHeader, _ := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), ChannelId: c.Channel,
+		TxId: txID, Timestamp: timestamppb.Now(), Extension: ext})
+	sigHeader, _ := proto.Marshal(&common.SignatureHeader{Creator: creator, Nonce: nonce})
+	header, _ := proto.Marshal(&common.Header{ChannelHeader: chHeader, SignatureHeader: sigHeader})
+
+	input := &pb.ChaincodeInput{Args: [][]byte{[]byte(function)}}
+	for _, a := range args {
+		input.Args = append(input.Args, []byte(a))
+	}
+	spec, _ := proto.Marshal(&pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeId: ccID, Input: input}})
+	payload, _ := proto.Marshal(&pb.ChaincodeProposalPayload{Input: spec})
+	proposal, err := proto.Marshal(&pb.Proposal{Header: header, Payload: payload})
+	if err != nil {
+		return "", nil, err
+	}
+	sig, err := c.sign(proposal)
+	if err != nil {
+		return "", nil, err
+	}
+	return txID, &pb.SignedProposal{ProposalBytes: proposal, Signature: sig}, nil
+}
+
+// sign is the ASN.1 ECDSA signature of the SHA-256 of msg, with the low S Fabric requires
+func (c *FabricTransport) sign(msg []byte) ([]byte, error) {
+	h := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, c.Key, h[:])
+	if err != nil {
+		return nil, err
+	}
+	if half := new(big.Int).Rsh(c.Key.Params().N, 1); s.Cmp(half) > 0 {
+		s.Sub(c.Key.Params().N, s)
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+}
+
+// endorsedPayload is what the chaincode answered, from the transaction the peers endorsed
+func endorsedPayload(tx *common.Envelope) ([]byte, error) {
+	var payload common.Payload
+	var trans pb.Transaction
+	var action pb.ChaincodeActionPayload
+	var prp pb.ProposalResponsePayload
+	var cc pb.ChaincodeAction
+	if tx == nil {
+		return nil, errors.New("no endorsed transaction")
+	}
+	if err := proto.Unmarshal(tx.Payload, &payload); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(payload.Data, &trans); err != nil || len(trans.Actions) == 0 {
+		return nil, errors.New("endorsed transaction without actions")
+	}
+	if err := proto.Unmarshal(trans.Actions[0].Payload, &action); err != nil || action.Action == nil {
+		return nil, errors.New("endorsed transaction without a chaincode action")
+	}
+	if err := proto.Unmarshal(action.Action.ProposalResponsePayload, &prp); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(prp.Extension, &cc); err != nil {
+		return nil, err
+	}
+	return cc.GetResponse().GetPayload(), nil
+}
+
+// fabricEnvelope is the chaincode's envelope when it refused a call. The
+// gateway passes the message of the chaincode's error response on in the
+// details of its error, as "chaincode response 500, <message>", and the
+// chaincode puts its envelope in that message.
+func fabricEnvelope(err error) []byte {
+	if err == nil {
+		return nil
+	}
+	for _, d := range status.Convert(err).Details() {
+		detail, ok := d.(*gateway.ErrorDetail)
+		if !ok {
+			continue
+		}
+		msg := detail.Message
+		if i := strings.Index(msg, "{"); i >= 0 {
+			msg = msg[i:]
+		}
+		var resp struct {
+			Code *int `json:"respond"`
+		}
+		if json.Unmarshal([]byte(msg), &resp) == nil && resp.Code != nil {
+			return []byte(msg)
+		}
+	}
+	return nil
+}
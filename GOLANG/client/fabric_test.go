@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/gateway"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeGateway serves the Gateway service the way a peer does for one
+// chaincode: it checks the signatures and transaction ids of the calls and
+// runs them on a shimtest stub as the identity that signed the proposal.
+type fakeGateway struct {
+	gateway.UnimplementedGatewayServer
+	stub      *shimtest.MockStub
+	submitted map[string]bool
+	invalid   bool //commit every transaction as an MVCC conflict
+}
+
+// verify checks that sig is a low S signature of msg by the certificate of creator
+func verify(creator []byte, msg []byte, sig []byte) error {
+	var id msp.SerializedIdentity
+	if err := proto.Unmarshal(creator, &id); err != nil {
+		return err
+	}
+	block, _ := pem.Decode(id.IdBytes)
+	if block == nil {
+		return errors.New("creator without a PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	key := cert.PublicKey.(*ecdsa.PublicKey)
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil || rs.S.Cmp(new(big.Int).Rsh(key.Params().N, 1)) > 0 {
+		return errors.New("signature not in low S form")
+	}
+	h := sha256.Sum256(msg)
+	if !ecdsa.VerifyASN1(key, h[:], sig) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// run checks a signed proposal and runs it, it returns the chaincode's response and the proposal header
+func (g *fakeGateway) run(txID string, channel string, sp *pb.SignedProposal) (*pb.Response, []byte, error) {
+	var prop pb.Proposal
+	var header common.Header
+	var ch common.ChannelHeader
+	var sh common.SignatureHeader
+	var payload pb.ChaincodeProposalPayload
+	var spec pb.ChaincodeInvocationSpec
+	proto.Unmarshal(sp.ProposalBytes, &prop)
+	proto.Unmarshal(prop.Header, &header)
+	proto.Unmarshal(header.ChannelHeader, &ch)
+	proto.Unmarshal(header.SignatureHeader, &sh)
+	proto.Unmarshal(prop.Payload, &payload)
+	proto.Unmarshal(payload.Input, &spec)
+	if err := verify(sh.Creator, sp.ProposalBytes, sp.Signature); err != nil {
+		return nil, nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	sum := sha256.Sum256(append(append([]byte{}, sh.Nonce...), sh.Creator...))
+	if id := hex.EncodeToString(sum[:]); id != txID || id != ch.TxId || ch.ChannelId != channel || channel != "ccpx" ||
+		ch.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) || spec.ChaincodeSpec.ChaincodeId.Name != "ccpx" {
+		return nil, nil, status.Error(codes.InvalidArgument, "bad proposal header")
+	}
+	g.stub.Creator = sh.Creator
+	res := g.stub.MockInvoke(txID, spec.ChaincodeSpec.Input.Args)
+	return &res, prop.Header, nil
+}
+
+func (g *fakeGateway) Evaluate(ctx context.Context, req *gateway.EvaluateRequest) (*gateway.EvaluateResponse, error) {
+	res, _, err := g.run(req.TransactionId, req.ChannelId, req.ProposedTransaction)
+	if err != nil {
+		return nil, err
+	}
+	return &gateway.EvaluateResponse{Result: res}, nil
+}
+
+func (g *fakeGateway) Endorse(ctx context.Context, req *gateway.EndorseRequest) (*gateway.EndorseResponse, error) {
+	res, header, err := g.run(req.TransactionId, req.ChannelId, req.ProposedTransaction)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status >= 400 {
+		st, _ := status.New(codes.Aborted, "failed to endorse transaction, see attached details for more info").
+			WithDetails(&gateway.ErrorDetail{Address: "peer0:7051", MspId: "CCPXMSP", Message: "chaincode response 500, " + res.Message})
+		return nil, st.Err()
+	}
+	ext, _ := proto.Marshal(&pb.ChaincodeAction{Response: res})
+	prp, _ := proto.Marshal(&pb.ProposalResponsePayload{Extension: ext})
+	action, _ := proto.Marshal(&pb.ChaincodeActionPayload{Action: &pb.ChaincodeEndorsedAction{ProposalResponsePayload: prp}})
+	tx, _ := proto.Marshal(&pb.Transaction{Actions: []*pb.TransactionAction{{Header: header, Payload: action}}})
+	payload, _ := proto.Marshal(&common.Payload{Header: &common.Header{}, Data: tx})
+	return &gateway.EndorseResponse{PreparedTransaction: &common.Envelope{Payload: payload}}, nil
+}
+
+func (g *fakeGateway) Submit(ctx context.Context, req *gateway.SubmitRequest) (*gateway.SubmitResponse, error) {
+	var payload common.Payload
+	var tx pb.Transaction
+	var sh common.SignatureHeader
+	proto.Unmarshal(req.PreparedTransaction.Payload, &payload)
+	proto.Unmarshal(payload.Data, &tx)
+	var header common.Header
+	proto.Unmarshal(tx.Actions[0].Header, &header)
+	proto.Unmarshal(header.SignatureHeader, &sh)
+	if err := verify(sh.Creator, req.PreparedTransaction.Payload, req.PreparedTransaction.Signature); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	g.submitted[req.TransactionId] = true
+	return &gateway.SubmitResponse{}, nil
+}
+
+func (g *fakeGateway) CommitStatus(ctx context.Context, req *gateway.SignedCommitStatusRequest) (*gateway.CommitStatusResponse, error) {
+	var csr gateway.CommitStatusRequest
+	proto.Unmarshal(req.Request, &csr)
+	if err := verify(csr.Identity, req.Request, req.Signature); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if !g.submitted[csr.TransactionId] {
+		return nil, status.Error(codes.NotFound, "no such transaction")
+	}
+	if g.invalid {
+		return &gateway.CommitStatusResponse{Result: pb.TxValidationCode_MVCC_READ_CONFLICT}, nil
+	}
+	return &gateway.CommitStatusResponse{Result: pb.TxValidationCode_VALID, BlockNumber: 7}, nil
+}
+
+// newFabricClient serves g on an in-memory listener and returns a transport to it signing as role
+func newFabricClient(t *testing.T, g *fakeGateway, role string) *FabricTransport {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	gateway.RegisterGatewayServer(srv, g)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	cert, key := identity(t, role)
+	return &FabricTransport{Conn: conn, Channel: "ccpx", Chaincode: "ccpx", MSPID: "CCPXMSP", Cert: cert, Key: key}
+}
+
+func TestFabricTransport(t *testing.T) {
+	g := &fakeGateway{stub: shimtest.NewMockStub("ccpx", new(chaincode.SimpleChaincode)), submitted: make(map[string]bool)}
+	g.stub.MockInit("deploy", [][]byte{[]byte("init"), []byte("99")})
+	admin := New(newFabricClient(t, g, "admin"))
+
+	if _, err := admin.Init(99); err != nil {
+		t.Fatalf("Init as admin: %v", err)
+	}
+	txID, err := admin.CreatePoint("p1", "bob")
+	if err != nil || !g.submitted[txID] {
+		t.Fatalf("CreatePoint: %s %v", txID, err)
+	}
+	points, err := admin.PointsOf("bob")
+	if err != nil || len(points) != 1 || points[0].Id != "p1" {
+		t.Errorf("PointsOf: %+v %v", points, err)
+	}
+
+	//refused by the chaincode: the envelope comes back in the error details and nothing is submitted
+	n := len(g.submitted)
+	if _, err := admin.CreatePoint("p1", "carol"); Code(err) != chaincode.CodeConflict || len(g.submitted) != n {
+		t.Errorf("conflict: %v, %d submitted", err, len(g.submitted)-n)
+	}
+
+	//the chaincode sees the identity that signed the proposal
+	member := New(newFabricClient(t, g, ""))
+	if _, err := member.Init(99); Code(err) != chaincode.CodeNoPermissionRecord {
+		t.Errorf("Init without the admin role: %v", err)
+	}
+	if _, err := member.PointsOf("bob"); err != nil {
+		t.Errorf("query without the admin role: %v", err)
+	}
+
+	g.invalid = true
+	if _, err := admin.TransferPoint("p1", "carol"); err == nil || !strings.Contains(err.Error(), "MVCC_READ_CONFLICT") {
+		t.Errorf("invalid commit: %v", err)
+	}
+}
+
+func TestFabricTransportErrors(t *testing.T) {
+	g := &fakeGateway{stub: shimtest.NewMockStub("ccpx", new(chaincode.SimpleChaincode)), submitted: make(map[string]bool)}
+	tr := newFabricClient(t, g, "admin")
+	tr.Chaincode = "other"
+	if _, err := New(tr).Describe(); err == nil || Code(err) != 0 || !strings.Contains(err.Error(), "bad proposal header") {
+		t.Errorf("peer error: %v", err)
+	}
+	if _, err := New(&FabricTransport{}).Describe(); err == nil {
+		t.Error("transport without a connection answered")
+	}
+	if env := fabricEnvelope(status.Error(codes.Aborted, `chaincode response 500, {"respond":500}`)); env != nil {
+		t.Errorf("envelope read from an error without details: %s", env)
+	}
+}
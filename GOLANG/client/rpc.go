@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+)
+
+// RPCTransport calls the chaincode Name through the REST /chaincode JSON-RPC
+// endpoint of a peer, the way the node server did through ibm-blockchain-js.
+// Only Fabric 0.6 peers and the simulator serve that endpoint, and only the
+// simulator runs the current chaincode; FabricTransport calls Fabric 2.4+ peers.
+type RPCTransport struct {
+	Peer *peer.Client
+	Name string //deployed chaincode name (hash)
+}
+
+// envelope is the chaincode's envelope when the peer passed it on as the data of
+// an error, as the simulator does for failed calls
+func envelope(err error) []byte {
+	var rpcErr *peer.Error
+	if !errors.As(err, &rpcErr) {
+		return nil
+	}
+	var resp struct {
+		Code *int `json:"respond"`
+	}
+	if json.Unmarshal([]byte(rpcErr.Data), &resp) != nil || resp.Code == nil {
+		return nil
+	}
+	return []byte(rpcErr.Data)
+}
+
+// Query runs a query, the peer answers with the envelope
+func (c *RPCTransport) Query(function string, args []string) ([]byte, error) {
+	msg, err := c.Peer.Query(c.Name, function, args)
+	if env := envelope(err); env != nil {
+		return env, nil
+	}
+	if err != nil {
+		return nil, errors.New(function + ": " + err.Error())
+	}
+	return []byte(msg), nil
+}
+
+// Invoke submits a transaction, the peer only answers with its id
+func (c *RPCTransport) Invoke(function string, args []string) (string, []byte, error) {
+	msg, err := c.Peer.Invoke(c.Name, function, args)
+	if env := envelope(err); env != nil {
+		return "", env, nil
+	}
+	if err != nil {
+		return "", nil, errors.New(function + ": " + err.Error())
+	}
+	return msg, nil, nil
+}
+
+// Deploy deploys the chaincode at path (a go import path or a zip url) and
+// runs init with args. It returns the name the peer gave the chaincode and
+// makes it the Name of the transport.
+func (c *RPCTransport) Deploy(path string, args []string) (string, error) {
+	name, err := c.Peer.Deploy(path, "init", args)
+	if err != nil {
+		return "", errors.New("init: " + err.Error())
+	}
+	c.Name = name
+	return name, nil
+}
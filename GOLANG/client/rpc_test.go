@@ -0,0 +1,66 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+)
+
+func TestRPCTransport(t *testing.T) {
+	var got struct {
+		Method string `json:"method"`
+		Params struct {
+			ChaincodeID   map[string]string   `json:"chaincodeID"`
+			CtorMsg       map[string][]string `json:"ctorMsg"`
+			SecureContext string              `json:"secureContext"`
+		} `json:"params"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		switch got.Params.CtorMsg["args"][0] {
+		case "findLatest":
+			io.WriteString(w, `{"jsonrpc":"2.0","result":{"status":"OK","message":"{\"respond\":401,\"msg\":\"No records\",\"content\":null}"},"id":1}`)
+		case "init_point":
+			io.WriteString(w, `{"jsonrpc":"2.0","result":{"status":"OK","message":"5c4d-uuid"},"id":2}`)
+		case "set_user":
+			io.WriteString(w, `{"jsonrpc":"2.0","error":{"code":-32002,"message":"Invoke failure","data":"{\"respond\":201,\"msg\":\"no such point\",\"content\":null}"},"id":3}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(&RPCTransport{Peer: &peer.Client{URL: srv.URL, EnrollID: "test_user0"}, Name: "abc123"})
+	if _, err := c.LatestExchanges("1", 5); Code(err) != chaincode.CodeNoRecords {
+		t.Errorf("query: %v", err)
+	}
+	if got.Method != "query" || got.Params.ChaincodeID["name"] != "abc123" || got.Params.SecureContext != "test_user0" || len(got.Params.CtorMsg["args"]) != 3 {
+		t.Errorf("request %+v", got)
+	}
+
+	txID, err := c.CreatePoint("p1", "bob")
+	if err != nil || txID != "5c4d-uuid" || got.Method != "invoke" {
+		t.Errorf("invoke: %s %v", txID, err)
+	}
+	if _, err := c.TransferPoint("p9", "bob"); !errors.Is(err, ErrValidation) {
+		t.Errorf("envelope in the error data: %v", err)
+	}
+}
+
+func TestRPCTransportErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"jsonrpc":"2.0","error":{"code":-32003,"message":"Query failure","data":"chaincode not found"},"id":1}`)
+	}))
+	c := New(&RPCTransport{Peer: &peer.Client{URL: srv.URL}, Name: "abc123"})
+	if _, err := c.Describe(); err == nil || Code(err) != 0 {
+		t.Errorf("peer error: %v", err)
+	}
+	srv.Close()
+	if _, err := c.Describe(); err == nil {
+		t.Error("closed peer answered")
+	}
+}
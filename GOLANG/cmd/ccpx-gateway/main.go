@@ -0,0 +1,75 @@
+// Command ccpx-gateway serves the seller webservice (/getLatExRec, /getToExPo,
+// /responseStore, ...) on top of the CCPX chaincode of a peer.
+//
+// With -fabric it calls the chaincode committed on a Fabric 2.4+ peer through
+// the peer's Gateway service, signing as the identity of -msp-id, -cert and
+// -key. Otherwise it calls the REST interface of -peer; without -name it calls
+// the chaincode of the manifest ccpxctl deploy wrote, and follows it when the
+// chaincode is deployed again.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/deploy"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/gateway"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to serve the webservice on")
+	fabric := flag.String("fabric", "", "host:port of the Gateway service of a Fabric 2.4+ peer, the calls go there instead of -peer")
+	channel := flag.String("channel", "mychannel", "channel the chaincode is committed on, with -fabric")
+	mspID := flag.String("msp-id", "", "MSP id of the identity the calls are signed as, with -fabric")
+	cert := flag.String("cert", "", "PEM certificate of that identity")
+	key := flag.String("key", "", "PEM private key of that identity")
+	tlsCA := flag.String("tls-ca", "", "PEM certificate of the CA of the peer's TLS certificate, plaintext without it")
+	peerURL := flag.String("peer", "http://172.17.0.2:7050", "REST address of the peer")
+	name := flag.String("name", "", `deployed chaincode name (hash), default the one of the manifest, "ccpx" with -fabric`)
+	manifest := flag.String("manifest", deploy.DefaultManifest, "deployment manifest written by ccpxctl deploy")
+	user := flag.String("user", "test_user0", "enrollment id the calls are made with")
+	secret := flag.String("secret", "", "enrollment secret, logs the user in first when set")
+	retries := flag.Int("retries", 2, "how many times a call the peer failed is tried again")
+	tz := flag.String("tz", "Local", `time zone of the sellers: "Local", an IANA name or an offset like "+08:00"`)
+	keys := flag.String("pseudonym-keys", "", `JSON file of the sellers' pseudonym secrets, {"1":"<base64>"}; their members are recorded as pseudonyms. The gateway operator can resolve the members of every seller in it, only list sellers that trust the operator`)
+	flag.Parse()
+
+	loc, err := gateway.ParseZone(*tz)
+	if err != nil {
+		log.Fatalf("bad -tz: %v", err)
+	}
+	p := &peer.Client{URL: *peerURL, EnrollID: *user, EnrollSecret: *secret, Retries: *retries}
+	var cc *client.Client
+	if *fabric != "" {
+		if *name == "" {
+			*name = "ccpx"
+		}
+		ft, err := client.OpenFabric(*fabric, *tlsCA, *channel, *name, *mspID, *cert, *key)
+		if err != nil {
+			log.Fatalf("cannot reach the Fabric peer: %v", err)
+		}
+		cc = client.New(ft)
+	} else if *name != "" {
+		cc = client.New(&client.RPCTransport{Peer: p, Name: *name})
+	} else {
+		tracker := &deploy.Tracker{Peer: p, Path: *manifest}
+		if _, err := tracker.Name(); err != nil {
+			log.Printf("no chaincode yet, calls answer 502 until ccpxctl deploy writes the manifest: %v", err)
+		}
+		cc = client.New(tracker)
+	}
+	srv := gateway.New(cc, loc)
+	if *keys != "" {
+		k, err := pseudonym.ReadKeys(*keys)
+		if err != nil {
+			log.Fatalf("bad -pseudonym-keys: %v", err)
+		}
+		srv.SetPseudonymKeys(k)
+	}
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, srv))
+}
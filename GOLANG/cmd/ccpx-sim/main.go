@@ -0,0 +1,56 @@
+// Command ccpx-sim runs the CCPX chaincode on a local ledger simulator that
+// serves the REST interface of a peer, so the gateway and ccpxctl can run
+// without a Fabric network during development:
+//
+//	ccpx-sim -data ./ccpx-sim -users test_user0=secret &
+//	ccpxctl -peer http://localhost:7050 -secret secret deploy
+//	ccpx-gateway -peer http://localhost:7050 -secret secret
+//
+// It has no membership service: the enrollment ids of -users log in at its
+// registrar with their secret, and a call is made as the id it names when
+// that id logged in from the caller's host. It listens on localhost unless
+// -listen says otherwise.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/simulator"
+)
+
+func main() {
+	listen := flag.String("listen", "localhost:7050", "address to serve the peer REST interface on")
+	data := flag.String("data", "ccpx-sim", `directory the ledger is kept in, "" keeps it in memory`)
+	users := flag.String("users", "", "comma separated id=secret enrollment ids that may log in and call the chaincode")
+	admins := flag.String("admin", "test_user0", "comma separated enrollment ids that get the admin role")
+	flag.Parse()
+
+	l, err := simulator.Open(*data, new(chaincode.SimpleChaincode))
+	if err != nil {
+		log.Fatalf("cannot open the ledger: %v", err)
+	}
+	defer l.Close()
+	registered := 0
+	for _, user := range strings.Split(*users, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(user), "=")
+		if !ok || id == "" || secret == "" {
+			continue
+		}
+		l.SetSecret(id, secret)
+		registered++
+	}
+	if registered == 0 {
+		log.Fatal("no enrollment ids, -users id=secret,... registers those that may call the chaincode")
+	}
+	for _, id := range strings.Split(*admins, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			l.SetAttributes(id, map[string]string{"role": "admin"})
+		}
+	}
+	log.Printf("ledger %q at height %d, listening on %s", *data, l.Height(), *listen)
+	log.Fatal(http.ListenAndServe(*listen, l.Handler()))
+}
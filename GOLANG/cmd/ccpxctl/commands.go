@@ -0,0 +1,852 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/deploy"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/export"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/merkle"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+)
+
+// defaultPath is where the peer fetches the chaincode from
+const defaultPath = "https://github.com/CCPX-system/CCPX-blockchain/raw/master/GOLANG/ccpx/ccpx.zip"
+
+// legacyPath is the zip of the Fabric 0.6 chaincode, what a 0.6 peer can build
+const legacyPath = "https://github.com/CCPX-system/CCPX-blockchain/raw/master/GOLANG/legacy/ccpx06/ccpx.zip"
+
+func pack(e *env, args []string) error {
+	fs := newFlags("package")
+	out := fs.String("o", "", "zip to write, default ccpx/ccpx.zip of the module")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 0, 1); err != nil {
+		return err
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+	if *out == "" {
+		*out = filepath.Join(dir, "ccpx", "ccpx.zip")
+	}
+	build := exec.Command("go", "build", "-o", os.DevNull, "./ccpx")
+	build.Dir = dir
+	if msg, err := build.CombinedOutput(); err != nil {
+		return fmt.Errorf("the chaincode does not build: %v\n%s", err, msg)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	sum, err := deploy.Package(dir, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return e.print(map[string]string{"zip": *out, "sha256": sum})
+}
+
+func deployCC(e *env, args []string) error {
+	fs := newFlags("deploy")
+	path := fs.String("path", defaultPath, "go import path or zip url of the chaincode")
+	zipFile := fs.String("zip", "", "local copy of the zip at -path, its checksum goes in the manifest")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for the chaincode to answer")
+	legacy := fs.Bool("legacy", false, "deploy the Fabric 0.6 chaincode on a 0.6 peer, only waits for the deployment to commit")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 0, 1); err != nil {
+		return err
+	}
+	abc := "99"
+	if fs.NArg() == 1 {
+		abc = fs.Arg(0)
+	}
+	var sum string
+	if *zipFile != "" {
+		raw, err := os.ReadFile(*zipFile)
+		if err != nil {
+			return err
+		}
+		sum = fmt.Sprintf("%x", sha256.Sum256(raw))
+	}
+	run := deploy.Run
+	if *legacy {
+		run = deploy.RunLegacy
+		if *path == defaultPath {
+			*path = legacyPath
+		}
+	}
+	if e.fabric != nil {
+		return errors.New("a Fabric peer installs and commits the chaincode with the peer lifecycle commands, see deploy/fabric.sh")
+	}
+	m, err := run(e.rpc.Peer, *path, []string{abc}, 2*time.Second, *timeout)
+	if err != nil {
+		return err
+	}
+	m.Package = sum
+	if err := m.Write(e.manifest); err != nil {
+		return err
+	}
+	e.rpc.Name = m.Name
+	return e.print(m)
+}
+
+func initState(e *env, args []string) error {
+	if err := wantArgs(args, 0, 1); err != nil {
+		return err
+	}
+	abc := 99
+	if len(args) == 1 {
+		var err error
+		if abc, err = strconv.Atoi(args[0]); err != nil {
+			return usageError("abc must be a number")
+		}
+	}
+	txID, err := e.cc.Init(abc)
+	if err != nil {
+		return err
+	}
+	return e.print(map[string]string{"txID": txID})
+}
+
+func record(e *env, args []string) error {
+	fs := newFlags("record")
+	var ex client.Exchange
+	fs.StringVar(&ex.ID, "id", "", "exchange id")
+	fs.StringVar(&ex.UserA, "user-a", "", "member giving points of seller A")
+	fs.StringVar(&ex.UserB, "user-b", "", "member giving points of seller B")
+	fs.StringVar(&ex.SellerA, "seller-a", "", "seller A")
+	fs.StringVar(&ex.SellerB, "seller-b", "", "seller B")
+	fs.IntVar(&ex.PointsA, "points-a", 0, "points of seller A")
+	fs.IntVar(&ex.PointsB, "points-b", 0, "points of seller B")
+	at := fs.String("time", "", "time of the exchange, default now")
+	fs.StringVar(&ex.Nonce, "nonce", "", "nonce of a signed exchange, default a random one")
+	signA := fs.String("sign-a", "", "PEM file of the ECDSA private key seller A signs with")
+	signB := fs.String("sign-b", "", "PEM file of the ECDSA private key seller B signs with")
+	var giveA, giveB listFlag
+	fs.Var(&giveA, "give-a", "id of a point member A hands over with the exchange, once per point")
+	fs.Var(&giveB, "give-b", "id of a point member B hands over with the exchange, once per point")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 0, 0); err != nil {
+		return err
+	}
+	for _, id := range giveA {
+		ex.Related = append(ex.Related, client.Point{Id: id, Owner: ex.UserA})
+	}
+	for _, id := range giveB {
+		ex.Related = append(ex.Related, client.Point{Id: id, Owner: ex.UserB})
+	}
+	ex.Time = time.Now()
+	if *at != "" {
+		var err error
+		if ex.Time, err = parseTime(*at); err != nil {
+			return err
+		}
+	}
+	if (*signA != "" || *signB != "") && ex.Nonce == "" {
+		var err error
+		if ex.Nonce, err = randomNonce(); err != nil {
+			return err
+		}
+	}
+	for _, sign := range []struct {
+		file string
+		sig  *string
+	}{{*signA, &ex.SignatureA}, {*signB, &ex.SignatureB}} {
+		if sign.file == "" {
+			continue
+		}
+		key, err := client.ReadPrivateKey(sign.file)
+		if err != nil {
+			return err
+		}
+		if *sign.sig, err = ex.Sign(key); err != nil {
+			return err
+		}
+	}
+	txID, err := e.cc.RecordExchange(ex)
+	if err != nil {
+		return err
+	}
+	return e.print(map[string]string{"txID": txID})
+}
+
+// randomNonce is the nonce of a signed exchange when none is given
+func randomNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// listFlag collects the values of a flag given several times
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func ring(e *env, args []string) error {
+	fs := newFlags("ring")
+	var r client.Ring
+	fs.StringVar(&r.ID, "id", "", "exchange id")
+	at := fs.String("time", "", "time of the exchange, default now")
+	fs.StringVar(&r.Nonce, "nonce", "", "nonce of a signed exchange, default a random one")
+	var signs listFlag
+	fs.Var(&signs, "sign", "seller=PEM file of the ECDSA private key the seller signs with, once per signing seller")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if r.ID == "" || fs.NArg() < 2 {
+		return usageError("-id and at least two legs user:seller:points-in:points-out are required")
+	}
+	for _, v := range fs.Args() {
+		f := strings.Split(v, ":")
+		if len(f) != 4 {
+			return usageError("leg " + v + " is not user:seller:points-in:points-out")
+		}
+		in, err1 := strconv.Atoi(f[2])
+		out, err2 := strconv.Atoi(f[3])
+		if err1 != nil || err2 != nil {
+			return usageError("the points of leg " + v + " must be numbers")
+		}
+		r.Legs = append(r.Legs, client.RingLeg{User: f[0], Seller: f[1], PointsIn: in, PointsOut: out})
+	}
+	r.Time = time.Now()
+	if *at != "" {
+		var err error
+		if r.Time, err = parseTime(*at); err != nil {
+			return err
+		}
+	}
+	if len(signs) > 0 && r.Nonce == "" {
+		var err error
+		if r.Nonce, err = randomNonce(); err != nil {
+			return err
+		}
+	}
+	for _, v := range signs {
+		seller, file, ok := strings.Cut(v, "=")
+		if !ok {
+			return usageError("-sign " + v + " is not seller=file")
+		}
+		key, err := client.ReadPrivateKey(file)
+		if err != nil {
+			return err
+		}
+		if r.Signatures == nil {
+			r.Signatures = make(map[string]string)
+		}
+		if r.Signatures[seller], err = r.Sign(key); err != nil {
+			return err
+		}
+	}
+	txID, err := e.cc.RecordRing(r)
+	if err != nil {
+		return err
+	}
+	return e.print(map[string]string{"txID": txID})
+}
+
+// members reads the members of seller as the ledger holds them, their pseudonyms when keys is set
+func members(keys string, seller string, users ...*string) error {
+	if keys == "" {
+		return nil
+	}
+	k, err := pseudonym.ReadKeys(keys)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if *user, err = k.Pseudonym(seller, *user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func credit(e *env, args []string) error {
+	fs := newFlags("credit")
+	keys := fs.String("keys", "", "JSON file of the sellers' pseudonym secrets, credits the pseudonym of the member")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 3, 3); err != nil {
+		return err
+	}
+	seller, user := fs.Arg(0), fs.Arg(1)
+	points, err := strconv.Atoi(fs.Arg(2))
+	if err != nil {
+		return usageError("points must be a number")
+	}
+	if err := members(*keys, seller, &user); err != nil {
+		return err
+	}
+	bal, txID, err := e.cc.CreditMember(seller, user, points)
+	if err != nil {
+		return err
+	}
+	if bal == nil {
+		return e.print(map[string]string{"txID": txID})
+	}
+	return e.print(bal)
+}
+
+func transfer(e *env, args []string) error {
+	fs := newFlags("transfer")
+	var tr client.Transfer
+	signWith := fs.String("sign", "", "PEM file of the ECDSA private key the sending member signs with")
+	fs.StringVar(&tr.Nonce, "nonce", "", "nonce of the transfer, default a random one")
+	keys := fs.String("keys", "", "JSON file of the sellers' pseudonym secrets, transfers between the pseudonyms of the members")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 4, 4); err != nil {
+		return err
+	}
+	if *signWith == "" {
+		return usageError("-sign is required, the sending member authorises every transfer")
+	}
+	tr.Seller, tr.From, tr.To = fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	var err error
+	if tr.Points, err = strconv.Atoi(fs.Arg(3)); err != nil {
+		return usageError("points must be a number")
+	}
+	if err := members(*keys, tr.Seller, &tr.From, &tr.To); err != nil {
+		return err
+	}
+	if tr.Nonce == "" {
+		if tr.Nonce, err = randomNonce(); err != nil {
+			return err
+		}
+	}
+	key, err := client.ReadPrivateKey(*signWith)
+	if err != nil {
+		return err
+	}
+	if tr.Signature, err = tr.Sign(key); err != nil {
+		return err
+	}
+	res, txID, err := e.cc.RecordTransfer(tr)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return e.print(map[string]string{"txID": txID})
+	}
+	return e.print(res)
+}
+
+func query(e *env, args []string) error {
+	if len(args) == 0 {
+		return usageError("missing latest, range or aggregate")
+	}
+	switch args[0] {
+	case "latest":
+		if err := wantArgs(args[1:], 2, 2); err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil {
+			return usageError("n must be a number")
+		}
+		txs, err := e.cc.LatestExchanges(args[1], n)
+		if err != nil {
+			return err
+		}
+		return e.print(txs)
+	case "range":
+		if err := wantArgs(args[1:], 3, 3); err != nil {
+			return err
+		}
+		from, to, err := parseTimes(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		txs, err := e.cc.ExchangesInRange(args[1], from, to)
+		if err != nil {
+			return err
+		}
+		return e.print(txs)
+	case "aggregate":
+		if err := wantArgs(args[1:], 4, 5); err != nil {
+			return err
+		}
+		from, to, err := parseTimes(args[3], args[4])
+		if err != nil {
+			return err
+		}
+		partner := ""
+		if len(args) == 6 {
+			partner = args[5]
+		}
+		aggs, err := e.cc.Aggregates(args[1], args[2], from, to, partner)
+		if err != nil {
+			return err
+		}
+		return e.print(aggs)
+	}
+	return usageError("unknown query " + args[0])
+}
+
+func points(e *env, args []string) error {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return err
+	}
+	points, err := e.cc.PointsOf(args[0])
+	if err != nil {
+		return err
+	}
+	return e.print(points)
+}
+
+func history(e *env, args []string) error {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return err
+	}
+	hist, err := e.cc.PointHistory(args[0])
+	if err != nil {
+		return err
+	}
+	return e.print(hist.History)
+}
+
+// keyValue is one raw key of the state
+type keyValue struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func read(e *env, args []string) error {
+	if err := wantArgs(args, 1, 1<<16); err != nil {
+		return err
+	}
+	var kvs []keyValue
+	for _, key := range args {
+		raw, err := e.cc.ReadKey(key)
+		if errors.Is(err, client.ErrNotFound) {
+			raw = json.RawMessage("null")
+		} else if err != nil {
+			return err
+		}
+		kvs = append(kvs, keyValue{Key: key, Value: raw})
+	}
+	return e.print(kvs)
+}
+
+// ledger is what export dumps
+type ledger struct {
+	Points    []client.Point       `json:"points"`
+	Exchanges []client.Transaction `json:"exchanges"`
+}
+
+func exportLedger(e *env, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+	var l ledger
+	ids, err := e.cc.PointIDs()
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+	for _, id := range ids {
+		p, err := e.cc.Point(id)
+		if err != nil {
+			return err
+		}
+		l.Points = append(l.Points, *p)
+	}
+	l.Exchanges, err = e.cc.Exchanges()
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+	if e.format == "table" {
+		if err := e.print(l.Points); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.out)
+		return e.print(l.Exchanges)
+	}
+	return e.print(l)
+}
+
+// exported is what exchanges prints
+type exported struct {
+	File   string `json:"file"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+func exchanges(e *env, args []string) error {
+	fs := newFlags("exchanges")
+	seller := fs.String("seller", "", "seller whose exchanges to export")
+	from := fs.String("from", "", "first time of the period")
+	to := fs.String("to", "", "last time of the period")
+	format := fs.String("format", export.CSV, "csv or ndjson")
+	out := fs.String("out", "", "file to write, default ccpx-<seller>-<from>-<to>.<format>")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 0, 0); err != nil {
+		return err
+	}
+	if *seller == "" || *from == "" || *to == "" {
+		return usageError("-seller, -from and -to are required")
+	}
+	f, t, err := parseTimes(*from, *to)
+	if err != nil {
+		return err
+	}
+	if *format != export.CSV && *format != export.NDJSON {
+		return usageError("-format must be csv or ndjson")
+	}
+	txs, err := e.cc.ExchangesInRange(*seller, f, t)
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+	if *out == "" {
+		*out = export.Filename(*seller, f, t, *format)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	ew, err := export.NewWriter(file, *format)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err := ew.Write(tx); err != nil {
+			return err
+		}
+	}
+	sum, err := ew.Close()
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out+".sha256", []byte(export.ChecksumLine(sum, filepath.Base(*out))), 0644); err != nil {
+		return err
+	}
+	return e.print(exported{File: *out, Rows: ew.Rows(), SHA256: sum})
+}
+
+func sellerKey(e *env, args []string) error {
+	if err := wantArgs(args, 1, 2); err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		sk, err := e.cc.SellerKey(args[0])
+		if err != nil {
+			return err
+		}
+		return e.print(sk)
+	}
+	raw, err := os.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+	txID, err := e.cc.RegisterSellerKey(args[0], string(raw))
+	if err != nil {
+		return err
+	}
+	return e.print(map[string]string{"txID": txID})
+}
+
+func memberKey(e *env, args []string) error {
+	fs := newFlags("member-key")
+	signWith := fs.String("sign", "", "PEM file of the member's current private key, required to replace it")
+	keys := fs.String("keys", "", "JSON file of the sellers' pseudonym secrets, the key of the pseudonym of the member")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 2, 3); err != nil {
+		return err
+	}
+	seller, user := fs.Arg(0), fs.Arg(1)
+	if err := members(*keys, seller, &user); err != nil {
+		return err
+	}
+	if fs.NArg() == 2 {
+		mk, err := e.cc.MemberKey(seller, user)
+		if err != nil {
+			return err
+		}
+		return e.print(mk)
+	}
+	raw, err := os.ReadFile(fs.Arg(2))
+	if err != nil {
+		return err
+	}
+	var old *ecdsa.PrivateKey
+	if *signWith != "" {
+		if old, err = client.ReadPrivateKey(*signWith); err != nil {
+			return err
+		}
+	}
+	txID, err := e.cc.RegisterMemberKey(seller, user, string(raw), old)
+	if err != nil {
+		return err
+	}
+	return e.print(map[string]string{"txID": txID})
+}
+
+func erase(e *env, args []string) error {
+	fs := newFlags("erase")
+	keys := fs.String("keys", "", "JSON file of the sellers' pseudonym secrets, erases the pseudonym of the member")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 2, 2); err != nil {
+		return err
+	}
+	seller, user := fs.Arg(0), fs.Arg(1)
+	if err := members(*keys, seller, &user); err != nil {
+		return err
+	}
+	erasure, txID, err := e.cc.EraseMember(seller, user)
+	if err != nil {
+		return err
+	}
+	if erasure == nil {
+		return e.print(map[string]string{"txID": txID})
+	}
+	return e.print(erasure)
+}
+
+// memberPseudonym is one row of what pseudonym prints
+type memberPseudonym struct {
+	User      string `json:"user"`
+	Pseudonym string `json:"pseudonym"`
+}
+
+func pseudonyms(e *env, args []string) error {
+	fs := newFlags("pseudonym")
+	keys := fs.String("keys", "", `JSON file of the sellers' pseudonym secrets, {"1":"<base64>"}`)
+	seller := fs.String("seller", "", "seller of the members")
+	newKey := fs.Bool("new-key", false, "print a fresh secret for a keys file instead")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if *newKey {
+		key, err := pseudonym.NewKey()
+		if err != nil {
+			return err
+		}
+		return e.print(map[string]string{"key": key})
+	}
+	if *keys == "" || *seller == "" || fs.NArg() == 0 {
+		return usageError("-keys, -seller and at least one member are required")
+	}
+	k, err := pseudonym.ReadKeys(*keys)
+	if err != nil {
+		return err
+	}
+	var rows []memberPseudonym
+	for _, user := range fs.Args() {
+		p, err := k.Pseudonym(*seller, user)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, memberPseudonym{User: user, Pseudonym: p})
+	}
+	return e.print(rows)
+}
+
+// checkedReceipt is what receipt and verify print
+type checkedReceipt struct {
+	Period string `json:"period"`
+	Index  uint64 `json:"index"`
+	Size   uint64 `json:"size"`
+	Root   string `json:"root"`
+	File   string `json:"file,omitempty"`
+	Erased string `json:"erased,omitempty"` //only the leaf is proven, the record lost its members
+}
+
+func receipt(e *env, args []string) error {
+	fs := newFlags("receipt")
+	out := fs.String("out", "", "file to keep the receipt in")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 1, 1); err != nil {
+		return err
+	}
+	r, err := e.cc.Receipt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	if *out != "" {
+		b, _ := json.MarshalIndent(r, "", "  ")
+		if err := os.WriteFile(*out, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return e.print(checkedReceipt{Period: r.Period, Index: r.Index, Size: r.Size, Root: r.Root, File: *out, Erased: r.Erased})
+}
+
+func verify(e *env, args []string) error {
+	fs := newFlags("verify")
+	root := fs.String("root", "", "root the receipt must lead to, hex")
+	if err := flagError(fs.Parse(args)); err != nil {
+		return err
+	}
+	if err := wantArgs(fs.Args(), 1, 1); err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var r merkle.Receipt
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	if *root != "" && !strings.EqualFold(*root, r.Root) {
+		return fmt.Errorf("the receipt is for root %s", r.Root)
+	}
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	return e.print(checkedReceipt{Period: r.Period, Index: r.Index, Size: r.Size, Root: r.Root, File: fs.Arg(0), Erased: r.Erased})
+}
+
+// healthReport is what health prints
+type healthReport struct {
+	Peer      string `json:"peer"`
+	Chaincode string `json:"chaincode"`
+	Functions int    `json:"functions"`
+	Latency   string `json:"latency"`
+}
+
+func health(e *env, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+	start := time.Now()
+	specs, err := e.cc.Describe()
+	if err != nil {
+		return errors.New("chaincode does not answer: " + err.Error())
+	}
+	report := healthReport{
+		Peer:      e.rpc.Peer.URL,
+		Chaincode: e.rpc.Name,
+		Functions: len(specs),
+		Latency:   time.Since(start).Round(time.Millisecond).String(),
+	}
+	if e.fabric != nil {
+		report.Peer, report.Chaincode = e.fabric.Conn.Target(), e.fabric.Chaincode
+	}
+	return e.print(report)
+}
+
+func functions(e *env, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+	specs, err := e.cc.Describe()
+	if err != nil {
+		return err
+	}
+	if e.format == "json" {
+		return e.print(specs)
+	}
+	type row struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+		Role string `json:"role"`
+		Args string `json:"args"`
+		Doc  string `json:"doc"`
+	}
+	var rows []row
+	for _, f := range specs {
+		var names []string
+		for _, a := range f.Args {
+			if a.Optional {
+				names = append(names, "["+a.Name+"]")
+			} else {
+				names = append(names, a.Name)
+			}
+		}
+		rows = append(rows, row{f.Name, f.Kind, f.Role, strings.Join(names, " "), f.Doc})
+	}
+	return e.print(rows)
+}
+
+func call(e *env, args []string) error {
+	if len(args) == 0 {
+		return usageError("missing function")
+	}
+	specs, err := e.cc.Describe()
+	if err != nil {
+		return err
+	}
+	for _, f := range specs {
+		if f.Name != args[0] {
+			continue
+		}
+		if f.Kind == "query" {
+			var content json.RawMessage
+			if err := e.cc.Query(&content, f.Name, args[1:]...); err != nil {
+				return err
+			}
+			return e.print(content)
+		}
+		txID, err := e.cc.Invoke(f.Name, args[1:]...)
+		if err != nil {
+			return err
+		}
+		return e.print(map[string]string{"txID": txID})
+	}
+	return usageError("the chaincode has no function " + args[0] + ", see ccpxctl functions")
+}
+
+// parseTime reads ms since epoch, RFC 3339 or a local date like 2016-12-04
+func parseTime(v string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), nil
+	}
+	if tm, err := time.Parse(time.RFC3339, v); err == nil {
+		return tm, nil
+	}
+	if tm, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return tm, nil
+	}
+	return time.Time{}, usageError(fmt.Sprintf("cannot read time %q, use ms, RFC 3339 or 2006-01-02", v))
+}
+
+func parseTimes(from string, to string) (time.Time, time.Time, error) {
+	f, err := parseTime(from)
+	if err != nil {
+		return f, f, err
+	}
+	t, err := parseTime(to)
+	return f, t, err
+}
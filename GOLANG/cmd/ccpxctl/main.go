@@ -0,0 +1,198 @@
+// Command ccpxctl operates the CCPX chaincode of a peer: deploy and
+// initialise it, record and query exchanges, read raw keys, export the
+// ledger and check that it answers.
+//
+// With -fabric it calls the chaincode committed on a Fabric 2.4+ peer through
+// the peer's Gateway service, as the identity of -msp-id, -cert and -key; the
+// chaincode is installed there with the peer lifecycle commands, not deploy.
+// Otherwise it talks the REST interface of a Fabric 0.6 peer, which ccpx-sim
+// serves for the current chaincode; a 0.6 peer only runs the 0.6 chaincode
+// deployed with deploy -legacy, most commands need the current one.
+//
+//	ccpxctl [-fabric host:port -channel c -msp-id id -cert pem -key pem [-tls-ca pem]] [-peer url] [-name chaincode] [-manifest file] [-user id] [-secret s] [-o json|table] <command> [args]
+//
+// -fabric, -channel, -msp-id, -cert, -key and -tls-ca default to
+// $CCPX_FABRIC, $CCPX_CHANNEL, $CCPX_MSPID, $CCPX_CERT, $CCPX_KEY and
+// $CCPX_TLS_CA; -peer, -name, -manifest, -user and -secret to $CCPX_PEER,
+// $CCPX_CHAINCODE, $CCPX_MANIFEST, $CCPX_USER and $CCPX_SECRET. Without a
+// name the chaincode is "ccpx" on Fabric, else the one of the manifest deploy
+// wrote.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/deploy"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+)
+
+// env holds what every command gets: the chaincode, where to print and how
+type env struct {
+	rpc      *client.RPCTransport
+	fabric   *client.FabricTransport //set when the calls go to a Fabric peer instead
+	cc       *client.Client
+	manifest string
+	out      io.Writer
+	format   string
+}
+
+type command struct {
+	usage string
+	doc   string
+	run   func(e *env, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"package":    {"package [-o zip] [module dir]", "build the chaincode and zip its sources for the peer", pack},
+		"deploy":     {"deploy [-path p] [-timeout d] [-legacy] [abc]", "deploy the chaincode on ccpx-sim (the 0.6 one on a 0.6 peer with -legacy), wait until it answers and write the manifest", deployCC},
+		"init":       {"init [abc]", "reset the chaincode state", initState},
+		"record":     {"record -id id -user-a u -user-b u -seller-a s -seller-b s -points-a n -points-b n [-time t] [-give-a point]... [-give-b point]... [-sign-a key.pem] [-sign-b key.pem] [-nonce n]", "record an exchange, with point lots handed over and signed by the sellers with a key", record},
+		"ring":       {"ring -id id [-time t] [-sign seller=key.pem]... [-nonce n] <user:seller:points-in:points-out>...", "record an exchange between several sellers, each leg giving its points to the next", ring},
+		"pseudonym":  {"pseudonym -keys file -seller s <member>... | pseudonym -new-key", "the pseudonyms of members, the way the ledger holds them", pseudonyms},
+		"credit":     {"credit [-keys file] <seller> <member> <points>", "issue points of a seller to one of its members, as a new lot", credit},
+		"transfer":   {"transfer -sign key.pem [-nonce n] [-keys file] <seller> <from> <to> <points>", "move points of a seller between two of its members, signed by the sending member", transfer},
+		"member-key": {"member-key [-sign old-key.pem] [-keys file] <seller> <member> [public key PEM file]", "show or register the key a member signs its transfers with", memberKey},
+		"erase":      {"erase [-keys file] <seller> <member>", "erase a member of a seller from the exchanges, points, reconciliations, transfers and balance", erase},
+		"seller-key": {"seller-key <seller> [public key PEM file]", "show or register the key a seller signs its exchanges with", sellerKey},
+		"query":      {"query latest <seller> <n> | range <seller> <from> <to> | aggregate <seller> <period> <from> <to> [partner]", "query exchanges", query},
+		"points":     {"points <owner>", "points held by an owner", points},
+		"history":    {"history <point id>", "ownership history of a point", history},
+		"read":       {"read <key>...", "read raw keys", read},
+		"export":     {"export", "every point and exchange on the ledger", exportLedger},
+		"exchanges":  {"exchanges -seller s -from t -to t [-format csv|ndjson] [-out file]", "export the exchanges of a seller for reconciliation, with a .sha256 file", exchanges},
+		"receipt":    {"receipt [-out file] <txID>", "fetch and check the Merkle receipt of an exchange", receipt},
+		"verify":     {"verify [-root hex] <receipt file>", "check a receipt offline, against a root obtained elsewhere with -root", verify},
+		"health":     {"health", "check that the chaincode answers", health},
+		"functions":  {"functions", "the chaincode's function catalogue", functions},
+		"call":       {"call <function> [args]...", "call any chaincode function by name, checked against the catalogue", call},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ccpxctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	peerURL := fs.String("peer", envOr("CCPX_PEER", "http://172.17.0.2:7050"), "REST address of the peer")
+	name := fs.String("name", os.Getenv("CCPX_CHAINCODE"), "deployed chaincode name (hash), default the one of the manifest")
+	manifest := fs.String("manifest", envOr("CCPX_MANIFEST", deploy.DefaultManifest), "deployment manifest")
+	user := fs.String("user", envOr("CCPX_USER", "test_user0"), "enrollment id the calls are made with")
+	secret := fs.String("secret", os.Getenv("CCPX_SECRET"), "enrollment secret, logs the user in first when set")
+	fabric := fs.String("fabric", os.Getenv("CCPX_FABRIC"), "host:port of the Gateway service of a Fabric 2.4+ peer, the calls go there instead of -peer")
+	channel := fs.String("channel", envOr("CCPX_CHANNEL", "mychannel"), "channel the chaincode is committed on, with -fabric")
+	mspID := fs.String("msp-id", os.Getenv("CCPX_MSPID"), "MSP id of the identity the calls are signed as, with -fabric")
+	cert := fs.String("cert", os.Getenv("CCPX_CERT"), "PEM certificate of that identity")
+	key := fs.String("key", os.Getenv("CCPX_KEY"), "PEM private key of that identity")
+	tlsCA := fs.String("tls-ca", os.Getenv("CCPX_TLS_CA"), "PEM certificate of the CA of the peer's TLS certificate, plaintext without it")
+	retries := fs.Int("retries", 2, "how many times a call the peer failed is tried again")
+	format := fs.String("o", "table", "output format: json or table")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "json" && *format != "table" {
+		fmt.Fprintf(stderr, "ccpxctl: unknown output format %q\n", *format)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "ccpxctl: unknown command %q\n", fs.Arg(0))
+		usage(fs)
+		return 2
+	}
+
+	if *name == "" && *fabric != "" {
+		*name = "ccpx"
+	} else if *name == "" {
+		if m, err := deploy.ReadManifest(*manifest); err == nil {
+			*name = m.Name
+		}
+	}
+	p := &peer.Client{URL: *peerURL, EnrollID: *user, EnrollSecret: *secret, Retries: *retries}
+	rpc := &client.RPCTransport{Peer: p, Name: *name}
+	e := &env{rpc: rpc, cc: client.New(rpc), manifest: *manifest, out: stdout, format: *format}
+	if *fabric != "" {
+		ft, err := client.OpenFabric(*fabric, *tlsCA, *channel, *name, *mspID, *cert, *key)
+		if err != nil {
+			fmt.Fprintf(stderr, "ccpxctl: %v\n", err)
+			return 1
+		}
+		defer ft.Conn.Close()
+		e.fabric, e.cc = ft, client.New(ft)
+	}
+	if err := cmd.run(e, fs.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 2
+		}
+		fmt.Fprintf(stderr, "ccpxctl %s: %v\n", fs.Arg(0), err)
+		if _, isUsage := err.(usageError); isUsage {
+			fmt.Fprintf(stderr, "usage: ccpxctl %s\n", cmd.usage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "usage: ccpxctl [flags] <command> [args]")
+	fs.PrintDefaults()
+	fmt.Fprintln(w, "commands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].doc)
+	}
+}
+
+func envOr(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// usageError is a command called with the wrong arguments
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func wantArgs(args []string, min int, max int) error {
+	if len(args) < min || len(args) > max {
+		return usageError(fmt.Sprintf("got %d arguments", len(args)))
+	}
+	return nil
+}
+
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// flagError keeps the message of a flag parse error as a usage error
+func flagError(err error) error {
+	if err == nil || err == flag.ErrHelp {
+		return err
+	}
+	return usageError(strings.TrimSpace(err.Error()))
+}
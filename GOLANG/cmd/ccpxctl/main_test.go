@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/deploy"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/merkle"
+)
+
+// fakePeer answers the JSON-RPC calls of the tests with canned envelopes, keyed
+// by function, and has every transaction committed
+func fakePeer(t *testing.T, answers map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`{"type":1,"txid":"` + strings.TrimPrefix(r.URL.Path, "/transactions/") + `"}`))
+			return
+		}
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				CtorMsg struct {
+					Args []string `json:"args"`
+				} `json:"ctorMsg"`
+			} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		message := answers[req.Method+" "+req.Params.CtorMsg.Args[0]]
+		b, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "result": map[string]string{"status": "OK", "message": message}})
+		w.Write(b)
+	}))
+}
+
+func ccpxctl(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+const latest = `{"respond":300,"msg":"enquiry successfully","content":{"tx":[` +
+	`{"txID":"t1","EX_TIME":"1480838400000","USER_A_ID":"bob","USER_B_ID":"alice","SELLER_A_ID":"1","SELLER_B_ID":"2","POINT_A":"10","POINT_B":"20","related":null}]}}`
+
+func TestQueryOutput(t *testing.T) {
+	peer := fakePeer(t, map[string]string{
+		"query findLatest": latest,
+		"query findRange":  `{"respond":401,"msg":"No records","content":null}`,
+	})
+	defer peer.Close()
+
+	code, out, _ := ccpxctl("-peer", peer.URL, "-name", "cc", "query", "latest", "1", "5")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != 0 || len(lines) != 2 || !strings.HasPrefix(lines[0], "TXID  EX_TIME") || !strings.Contains(lines[1], "1480838400000  bob") {
+		t.Errorf("table: %d %q", code, out)
+	}
+
+	code, out, _ = ccpxctl("-peer", peer.URL, "-name", "cc", "-o", "json", "query", "latest", "1", "5")
+	var txs []map[string]interface{}
+	if code != 0 || json.Unmarshal([]byte(out), &txs) != nil || len(txs) != 1 || txs[0]["USER_B_ID"] != "alice" {
+		t.Errorf("json: %d %q", code, out)
+	}
+
+	code, _, errOut := ccpxctl("-peer", peer.URL, "-name", "cc", "query", "range", "1", "2016-12-04", "2016-12-05")
+	if code != 1 || !strings.Contains(errOut, "401 No records") {
+		t.Errorf("no records: %d %q", code, errOut)
+	}
+}
+
+func TestExchanges(t *testing.T) {
+	peer := fakePeer(t, map[string]string{"query findRange": latest})
+	defer peer.Close()
+	out := filepath.Join(t.TempDir(), "1.csv")
+
+	code, stdout, _ := ccpxctl("-peer", peer.URL, "-name", "cc", "exchanges", "-seller", "1", "-from", "2016-12-04", "-to", "2016-12-05", "-out", out)
+	csv, _ := os.ReadFile(out)
+	sum, _ := os.ReadFile(out + ".sha256")
+	want := "tx_id,ex_time,ex_time_utc,seller_a,user_a,point_a,seller_b,user_b,point_b,legs,related\n" +
+		"t1,1480838400000,2016-12-04T08:00:00.000Z,1,bob,10,2,alice,20,,\n"
+	h := sha256.Sum256(csv)
+	if code != 0 || string(csv) != want || string(sum) != hex.EncodeToString(h[:])+"  1.csv\n" || !strings.Contains(stdout, "rows    1") {
+		t.Errorf("exchanges: %d %q %q %q", code, stdout, csv, sum)
+	}
+	if code, _, _ := ccpxctl("-peer", peer.URL, "exchanges", "-seller", "1", "-from", "2016-12-04"); code != 2 {
+		t.Errorf("exchanges without -to: exit %d", code)
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	records := []string{`{"txID":"t1"}`, `{"txID":"t2"}`, `{"txID":"t3"}`}
+	var leaves [][]byte
+	for _, rec := range records {
+		leaves = append(leaves, merkle.LeafHash([]byte(rec)))
+	}
+	r := merkle.Receipt{Record: []byte(records[2]), Period: "2016-12-04", Index: 2, Size: 3,
+		Leaf: hex.EncodeToString(leaves[2]), Root: hex.EncodeToString(merkle.Root(leaves))}
+	for _, p := range merkle.Proof(leaves, 2) {
+		r.Proof = append(r.Proof, hex.EncodeToString(p))
+	}
+	content, _ := json.Marshal(r)
+	peer := fakePeer(t, map[string]string{"query findReceipt": `{"respond":300,"msg":"enquiry successfully","content":` + string(content) + `}`})
+	defer peer.Close()
+	out := filepath.Join(t.TempDir(), "t3.json")
+
+	if code, stdout, stderr := ccpxctl("-peer", peer.URL, "-name", "cc", "receipt", "-out", out, "t3"); code != 0 || !strings.Contains(stdout, r.Root) {
+		t.Fatalf("receipt: %d %q %q", code, stdout, stderr)
+	}
+	if code, _, stderr := ccpxctl("verify", "-root", strings.ToUpper(r.Root), out); code != 0 {
+		t.Errorf("verify: %d %q", code, stderr)
+	}
+	if code, _, _ := ccpxctl("verify", "-root", r.Leaf, out); code != 1 {
+		t.Errorf("verify against another root: exit %d", code)
+	}
+	raw, _ := os.ReadFile(out)
+	os.WriteFile(out, bytes.Replace(raw, []byte(`"t3"`), []byte(`"t4"`), 1), 0644)
+	if code, _, _ := ccpxctl("verify", out); code != 1 {
+		t.Errorf("verify an altered receipt: exit %d", code)
+	}
+}
+
+func TestSignedRecord(t *testing.T) {
+	peer := fakePeer(t, map[string]string{"invoke init_transaction": "tx1"})
+	defer peer.Close()
+	dir := t.TempDir()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	keyFile := filepath.Join(dir, "seller1.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	os.WriteFile(filepath.Join(dir, "garbage.pem"), []byte("not a key"), 0600)
+
+	ex := []string{"-peer", peer.URL, "-name", "cc", "record", "-id", "r1", "-user-a", "bob", "-user-b", "alice",
+		"-seller-a", "1", "-seller-b", "2", "-points-a", "10", "-points-b", "20"}
+	if code, stdout, stderr := ccpxctl(append(ex, "-sign-a", keyFile)...); code != 0 || !strings.Contains(stdout, "tx1") {
+		t.Errorf("signed record: %d %q %q", code, stdout, stderr)
+	}
+	if code, _, _ := ccpxctl(append(ex, "-sign-b", filepath.Join(dir, "garbage.pem"))...); code != 1 {
+		t.Errorf("record signed with a garbage key: exit %d", code)
+	}
+}
+
+func TestBundleRecord(t *testing.T) {
+	peer := fakePeer(t, map[string]string{"invoke init_bundle_exchange": "tx2"})
+	defer peer.Close()
+	ex := []string{"-peer", peer.URL, "-name", "cc", "record", "-id", "b1", "-user-a", "bob", "-user-b", "alice",
+		"-seller-a", "1", "-seller-b", "2", "-points-a", "10", "-points-b", "20", "-give-a", "1-a", "-give-a", "1-b", "-give-b", "2-a"}
+	if code, stdout, stderr := ccpxctl(ex...); code != 0 || !strings.Contains(stdout, "tx2") {
+		t.Errorf("bundle record: %d %q %q", code, stdout, stderr)
+	}
+}
+
+func TestRing(t *testing.T) {
+	peer := fakePeer(t, map[string]string{"invoke init_ring_exchange": "tx1"})
+	defer peer.Close()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	keyFile := filepath.Join(t.TempDir(), "seller2.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+
+	legs := []string{"bob:1:30:10", "alice:2:10:20", "carol:3:20:30"}
+	if code, stdout, stderr := ccpxctl(append([]string{"-peer", peer.URL, "-name", "cc", "ring", "-id", "r1", "-sign", "2=" + keyFile}, legs...)...); code != 0 || !strings.Contains(stdout, "tx1") {
+		t.Errorf("ring: %d %q %q", code, stdout, stderr)
+	}
+	for _, args := range [][]string{
+		{"ring", "-id", "r1", "bob:1:30:10"},
+		{"ring", "-id", "r1", "bob:1:30", "alice:2:10:20"},
+		{"ring", "-id", "r1", "-sign", keyFile, "bob:1:1:1", "alice:2:1:1"},
+	} {
+		if code, _, _ := ccpxctl(append([]string{"-peer", peer.URL, "-name", "cc"}, args...)...); code != 2 {
+			t.Errorf("%v: exit %d, want 2", args, code)
+		}
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	peer := fakePeer(t, map[string]string{"invoke transfer_points": "tx1", "invoke credit_member": "tx2", "invoke register_member_key": "tx3"})
+	defer peer.Close()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	keyFile := filepath.Join(t.TempDir(), "bob.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	der, _ = x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubFile := filepath.Join(t.TempDir(), "bob.pub.pem")
+	os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	if code, stdout, stderr := ccpxctl("-peer", peer.URL, "-name", "cc", "member-key", "1", "bob", pubFile); code != 0 || !strings.Contains(stdout, "tx3") {
+		t.Errorf("member-key: %d %q %q", code, stdout, stderr)
+	}
+	if code, stdout, stderr := ccpxctl("-peer", peer.URL, "-name", "cc", "member-key", "-sign", keyFile, "1", "bob", pubFile); code != 0 || !strings.Contains(stdout, "tx3") {
+		t.Errorf("member-key -sign: %d %q %q", code, stdout, stderr)
+	}
+
+	if code, stdout, stderr := ccpxctl("-peer", peer.URL, "-name", "cc", "credit", "1", "bob", "50"); code != 0 || !strings.Contains(stdout, "tx2") {
+		t.Errorf("credit: %d %q %q", code, stdout, stderr)
+	}
+	if code, stdout, stderr := ccpxctl("-peer", peer.URL, "-name", "cc", "transfer", "-sign", keyFile, "1", "bob", "alice", "20"); code != 0 || !strings.Contains(stdout, "tx1") {
+		t.Errorf("transfer: %d %q %q", code, stdout, stderr)
+	}
+	for _, args := range [][]string{
+		{"transfer", "1", "bob", "alice", "20"},
+		{"transfer", "-sign", keyFile, "1", "bob", "alice", "twenty"},
+		{"transfer", "-sign", keyFile, "1", "bob", "alice"},
+		{"credit", "1", "bob"},
+		{"member-key", "1"},
+	} {
+		if code, _, _ := ccpxctl(append([]string{"-peer", peer.URL, "-name", "cc"}, args...)...); code != 2 {
+			t.Errorf("%v: exit %d, want 2", args, code)
+		}
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	code, stdout, _ := ccpxctl("-o", "json", "pseudonym", "-new-key")
+	var key map[string]string
+	if code != 0 || json.Unmarshal([]byte(stdout), &key) != nil || key["key"] == "" {
+		t.Fatalf("pseudonym -new-key: %d %q", code, stdout)
+	}
+	keys := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(keys, []byte(`{"1":"`+key["key"]+`"}`), 0600)
+	code, stdout, _ = ccpxctl("pseudonym", "-keys", keys, "-seller", "1", "bob", "alice")
+	if code != 0 || strings.Count(stdout, "psn:") != 2 || !strings.Contains(stdout, "bob") {
+		t.Errorf("pseudonym: %d %q", code, stdout)
+	}
+	if code, _, _ := ccpxctl("pseudonym", "-keys", keys, "-seller", "2", "bob"); code != 1 {
+		t.Errorf("pseudonym of a seller without a key: exit %d", code)
+	}
+
+	peer := fakePeer(t, map[string]string{"invoke erase_member": "tx1"})
+	defer peer.Close()
+	if code, stdout, stderr := ccpxctl("-peer", peer.URL, "-name", "cc", "erase", "-keys", keys, "1", "bob"); code != 0 || !strings.Contains(stdout, "tx1") {
+		t.Errorf("erase: %d %q %q", code, stdout, stderr)
+	}
+	if code, _, _ := ccpxctl("-peer", peer.URL, "-name", "cc", "erase", "-keys", keys, "2", "bob"); code != 1 {
+		t.Errorf("erase a member of a seller without a key: exit %d", code)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"frobnicate"},
+		{"-o", "xml", "health"},
+		{"query", "latest", "1"},
+		{"query", "range", "1", "yesterday", "today"},
+		{"record", "-points-a", "ten"},
+		{"erase", "1"},
+	}
+	for _, args := range tests {
+		if code, _, _ := ccpxctl(args...); code != 2 {
+			t.Errorf("%v: exit %d, want 2", args, code)
+		}
+	}
+}
+
+func TestDeployAndCall(t *testing.T) {
+	peer := fakePeer(t, map[string]string{
+		"deploy init":       "5413191f18c5",
+		"query describe":    `{"respond":300,"msg":"enquiry successfully","content":{"functions":[{"name":"init_point","kind":"invoke","args":[]},{"name":"read","kind":"query","args":[]}]}}`,
+		"invoke init_point": "uuid-7",
+		"query read":        `{"respond":300,"msg":"enquiry successfully","content":{"id":"p1","owner":"bob"}}`,
+	})
+	defer peer.Close()
+
+	manifest := filepath.Join(t.TempDir(), "ccpx-deploy.json")
+	t.Setenv("CCPX_MANIFEST", manifest)
+	if code, out, _ := ccpxctl("-peer", peer.URL, "deploy"); code != 0 || !strings.Contains(out, "5413191f18c5") {
+		t.Errorf("deploy: %d %q", code, out)
+	}
+	if m, err := deploy.ReadManifest(manifest); err != nil || m.Name != "5413191f18c5" || m.Path != defaultPath {
+		t.Errorf("manifest: %+v %v", m, err)
+	}
+	if code, out, _ := ccpxctl("-peer", peer.URL, "-o", "json", "call", "init_point", "p1", "bob"); code != 0 || !strings.Contains(out, `"txID": "uuid-7"`) {
+		t.Errorf("call invoke: %d %q", code, out)
+	}
+	if code, out, _ := ccpxctl("-peer", peer.URL, "read", "p1"); code != 0 || !strings.Contains(out, `{"id":"p1","owner":"bob"}`) {
+		t.Errorf("read: %d %q", code, out)
+	}
+	if code, _, errOut := ccpxctl("-peer", peer.URL, "call", "open_trade"); code != 2 || !strings.Contains(errOut, "no function open_trade") {
+		t.Errorf("call unknown: %d %q", code, errOut)
+	}
+	if code, out, _ := ccpxctl("-peer", peer.URL, "health"); code != 0 || !strings.Contains(out, "functions  2") {
+		t.Errorf("health: %d %q", code, out)
+	}
+}
+
+func TestFabricFlags(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"), 0600)
+
+	fabric := []string{"-fabric", "localhost:7051", "-msp-id", "Org1MSP", "-cert", certFile, "-key", keyFile}
+	if code, _, errOut := ccpxctl(append(fabric, "deploy")...); code != 1 || !strings.Contains(errOut, "peer lifecycle") {
+		t.Errorf("deploy on Fabric: %d %q", code, errOut)
+	}
+	if code, _, errOut := ccpxctl("-fabric", "localhost:7051", "-cert", certFile, "-key", certFile, "health"); code != 1 || !strings.Contains(errOut, "ccpxctl:") {
+		t.Errorf("bad key: %d %q", code, errOut)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// print writes v as indented JSON or as a table
+func (e *env) print(v interface{}) error {
+	if e.format == "json" {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(e.out, string(b))
+		return err
+	}
+	tw := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+	writeTable(tw, v)
+	return tw.Flush()
+}
+
+// writeTable lays out a slice of structs one row each, with their JSON names as
+// header, and a struct or a map as name/value rows. Anything else goes out as JSON.
+func writeTable(tw *tabwriter.Writer, v interface{}) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Struct:
+		fields := columns(rv.Type().Elem())
+		var header []string
+		for _, f := range fields {
+			header = append(header, strings.ToUpper(f.name))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		if rv.Len() == 0 {
+			fmt.Fprintln(tw, "(none)")
+		}
+		for i := 0; i < rv.Len(); i++ {
+			var row []string
+			for _, f := range fields {
+				row = append(row, cell(rv.Index(i).Field(f.index)))
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+	case rv.Kind() == reflect.Struct:
+		for _, f := range columns(rv.Type()) {
+			fmt.Fprintf(tw, "%s\t%s\n", f.name, cell(rv.Field(f.index)))
+		}
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		var keys []string
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%s\n", k, cell(rv.MapIndex(reflect.ValueOf(k))))
+		}
+	default:
+		b, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Fprintln(tw, string(b))
+	}
+}
+
+type column struct {
+	name  string
+	index int
+}
+
+// columns are the exported fields of a struct under their JSON names
+func columns(t reflect.Type) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		cols = append(cols, column{name, i})
+	}
+	return cols
+}
+
+// cell is a value as it reads in a table: strings bare, the rest as compact JSON
+func cell(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && v.Len() == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(v.Interface())
+	return string(b)
+}
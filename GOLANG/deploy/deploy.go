@@ -0,0 +1,170 @@
+// Package deploy packages the CCPX chaincode, deploys it on a peer, waits
+// until it answers and keeps the name the peer gave it in a manifest file the
+// gateway and ccpxctl read, so that nobody copies the HASHCODE around.
+//
+// Deploying goes through the REST interface of a Fabric 0.6 peer, which only
+// the simulator (ccpx-sim) serves for the current chaincode: a 0.6 peer cannot
+// build a chaincode written for the fabric-chaincode-go shim, and a Fabric 2.x
+// peer has no REST interface. fabric.sh installs and commits the chaincode on
+// a Fabric 2.x network with the peer lifecycle commands instead. RunLegacy
+// deploys the 0.6 chaincode kept in legacy/ccpx06 on a real 0.6 peer.
+package deploy
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+)
+
+// DefaultManifest is where the manifest is kept unless told otherwise
+const DefaultManifest = "ccpx-deploy.json"
+
+// Manifest records a deployment of the chaincode
+type Manifest struct {
+	Name       string    `json:"name"` //the HASHCODE
+	Path       string    `json:"path"` //go import path or zip url deployed
+	Args       []string  `json:"args"` //init arguments
+	Peer       string    `json:"peer"`
+	Package    string    `json:"package_sha256,omitempty"` //of the zip, when deployed from one built here
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+// ReadManifest reads the manifest at path
+func ReadManifest(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if m.Name == "" {
+		return nil, errors.New(path + ": no chaincode name")
+	}
+	return &m, nil
+}
+
+// Write writes the manifest to path. It replaces the file in one rename so
+// that a gateway reading it never sees half of it.
+func (m *Manifest) Write(path string) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ============================================================================================================================
+// Package - the zip the peer fetches
+// ============================================================================================================================
+
+// sources are the files of the module the chaincode builds from
+var sources = []string{"go.mod", "go.sum", "ccpx/*.go", "chaincode/*.go", "merkle/*.go", "pseudonym/*.go"}
+
+// zipTime is the time of every file in the zip, so the same sources always give the same zip
+var zipTime = time.Date(2016, 12, 4, 0, 0, 0, 0, time.UTC)
+
+// Package writes the zip of the chaincode sources of the module in dir to w
+// and returns its SHA-256. Tests are left out.
+func Package(dir string, w io.Writer) (string, error) {
+	var files []string
+	for _, pattern := range sources {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return "", err
+		}
+		if len(matches) == 0 {
+			return "", fmt.Errorf("%s: no %s, is it the GOLANG module?", dir, pattern)
+		}
+		for _, m := range matches {
+			if !strings.HasSuffix(m, "_test.go") {
+				files = append(files, m)
+			}
+		}
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(w, h))
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return "", err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(rel), Method: zip.Deflate, Modified: zipTime})
+		if err != nil {
+			return "", err
+		}
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		if _, err := fw.Write(src); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ============================================================================================================================
+// Run - deploy and wait
+// ============================================================================================================================
+
+// Run deploys the chaincode at path with the init arguments args, waits
+// until the deployment is committed and the chaincode answers a describe
+// query, polling every interval for at most timeout, and returns the
+// manifest of the deployment.
+func Run(p *peer.Client, path string, args []string, interval time.Duration, timeout time.Duration) (*Manifest, error) {
+	start := time.Now()
+	m, err := RunLegacy(p, path, args, interval, timeout)
+	if err != nil {
+		return nil, err
+	}
+	//the peer commits the deployment before the chaincode container is up
+	cc := client.New(&client.RPCTransport{Peer: p, Name: m.Name})
+	for {
+		_, err := cc.Describe()
+		if err == nil {
+			break
+		}
+		if time.Since(start)+interval > timeout {
+			return nil, fmt.Errorf("chaincode %s does not answer after %s: %v", m.Name, timeout, err)
+		}
+		time.Sleep(interval)
+	}
+	m.DeployedAt = time.Now().UTC()
+	return m, nil
+}
+
+// RunLegacy deploys the chaincode at path like Run but only waits until the
+// deployment is committed: the 0.6 chaincode has no describe query to answer.
+func RunLegacy(p *peer.Client, path string, args []string, interval time.Duration, timeout time.Duration) (*Manifest, error) {
+	name, err := p.Deploy(path, "init", args)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Ready(name, interval, timeout); err != nil {
+		return nil, err
+	}
+	return &Manifest{Name: name, Path: path, Args: args, Peer: p.URL, DeployedAt: time.Now().UTC()}, nil
+}
@@ -0,0 +1,107 @@
+package deploy
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/simulator"
+)
+
+func TestPackage(t *testing.T) {
+	var zipped bytes.Buffer
+	sum, err := Package("..", &zipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Bytes()), int64(zipped.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, f := range zr.File {
+		names[f.Name] = true
+		if strings.HasSuffix(f.Name, "_test.go") || strings.HasPrefix(f.Name, "gateway/") {
+			t.Errorf("%s is in the package", f.Name)
+		}
+	}
+	for _, want := range []string{"go.mod", "go.sum", "ccpx/main.go", "chaincode/ccpx.go", "chaincode/registry.go"} {
+		if !names[want] {
+			t.Errorf("%s is not in the package", want)
+		}
+	}
+	if again, _ := Package("..", &bytes.Buffer{}); again != sum {
+		t.Errorf("the same sources zip to %s then %s", sum, again)
+	}
+	if _, err := Package(t.TempDir(), &bytes.Buffer{}); err == nil {
+		t.Error("packaged a directory without the module")
+	}
+}
+
+// the peer fetches ccpx/ccpx.zip from the repository, it must hold the chaincode as it is
+func TestCommittedPackageIsFresh(t *testing.T) {
+	committed, err := os.ReadFile("../ccpx/ccpx.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zipped bytes.Buffer
+	if _, err := Package("..", &zipped); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(committed, zipped.Bytes()) {
+		t.Error("ccpx/ccpx.zip is stale, run go run ./cmd/ccpxctl package in GOLANG")
+	}
+}
+
+func TestRunAndTrack(t *testing.T) {
+	l, err := simulator.Open("", new(chaincode.SimpleChaincode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.SetAttributes("test_user0", map[string]string{"role": "admin"})
+	l.SetSecret("test_user0", "pw")
+	srv := httptest.NewServer(l.Handler())
+	defer srv.Close()
+	p := &peer.Client{URL: srv.URL, EnrollID: "test_user0", EnrollSecret: "pw"}
+
+	path := filepath.Join(t.TempDir(), DefaultManifest)
+	tracker := client.New(&Tracker{Peer: p, Path: path})
+	if _, err := tracker.Describe(); err == nil {
+		t.Error("tracker answered without a manifest")
+	}
+	(&Manifest{Name: "0123abcd"}).Write(path)
+	if _, err := tracker.Describe(); err == nil || !strings.Contains(err.Error(), "0123abcd is not deployed") {
+		t.Errorf("tracker on a name the peer does not know: %v", err)
+	}
+
+	m, err := Run(p, "github.com/CCPX-system/CCPX-blockchain/GOLANG/ccpx", []string{"99"}, time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != simulator.ChaincodeName(m.Path, []string{"init", "99"}) || m.Peer != srv.URL {
+		t.Errorf("manifest %+v", m)
+	}
+	if err := m.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := ReadManifest(path); err != nil || read.Name != m.Name || read.Args[0] != "99" {
+		t.Errorf("ReadManifest: %+v %v", read, err)
+	}
+	if _, err := tracker.Describe(); err != nil {
+		t.Errorf("tracker after the manifest changed: %v", err)
+	}
+
+	legacy, err := RunLegacy(p, "legacy/ccpx06", []string{"99"}, time.Millisecond, time.Second)
+	if err != nil || legacy.Name != simulator.ChaincodeName("legacy/ccpx06", []string{"init", "99"}) {
+		t.Errorf("RunLegacy: %+v %v", legacy, err)
+	}
+}
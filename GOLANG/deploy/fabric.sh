@@ -0,0 +1,84 @@
+#!/usr/bin/env bash
+# Installs the CCPX chaincode (GOLANG/ccpx) on a Fabric 2.x network with the peer lifecycle commands, approves it for
+# both organisations, commits it and waits until it answers. The first commit runs Init, which resets the state.
+#
+# The network is the test network of fabric-samples (./network.sh up createChannel -c $CCPX_CHANNEL), the peer
+# binary of fabric-samples must be on the PATH. A chaincode already committed under the name is upgraded: the
+# sequence follows the committed one and Init is not run again, the state is kept.
+#
+# settings
+# - FABRIC_SAMPLES: fabric-samples checkout the test network runs from, required
+# - CCPX_CHANNEL: channel, default mychannel
+# - CCPX_CHAINCODE: name the chaincode is committed under, default ccpx
+# - CCPX_VERSION: version label, default the short git commit
+# - CCPX_ABC: Init argument, default 99
+
+set -e
+
+: "${FABRIC_SAMPLES:?FABRIC_SAMPLES must point at the fabric-samples checkout the test network runs from}"
+CHANNEL=${CCPX_CHANNEL:-mychannel}
+NAME=${CCPX_CHAINCODE:-ccpx}
+VERSION=${CCPX_VERSION:-$(git -C "$(dirname "$0")" rev-parse --short HEAD 2>/dev/null || echo 1)}
+ABC=${CCPX_ABC:-99}
+
+MODULE=$(cd "$(dirname "$0")/.." && pwd)
+ORGS=$FABRIC_SAMPLES/test-network/organizations
+ORDERER_CA=$ORGS/ordererOrganizations/example.com/tlsca/tlsca.example.com-cert.pem
+ORG1_CA=$ORGS/peerOrganizations/org1.example.com/tlsca/tlsca.org1.example.com-cert.pem
+ORG2_CA=$ORGS/peerOrganizations/org2.example.com/tlsca/tlsca.org2.example.com-cert.pem
+ORDERER="-o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA"
+PEERS="--peerAddresses localhost:7051 --tlsRootCertFiles $ORG1_CA --peerAddresses localhost:9051 --tlsRootCertFiles $ORG2_CA"
+export FABRIC_CFG_PATH=${FABRIC_CFG_PATH:-$FABRIC_SAMPLES/config}
+export CORE_PEER_TLS_ENABLED=true
+
+# as the admin of org 1 or 2
+as_org() {
+	export CORE_PEER_LOCALMSPID=Org$1MSP
+	export CORE_PEER_TLS_ROOTCERT_FILE=$ORGS/peerOrganizations/org$1.example.com/tlsca/tlsca.org$1.example.com-cert.pem
+	export CORE_PEER_MSPCONFIGPATH=$ORGS/peerOrganizations/org$1.example.com/users/Admin@org$1.example.com/msp
+	if [ "$1" = 1 ]; then
+		export CORE_PEER_ADDRESS=localhost:7051
+	else
+		export CORE_PEER_ADDRESS=localhost:9051
+	fi
+}
+
+# package the module with ccpx as the main package, the peers build it
+PACKAGE=$(mktemp -d)/$NAME.tar.gz
+peer lifecycle chaincode package "$PACKAGE" --path "$MODULE/ccpx" --lang golang --label "${NAME}_$VERSION"
+PACKAGE_ID=$(peer lifecycle chaincode calculatepackageid "$PACKAGE")
+
+as_org 1
+SEQUENCE=$(peer lifecycle chaincode querycommitted --channelID "$CHANNEL" --name "$NAME" 2>/dev/null | sed -n 's/.*Sequence: \([0-9]*\).*/\1/p')
+SEQUENCE=$((${SEQUENCE:-0} + 1))
+INIT=
+if [ "$SEQUENCE" = 1 ]; then
+	INIT=--init-required
+fi
+
+for org in 1 2; do
+	as_org $org
+	if ! peer lifecycle chaincode queryinstalled | grep -q "$PACKAGE_ID"; then
+		peer lifecycle chaincode install "$PACKAGE"
+	fi
+	peer lifecycle chaincode approveformyorg $ORDERER --channelID "$CHANNEL" --name "$NAME" --version "$VERSION" \
+		--package-id "$PACKAGE_ID" --sequence "$SEQUENCE" $INIT
+done
+
+peer lifecycle chaincode commit $ORDERER $PEERS --channelID "$CHANNEL" --name "$NAME" --version "$VERSION" \
+	--sequence "$SEQUENCE" $INIT
+if [ -n "$INIT" ]; then
+	peer chaincode invoke $ORDERER $PEERS --channelID "$CHANNEL" --name "$NAME" --isInit --waitForEvent \
+		-c "{\"Args\":[\"init\",\"$ABC\"]}"
+fi
+
+# the chaincode answers once a peer built and started it
+for i in $(seq 60); do
+	if peer chaincode query --channelID "$CHANNEL" --name "$NAME" -c '{"Args":["describe"]}' >/dev/null 2>&1; then
+		echo "$NAME $VERSION committed on $CHANNEL at sequence $SEQUENCE ($PACKAGE_ID)"
+		exit 0
+	fi
+	sleep 2
+done
+echo "$NAME does not answer on $CHANNEL" >&2
+exit 1
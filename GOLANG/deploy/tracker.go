@@ -0,0 +1,68 @@
+package deploy
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+)
+
+// Tracker is a client.Transport calling the chaincode the manifest at Path
+// names. It rereads the manifest when the file changes, so a redeployment
+// reaches a running gateway without a restart.
+type Tracker struct {
+	Peer *peer.Client
+	Path string
+
+	mu      sync.Mutex
+	name    string
+	modTime time.Time
+	size    int64
+}
+
+// Name is the chaincode name of the current manifest
+func (t *Tracker) Name() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fi, err := os.Stat(t.Path)
+	if err != nil {
+		return "", err
+	}
+	if t.name != "" && fi.ModTime().Equal(t.modTime) && fi.Size() == t.size {
+		return t.name, nil
+	}
+	m, err := ReadManifest(t.Path)
+	if err != nil {
+		return "", err
+	}
+	t.name, t.modTime, t.size = m.Name, fi.ModTime(), fi.Size()
+	return t.name, nil
+}
+
+func (t *Tracker) transport() (*client.RPCTransport, error) {
+	name, err := t.Name()
+	if err != nil {
+		return nil, err
+	}
+	return &client.RPCTransport{Peer: t.Peer, Name: name}, nil
+}
+
+// Invoke submits a transaction to the chaincode of the manifest
+func (t *Tracker) Invoke(function string, args []string) (string, []byte, error) {
+	rpc, err := t.transport()
+	if err != nil {
+		return "", nil, err
+	}
+	return rpc.Invoke(function, args)
+}
+
+// Query runs a query on the chaincode of the manifest
+func (t *Tracker) Query(function string, args []string) ([]byte, error) {
+	rpc, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+	return rpc.Query(function, args)
+}
@@ -1,3 +1,7 @@
+//go:build ignore
+
+// ex2 is a Fabric 0.6 example kept for reference, it does not build against the current shim.
+
 /*
 Licensed to the Apache Software Foundation (ASF) under one
 or more contributor license agreements.  See the NOTICE file
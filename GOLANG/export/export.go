@@ -0,0 +1,141 @@
+// Package export writes the exchanges of a seller as CSV or as newline
+// delimited JSON for the sellers to reconcile the ledger against their own
+// loyalty systems. The columns keep their order, new ones only ever go at the
+// end, and every file comes with its SHA-256 so a seller can show that an
+// export was not altered since the gateway handed it out.
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+)
+
+// formats
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+// Columns of an export, in the order of the CSV columns and of the JSON keys
+var Columns = []string{"tx_id", "ex_time", "ex_time_utc", "seller_a", "user_a", "point_a", "seller_b", "user_b", "point_b", "legs", "related"}
+
+// Row is one exchange of an export. The values are the ledger's, verbatim,
+// ex_time_utc is ex_time (ms since epoch) written out. A ring exchange has
+// its legs as a JSON list and the A and B columns empty, a bundle exchange
+// the points handed over with it as a JSON list in related.
+type Row struct {
+	TxID      string `json:"tx_id"`
+	ExTime    string `json:"ex_time"`
+	ExTimeUTC string `json:"ex_time_utc"`
+	SellerA   string `json:"seller_a"`
+	UserA     string `json:"user_a"`
+	PointA    string `json:"point_a"`
+	SellerB   string `json:"seller_b"`
+	UserB     string `json:"user_b"`
+	PointB    string `json:"point_b"`
+	Legs      string `json:"legs"`
+	Related   string `json:"related"`
+}
+
+// NewRow is the row of an exchange
+func NewRow(tx client.Transaction) Row {
+	row := Row{TxID: tx.Id, ExTime: tx.Timestamp, SellerA: tx.SellerA, UserA: tx.TraderA, PointA: tx.PointA,
+		SellerB: tx.SellerB, UserB: tx.TraderB, PointB: tx.PointB}
+	if len(tx.Legs) > 0 {
+		legs, _ := json.Marshal(tx.Legs)
+		row.Legs = string(legs)
+	}
+	if len(tx.Related) > 0 {
+		related, _ := json.Marshal(tx.Related)
+		row.Related = string(related)
+	}
+	if ms, err := strconv.ParseInt(tx.Timestamp, 10, 64); err == nil {
+		row.ExTimeUTC = time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return row
+}
+
+func (r Row) values() []string {
+	return []string{r.TxID, r.ExTime, r.ExTimeUTC, r.SellerA, r.UserA, r.PointA, r.SellerB, r.UserB, r.PointB, r.Legs, r.Related}
+}
+
+// Writer writes the rows of an export as they come and hashes what it writes
+type Writer struct {
+	format string
+	h      hash.Hash
+	csv    *csv.Writer
+	json   *json.Encoder
+	rows   int
+}
+
+// NewWriter starts an export in format on w, a CSV export starts with the header line
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	ew := &Writer{format: format, h: sha256.New()}
+	out := io.MultiWriter(w, ew.h)
+	switch format {
+	case CSV:
+		ew.csv = csv.NewWriter(out)
+		if err := ew.csv.Write(Columns); err != nil {
+			return nil, err
+		}
+	case NDJSON:
+		ew.json = json.NewEncoder(out)
+	default:
+		return nil, fmt.Errorf("unknown export format %q, use %s or %s", format, CSV, NDJSON)
+	}
+	return ew, nil
+}
+
+// Write adds an exchange
+func (w *Writer) Write(tx client.Transaction) error {
+	w.rows++
+	row := NewRow(tx)
+	if w.csv != nil {
+		return w.csv.Write(row.values())
+	}
+	return w.json.Encode(row)
+}
+
+// Rows is how many exchanges were written
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Close flushes the export and returns its SHA-256, hex encoded
+func (w *Writer) Close() (string, error) {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(w.h.Sum(nil)), nil
+}
+
+// ContentType is the MIME type of format
+func ContentType(format string) string {
+	if format == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Filename names the export of seller between from and to, e.g. ccpx-1-20161204-20161231.csv
+func Filename(seller string, from time.Time, to time.Time, format string) string {
+	return fmt.Sprintf("ccpx-%s-%s-%s.%s", seller, from.Format("20060102"), to.Format("20060102"), format)
+}
+
+// ChecksumLine is the line of a checksum file for an export, in the format
+// sha256sum -c checks
+func ChecksumLine(sum string, filename string) string {
+	return sum + "  " + filename + "\n"
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+)
+
+var txs = []client.Transaction{
+	{Id: "t1", Timestamp: "1480838400000", TraderA: "bob", TraderB: "alice", SellerA: "1", SellerB: "2", PointA: "10", PointB: "20",
+		Related: []client.Point{{Id: "1-a", Owner: "bob"}}},
+	{Id: "t,2", Timestamp: "1480838400250", TraderA: "carol \"c\"", TraderB: "dave", SellerA: "2", SellerB: "1", PointA: "5", PointB: "7"},
+	{Id: "r3", Timestamp: "1480838400500", Legs: []client.Leg{{User: "bob", Seller: "1", In: "3", Out: "2"}, {User: "erin", Seller: "3", In: "2", Out: "3"}}},
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{CSV, "tx_id,ex_time,ex_time_utc,seller_a,user_a,point_a,seller_b,user_b,point_b,legs,related\n" +
+			"t1,1480838400000,2016-12-04T08:00:00.000Z,1,bob,10,2,alice,20,,\"[{\"\"id\"\":\"\"1-a\"\",\"\"owner\"\":\"\"bob\"\"}]\"\n" +
+			"\"t,2\",1480838400250,2016-12-04T08:00:00.250Z,2,\"carol \"\"c\"\"\",5,1,dave,7,,\n" +
+			"r3,1480838400500,2016-12-04T08:00:00.500Z,,,,,,,\"[{\"\"USER_ID\"\":\"\"bob\"\",\"\"SELLER_ID\"\":\"\"1\"\",\"\"POINT_IN\"\":\"\"3\"\",\"\"POINT_OUT\"\":\"\"2\"\"},{\"\"USER_ID\"\":\"\"erin\"\",\"\"SELLER_ID\"\":\"\"3\"\",\"\"POINT_IN\"\":\"\"2\"\",\"\"POINT_OUT\"\":\"\"3\"\"}]\",\n"},
+		{NDJSON, `{"tx_id":"t1","ex_time":"1480838400000","ex_time_utc":"2016-12-04T08:00:00.000Z","seller_a":"1","user_a":"bob","point_a":"10","seller_b":"2","user_b":"alice","point_b":"20","legs":"","related":"[{\"id\":\"1-a\",\"owner\":\"bob\"}]"}` + "\n" +
+			`{"tx_id":"t,2","ex_time":"1480838400250","ex_time_utc":"2016-12-04T08:00:00.250Z","seller_a":"2","user_a":"carol \"c\"","point_a":"5","seller_b":"1","user_b":"dave","point_b":"7","legs":"","related":""}` + "\n" +
+			`{"tx_id":"r3","ex_time":"1480838400500","ex_time_utc":"2016-12-04T08:00:00.500Z","seller_a":"","user_a":"","point_a":"","seller_b":"","user_b":"","point_b":"",` +
+			`"legs":"[{\"USER_ID\":\"bob\",\"SELLER_ID\":\"1\",\"POINT_IN\":\"3\",\"POINT_OUT\":\"2\"},{\"USER_ID\":\"erin\",\"SELLER_ID\":\"3\",\"POINT_IN\":\"2\",\"POINT_OUT\":\"3\"}]","related":""}` + "\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range txs {
+			w.Write(tx)
+		}
+		sum, err := w.Close()
+		if err != nil || buf.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.format, buf.String(), tt.want)
+		}
+		h := sha256.Sum256(buf.Bytes())
+		if sum != hex.EncodeToString(h[:]) || w.Rows() != 3 {
+			t.Errorf("%s: checksum %s of %d rows", tt.format, sum, w.Rows())
+		}
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, "xlsx"); err == nil {
+		t.Error("xlsx accepted")
+	}
+}
+
+func TestEmptyExport(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, CSV)
+	w.Close()
+	if buf.String() != strings.Join(Columns, ",")+"\n" {
+		t.Errorf("empty CSV: %q", buf.String())
+	}
+	day := time.Date(2016, 12, 4, 0, 0, 0, 0, time.UTC)
+	name := Filename("1", day, day.AddDate(0, 0, 27), NDJSON)
+	if name != "ccpx-1-20161204-20161231.ndjson" || ChecksumLine("ab", name) != "ab  ccpx-1-20161204-20161231.ndjson\n" {
+		t.Errorf("Filename: %s", name)
+	}
+}
@@ -0,0 +1,726 @@
+// Package gateway is the HTTP webservice the sellers call. It replaces the
+// node server.js of docker-webservice and keeps its endpoints and JSON shapes.
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/export"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+)
+
+// exTimeLayout is how EX_TIME is shown to the sellers, in the gateway's time zone
+const exTimeLayout = "2006/01/02 15:04:05"
+
+// the START_TIME/END_TIME forms the node server accepted through Date.parse
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Server serves the seller API on top of the chaincode client
+type Server struct {
+	cc  *client.Client
+	loc *time.Location   //time zone of the sellers, EX_TIME is shown and START_TIME/END_TIME are read in it
+	now func() time.Time //clock of the record ids and exchange times
+	mux *http.ServeMux
+
+	keys pseudonym.Keys //secrets of the sellers whose members go on the ledger as pseudonyms
+}
+
+// New returns a gateway answering with times in loc
+func New(cc *client.Client, loc *time.Location) *Server {
+	s := &Server{cc: cc, loc: loc, now: time.Now, mux: http.NewServeMux()}
+
+	//API for prod
+	s.handle("POST", "/getLatExRec", s.getLatExRec)
+	s.handle("POST", "/getToExPo", s.getToExPo)
+	s.handle("POST", "/getExStats", s.getExStats)
+	s.handle("POST", "/responseStore", s.responseStore)
+	s.handle("POST", "/ringStore", s.ringStore)
+	s.handle("GET", "/exportEx", s.exportEx)
+	s.handle("POST", "/reconcile", s.reconcile)
+	s.handle("POST", "/getReconciliations", s.getReconciliations)
+	s.handle("POST", "/getReceipt", s.getReceipt)
+	s.handle("POST", "/getUserEx", s.getUserEx)
+	s.handle("POST", "/transfer", s.transfer)
+	s.handle("POST", "/getBalance", s.getBalance)
+	s.handle("POST", "/getTransfers", s.getTransfers)
+
+	//API for dev
+	s.handle("GET", "/query_point", s.queryPoint)
+	s.handle("GET", "/query_tx", s.queryTx)
+	s.handle("POST", "/read_key", s.readKey)
+	s.handle("POST", "/init_point", s.initPoint)
+	s.handle("POST", "/getpointdetail", s.getPointDetail)
+	s.handle("POST", "/getpointhistory", s.getPointHistory)
+	s.handle("POST", "/getpoint", s.getPoint)
+	return s
+}
+
+// SetPseudonymKeys makes the gateway record the members of the sellers of keys
+// as their pseudonyms, and look them up by them. Members that come as
+// pseudonyms already, e.g. in signed exchanges, are left as they are.
+//
+// Whoever runs the gateway can resolve the members of every seller in keys, so
+// give it only the keys of the sellers that trust its operator; the others hash
+// their members on their own side and send pseudonyms.
+func (s *Server) SetPseudonymKeys(keys pseudonym.Keys) {
+	s.keys = keys
+}
+
+// member is what the ledger holds for member user of seller
+func (s *Server) member(seller string, user string) (string, error) {
+	if !s.keys.Has(seller) || user == "" {
+		return user, nil
+	}
+	return s.keys.Pseudonym(seller, user)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handle(method string, path string, h func(w http.ResponseWriter, r *http.Request, p params)) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p, err := readParams(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+			return
+		}
+		log.Printf("got %s request", path) //not the parameters, they carry member ids and signatures
+		h(w, r, p)
+	})
+}
+
+// ============================================================================================================================
+// Answers - the JSON shapes of the node server
+// ============================================================================================================================
+
+// codeContent answers the prod queries, content is null unless respond is 300
+type codeContent struct {
+	Respond int         `json:"respond"`
+	Content interface{} `json:"content"`
+}
+
+// msg answers the dev endpoints, error is only set when the chaincode could not be reached
+type msg struct {
+	Msg   interface{} `json:"msg"`
+	ID    string      `json:"id,omitempty"` //the point init_point created, when the peer answers it
+	Error string      `json:"error,omitempty"`
+}
+
+// stored answers responseStore, respond tells whether the exchange was submitted
+type stored struct {
+	Msg      string `json:"msg"`
+	Respond  bool   `json:"respond"`
+	RecordID string `json:"record_id"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ============================================================================================================================
+// Params - the body fields, from a JSON object or a urlencoded form like body-parser took them
+// ============================================================================================================================
+type params map[string]string
+
+func readParams(r *http.Request) (params, error) {
+	p := make(params)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var fields map[string]interface{}
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return nil, err
+		}
+		for k, v := range fields {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				p[k] = v
+			case []interface{}, map[string]interface{}:
+				raw, _ := json.Marshal(v)
+				p[k] = string(raw)
+			default:
+				p[k] = fmt.Sprint(v)
+			}
+		}
+		return p, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	for k := range r.Form {
+		p[k] = r.Form.Get(k)
+	}
+	return p, nil
+}
+
+// readTime reads START_TIME/END_TIME in the gateway's time zone
+func (s *Server) readTime(v string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if tm, err := time.ParseInLocation(layout, strings.TrimSpace(v), s.loc); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot read time %q", v)
+}
+
+// showTimes rewrites the ms EX_TIME of each exchange into exTimeLayout
+func (s *Server) showTimes(txs []client.Transaction) {
+	for i := range txs {
+		txs[i].Timestamp = s.showTime(txs[i].Timestamp)
+	}
+}
+
+// showTime writes a ms timestamp in exTimeLayout, anything else is left as it is
+func (s *Server) showTime(v string) string {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return v
+	}
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).In(s.loc).Format(exTimeLayout)
+}
+
+// failed answers a failed chaincode call with the code of the chaincode, or 502
+// when it could not be reached; answer builds the JSON for a code
+func failed(w http.ResponseWriter, function string, err error, answer func(code int, message string) interface{}) {
+	var ccErr *client.Error
+	if errors.As(err, &ccErr) {
+		writeJSON(w, http.StatusOK, answer(ccErr.Code, ccErr.Message))
+		return
+	}
+	log.Printf("%s failed: %v", function, err)
+	writeJSON(w, http.StatusBadGateway, answer(chaincode.CodeParamError, err.Error()))
+}
+
+func codeAnswer(code int, message string) interface{} {
+	return codeContent{Respond: code}
+}
+
+// ============================================================================================================================
+// API for prod
+// ============================================================================================================================
+func (s *Server) getLatExRec(w http.ResponseWriter, r *http.Request, p params) {
+	num, err := strconv.Atoi(p["RECORD_NUM"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	txs, err := s.cc.LatestExchanges(p["SELLER_ID"], num)
+	if err != nil {
+		failed(w, "findLatest", err, codeAnswer)
+		return
+	}
+	s.showTimes(txs)
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: txs})
+}
+
+func (s *Server) getToExPo(w http.ResponseWriter, r *http.Request, p params) {
+	from, err1 := s.readTime(p["START_TIME"])
+	to, err2 := s.readTime(p["END_TIME"])
+	if err1 != nil || err2 != nil {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	txs, err := s.cc.ExchangesInRange(p["SELLER_ID"], from, to)
+	if err != nil {
+		failed(w, "findRange", err, codeAnswer)
+		return
+	}
+	s.showTimes(txs)
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: txs})
+}
+
+func (s *Server) getExStats(w http.ResponseWriter, r *http.Request, p params) {
+	from, err1 := s.readTime(p["START_TIME"])
+	to, err2 := s.readTime(p["END_TIME"])
+	if err1 != nil || err2 != nil {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	aggs, err := s.cc.Aggregates(p["SELLER_ID"], p["PERIOD"], from, to, p["PARTNER_ID"])
+	if err != nil {
+		failed(w, "findAggregate", err, codeAnswer)
+		return
+	}
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: aggs})
+}
+
+// exportEx hands out the exchanges of a seller between START_TIME and END_TIME
+// as a CSV (FORMAT=csv, the default) or NDJSON (FORMAT=ndjson) file. The file
+// is written out as it is encoded, its SHA-256 follows in the X-Checksum-Sha256
+// and Digest trailers.
+func (s *Server) exportEx(w http.ResponseWriter, r *http.Request, p params) {
+	from, err1 := s.readTime(p["START_TIME"])
+	to, err2 := s.readTime(p["END_TIME"])
+	format := p["FORMAT"]
+	if format == "" {
+		format = export.CSV
+	}
+	if err1 != nil || err2 != nil || (format != export.CSV && format != export.NDJSON) || p["SELLER_ID"] == "" {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	txs, err := s.cc.ExchangesInRange(p["SELLER_ID"], from, to)
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		failed(w, "findRange", err, codeAnswer)
+		return
+	}
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.Filename(p["SELLER_ID"], from, to, format)+`"`)
+	w.Header().Set("Trailer", "X-Checksum-Sha256, Digest")
+	w.WriteHeader(http.StatusOK)
+	ew, _ := export.NewWriter(w, format)
+	for _, tx := range txs {
+		if err := ew.Write(tx); err != nil {
+			log.Printf("exportEx: %v", err) //the client went away, the status is out already
+			return
+		}
+	}
+	sum, err := ew.Close()
+	if err != nil {
+		log.Printf("exportEx: %v", err)
+		return
+	}
+	raw, _ := hex.DecodeString(sum)
+	w.Header().Set("X-Checksum-Sha256", sum)
+	w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(raw))
+}
+
+// reconcileRecord is an exchange as the seller has it, EX_TIME in ms or in one of timeLayouts
+type reconcileRecord struct {
+	TxID   string      `json:"txID"`
+	User   string      `json:"USER_ID"`
+	Points json.Number `json:"POINTS"`
+	Time   interface{} `json:"EX_TIME"`
+}
+
+// reconcile compares the RECORDS of a seller between START_TIME and END_TIME
+// with the ledger. A peer that only acknowledges the invocation gives no
+// result yet, content then only has the id to read it with getReconciliations.
+func (s *Server) reconcile(w http.ResponseWriter, r *http.Request, p params) {
+	from, err1 := s.readTime(p["START_TIME"])
+	to, err2 := s.readTime(p["END_TIME"])
+	var given []reconcileRecord
+	dec := json.NewDecoder(strings.NewReader(p["RECORDS"]))
+	dec.UseNumber()
+	err3 := dec.Decode(&given)
+	if err1 != nil || err2 != nil || err3 != nil || p["SELLER_ID"] == "" {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	records := make([]client.Record, len(given))
+	for i, rec := range given {
+		points, err := rec.Points.Int64()
+		tm, errTime := s.readTime(fmt.Sprint(rec.Time))
+		if ms, err := strconv.ParseInt(fmt.Sprint(rec.Time), 10, 64); err == nil {
+			tm, errTime = time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), nil
+		}
+		if err != nil || errTime != nil {
+			writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+			return
+		}
+		records[i] = client.Record{TxID: rec.TxID, User: rec.User, Points: int(points), Time: tm}
+	}
+
+	res, txID, err := s.cc.Reconcile(p["SELLER_ID"], from, to, records)
+	if err != nil {
+		failed(w, "reconcile", err, codeAnswer)
+		return
+	}
+	if res == nil {
+		writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeRecorded, Content: map[string]string{"id": txID}})
+		return
+	}
+	s.showReconciliation(res)
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeRecorded, Content: res})
+}
+
+// getReconciliations answers the reconciliations recorded for a seller, or the one with id
+func (s *Server) getReconciliations(w http.ResponseWriter, r *http.Request, p params) {
+	var all []client.Reconciliation
+	var err error
+	if p["id"] != "" {
+		var res *client.Reconciliation
+		if res, err = s.cc.Reconciliation(p["SELLER_ID"], p["id"]); err == nil {
+			all = append(all, *res)
+		}
+	} else {
+		all, err = s.cc.Reconciliations(p["SELLER_ID"])
+	}
+	if err != nil {
+		failed(w, "findReconciliations", err, codeAnswer)
+		return
+	}
+	for i := range all {
+		s.showReconciliation(&all[i])
+	}
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: all})
+}
+
+// showReconciliation writes the times of a reconciliation in exTimeLayout
+func (s *Server) showReconciliation(res *client.Reconciliation) {
+	res.From, res.To, res.Timestamp = s.showTime(res.From), s.showTime(res.To), s.showTime(res.Timestamp)
+	for i := range res.Mismatches {
+		if res.Mismatches[i].Field == "EX_TIME" {
+			res.Mismatches[i].Ledger = s.showTime(res.Mismatches[i].Ledger)
+			res.Mismatches[i].Seller = s.showTime(res.Mismatches[i].Seller)
+		}
+	}
+}
+
+// getReceipt answers the Merkle receipt of the exchange txID, merkle.Receipt
+// checks it offline
+func (s *Server) getReceipt(w http.ResponseWriter, r *http.Request, p params) {
+	receipt, err := s.cc.Receipt(p["txID"])
+	if err != nil {
+		failed(w, "findReceipt", err, codeAnswer)
+		return
+	}
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: receipt})
+}
+
+// getUserEx answers the exchanges of member USER_ID of SELLER_ID. The member
+// is looked up by its pseudonym when the seller has one, and shown in clear on
+// the seller's side of the answer.
+func (s *Server) getUserEx(w http.ResponseWriter, r *http.Request, p params) {
+	seller, user := p["SELLER_ID"], p["USER_ID"]
+	ledger, err := s.member(seller, user)
+	if err != nil || seller == "" || user == "" {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	txs, err := s.cc.UserExchanges(seller, ledger)
+	if err != nil {
+		failed(w, "findUserEx", err, codeAnswer)
+		return
+	}
+	for i := range txs {
+		if txs[i].TraderA == ledger {
+			txs[i].TraderA = user
+		}
+		if txs[i].TraderB == ledger {
+			txs[i].TraderB = user
+		}
+		for j := range txs[i].Legs {
+			if txs[i].Legs[j].User == ledger {
+				txs[i].Legs[j].User = user
+			}
+		}
+	}
+	s.showTimes(txs)
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: txs})
+}
+
+func (s *Server) responseStore(w http.ResponseWriter, r *http.Request, p params) {
+	id := p["Request_id"]
+	now := s.now().In(s.loc).Truncate(time.Second)
+	dateStr := fmt.Sprintf("%d%d%d", now.Year(), int(now.Month()), now.Day())
+
+	ex := client.Exchange{
+		ID:      p["seller_A"] + "-" + p["seller_B"] + "-" + dateStr + "-" + id,
+		UserA:   p["user_A"],
+		UserB:   p["user_B"],
+		SellerA: p["seller_A"],
+		SellerB: p["seller_B"],
+		Time:    now,
+	}
+	var err1, err2 error
+	ex.UserA, err1 = s.member(ex.SellerA, ex.UserA)
+	ex.UserB, err2 = s.member(ex.SellerB, ex.UserB)
+	if err1 != nil || err2 != nil {
+		writeJSON(w, http.StatusInternalServerError, stored{Msg: "cannot pseudonymise the members", RecordID: id})
+		return
+	}
+	ex.PointsA, err1 = strconv.Atoi(p["point_A"])
+	ex.PointsB, err2 = strconv.Atoi(p["point_B"])
+	if err1 != nil || err2 != nil {
+		writeJSON(w, http.StatusBadRequest, stored{Msg: "point_A and point_B must be numbers", RecordID: id})
+		return
+	}
+	for _, side := range []struct{ key, owner string }{{"points_A", ex.UserA}, {"points_B", ex.UserB}} {
+		if p[side.key] == "" {
+			continue
+		}
+		var ids []string
+		if err := json.Unmarshal([]byte(p[side.key]), &ids); err != nil {
+			writeJSON(w, http.StatusBadRequest, stored{Msg: "points_A and points_B must be lists of point ids", RecordID: id})
+			return
+		}
+		for _, pointID := range ids {
+			ex.Related = append(ex.Related, client.Point{Id: pointID, Owner: side.owner}) //handed over to the other member
+		}
+	}
+	if p["nonce"] != "" {
+		//a signed exchange is recorded with the txID and EX_TIME (ms) the sellers signed
+		ms, err := strconv.ParseInt(p["EX_TIME"], 10, 64)
+		if err != nil || p["txID"] == "" {
+			writeJSON(w, http.StatusBadRequest, stored{Msg: "signed exchanges need the txID and EX_TIME (ms) that were signed", RecordID: id})
+			return
+		}
+		ex.ID, ex.Time = p["txID"], time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+		ex.Nonce, ex.SignatureA, ex.SignatureB = p["nonce"], p["signature_A"], p["signature_B"]
+	}
+	txID, err := s.cc.RecordExchange(ex)
+	if err != nil {
+		failed(w, "init_transaction", err, func(code int, message string) interface{} {
+			return stored{Msg: message, RecordID: id}
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, stored{Msg: txID, Respond: true, RecordID: id})
+}
+
+// ringLeg is a leg of ringStore, points as numbers or numeric strings
+type ringLeg struct {
+	User     string      `json:"user"`
+	Seller   string      `json:"seller"`
+	PointIn  json.Number `json:"point_in"`
+	PointOut json.Number `json:"point_out"`
+}
+
+// ringStore records a ring exchange: the member of each of the legs gives
+// point_out of its seller's points to the next leg and receives point_in from
+// the one before. A signed ring comes with the txID and EX_TIME (ms) that were
+// signed, its nonce and the signatures by seller.
+func (s *Server) ringStore(w http.ResponseWriter, r *http.Request, p params) {
+	id := p["Request_id"]
+	now := s.now().In(s.loc).Truncate(time.Second)
+	dateStr := fmt.Sprintf("%d%d%d", now.Year(), int(now.Month()), now.Day())
+
+	var legs []ringLeg
+	dec := json.NewDecoder(strings.NewReader(p["legs"]))
+	dec.UseNumber()
+	if err := dec.Decode(&legs); err != nil {
+		writeJSON(w, http.StatusBadRequest, stored{Msg: "legs must be a list of {user, seller, point_in, point_out}", RecordID: id})
+		return
+	}
+	ring := client.Ring{Time: now}
+	var sellers []string
+	for _, leg := range legs {
+		in, err1 := leg.PointIn.Int64()
+		out, err2 := leg.PointOut.Int64()
+		if err1 != nil || err2 != nil {
+			writeJSON(w, http.StatusBadRequest, stored{Msg: "point_in and point_out must be numbers", RecordID: id})
+			return
+		}
+		user, err := s.member(leg.Seller, leg.User)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, stored{Msg: "cannot pseudonymise the members", RecordID: id})
+			return
+		}
+		ring.Legs = append(ring.Legs, client.RingLeg{User: user, Seller: leg.Seller, PointsIn: int(in), PointsOut: int(out)})
+		sellers = append(sellers, leg.Seller)
+	}
+	ring.ID = strings.Join(sellers, "-") + "-" + dateStr + "-" + id
+	if p["nonce"] != "" {
+		ms, err := strconv.ParseInt(p["EX_TIME"], 10, 64)
+		if err != nil || p["txID"] == "" || (p["signatures"] != "" && json.Unmarshal([]byte(p["signatures"]), &ring.Signatures) != nil) {
+			writeJSON(w, http.StatusBadRequest, stored{Msg: "signed rings need the txID and EX_TIME (ms) that were signed, and signatures by seller", RecordID: id})
+			return
+		}
+		ring.ID, ring.Time, ring.Nonce = p["txID"], time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), p["nonce"]
+	}
+	txID, err := s.cc.RecordRing(ring)
+	if err != nil {
+		failed(w, "init_ring_exchange", err, func(code int, message string) interface{} {
+			return stored{Msg: message, RecordID: id}
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, stored{Msg: txID, Respond: true, RecordID: id})
+}
+
+// transfer moves POINTS of SELLER_ID's points from its member FROM_ID to its
+// member TO_ID. The sending member authorises every transfer: signature is its
+// signature over the transfer with nonce, see client.Transfer. Members of
+// sellers with pseudonyms sign the pseudonyms, which are left as they are.
+func (s *Server) transfer(w http.ResponseWriter, r *http.Request, p params) {
+	seller := p["SELLER_ID"]
+	points, err := strconv.Atoi(p["POINTS"])
+	from, errFrom := s.member(seller, p["FROM_ID"])
+	to, errTo := s.member(seller, p["TO_ID"])
+	if err != nil || errFrom != nil || errTo != nil || seller == "" {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	tr := client.Transfer{Seller: seller, From: from, To: to, Points: points, Nonce: p["nonce"], Signature: p["signature"]}
+	res, txID, err := s.cc.RecordTransfer(tr)
+	if err != nil {
+		failed(w, "transfer_points", err, codeAnswer)
+		return
+	}
+	if res == nil {
+		writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeRecorded, Content: map[string]string{"id": txID}})
+		return
+	}
+	s.showTransfer(res, map[string]string{from: p["FROM_ID"], to: p["TO_ID"]})
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeRecorded, Content: res})
+}
+
+// getBalance answers what member USER_ID holds of the points of SELLER_ID
+func (s *Server) getBalance(w http.ResponseWriter, r *http.Request, p params) {
+	seller, user := p["SELLER_ID"], p["USER_ID"]
+	ledger, err := s.member(seller, user)
+	if err != nil || seller == "" || user == "" {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	bal, err := s.cc.Balance(seller, ledger)
+	if err != nil {
+		failed(w, "findBalance", err, codeAnswer)
+		return
+	}
+	bal.User = user
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: bal})
+}
+
+// getTransfers answers the transfers between the members of SELLER_ID, or
+// those member USER_ID sent or received, shown in clear
+func (s *Server) getTransfers(w http.ResponseWriter, r *http.Request, p params) {
+	seller, user := p["SELLER_ID"], p["USER_ID"]
+	ledger, err := s.member(seller, user)
+	if err != nil || seller == "" {
+		writeJSON(w, http.StatusBadRequest, codeContent{Respond: chaincode.CodeParamError})
+		return
+	}
+	all, err := s.cc.Transfers(seller, ledger)
+	if err != nil {
+		failed(w, "findTransfers", err, codeAnswer)
+		return
+	}
+	for i := range all {
+		s.showTransfer(&all[i], map[string]string{ledger: user})
+	}
+	writeJSON(w, http.StatusOK, codeContent{Respond: chaincode.CodeEnquiryOK, Content: all})
+}
+
+// showTransfer writes the time of a transfer in exTimeLayout and its members
+// in clear where clear knows them
+func (s *Server) showTransfer(res *client.PointTransfer, clear map[string]string) {
+	res.Timestamp = s.showTime(res.Timestamp)
+	if user, ok := clear[res.From]; ok && user != "" {
+		res.From = user
+	}
+	if user, ok := clear[res.To]; ok && user != "" {
+		res.To = user
+	}
+}
+
+// ============================================================================================================================
+// API for dev
+// ============================================================================================================================
+
+// msgAnswer is {"msg": v} once the call went through, v is null when there is no record
+func (s *Server) msgAnswer(w http.ResponseWriter, function string, v interface{}, err error) {
+	if err == nil {
+		writeJSON(w, http.StatusOK, msg{Msg: v})
+		return
+	}
+	failed(w, function, err, func(code int, message string) interface{} {
+		if client.Code(err) != 0 {
+			return msg{}
+		}
+		return msg{Error: message}
+	})
+}
+
+func (s *Server) queryPoint(w http.ResponseWriter, r *http.Request, p params) {
+	ids, err := s.cc.PointIDs()
+	if err != nil && client.Code(err) == 0 {
+		failed(w, "read", err, func(code int, message string) interface{} { return msg{Error: message} })
+		return
+	}
+	writeJSON(w, http.StatusOK, ids) //the bare index, like the node server
+}
+
+func (s *Server) queryTx(w http.ResponseWriter, r *http.Request, p params) {
+	txs, err := s.cc.Exchanges()
+	s.msgAnswer(w, "read", client.AllTx{TXs: txs}, err)
+}
+
+func (s *Server) readKey(w http.ResponseWriter, r *http.Request, p params) {
+	raw, err := s.cc.ReadKey(p["key"])
+	s.msgAnswer(w, "read", raw, err)
+}
+
+func (s *Server) getPointDetail(w http.ResponseWriter, r *http.Request, p params) {
+	raw, err := s.cc.ReadKey(p["point_id"])
+	s.msgAnswer(w, "read", raw, err)
+}
+
+func (s *Server) getPointHistory(w http.ResponseWriter, r *http.Request, p params) {
+	hist, err := s.cc.PointHistory(p["point_id"])
+	s.msgAnswer(w, "findPointHistory", hist, err)
+}
+
+func (s *Server) getPoint(w http.ResponseWriter, r *http.Request, p params) {
+	points, err := s.cc.PointsOf(p["owner"])
+	if err != nil && client.Code(err) == 0 {
+		failed(w, "findPointWithOwner", err, func(code int, message string) interface{} { return msg{Error: message} })
+		return
+	}
+	if points == nil {
+		points = []client.Point{} //no points answers an empty list
+	}
+	writeJSON(w, http.StatusOK, msg{Msg: points})
+}
+
+func (s *Server) initPoint(w http.ResponseWriter, r *http.Request, p params) {
+	now := s.now().In(s.loc)
+	dateStr := fmt.Sprintf("%d%d%d", now.Year(), int(now.Month())-1, now.Day()) //same ids as the node server, months from 0
+	point, txID, err := s.cc.IssuePoint(p["seller"]+"-"+dateStr, p["owner"])
+	if err != nil {
+		failed(w, "init_point", err, func(code int, message string) interface{} {
+			if client.Code(err) != 0 {
+				return msg{Msg: message}
+			}
+			return msg{Error: message}
+		})
+		return
+	}
+	res := msg{Msg: txID}
+	if point != nil {
+		res.ID = point.Id
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// ParseZone reads a time zone flag: "Local", an IANA name like "Asia/Taipei" or a fixed offset like "+08:00"
+func ParseZone(v string) (*time.Location, error) {
+	if v == "" || v == "Local" {
+		return time.Local, nil
+	}
+	if tm, err := time.Parse("-07:00", v); err == nil {
+		_, offset := tm.Zone()
+		return time.FixedZone("UTC"+v, offset), nil
+	}
+	return time.LoadLocation(v)
+}
@@ -0,0 +1,517 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/merkle"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/pseudonym"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// stubTransport runs the real chaincode in process on a shimtest stub
+type stubTransport struct {
+	stub *shimtest.MockStub
+	n    int
+}
+
+func newStubClient(t *testing.T) *client.Client {
+	c := &stubTransport{stub: shimtest.NewMockStub("ccpx", new(chaincode.SimpleChaincode))}
+	if res := c.stub.MockInit("deploy", [][]byte{[]byte("init"), []byte("99")}); res.Status != 200 {
+		t.Fatalf("init: %s", res.Message)
+	}
+	return client.New(c)
+}
+
+// newAdminClient is newStubClient calling with a certificate carrying the admin role, the way fabric-ca encodes it
+func newAdminClient(t *testing.T) *client.Client {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "admin"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: []byte(`{"attrs":{"role":"admin"}}`)}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &stubTransport{stub: shimtest.NewMockStub("ccpx", new(chaincode.SimpleChaincode))}
+	c.stub.Creator, _ = proto.Marshal(&msp.SerializedIdentity{Mspid: "CCPXMSP", IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+	if res := c.stub.MockInit("deploy", [][]byte{[]byte("init"), []byte("99")}); res.Status != 200 {
+		t.Fatalf("init: %s", res.Message)
+	}
+	return client.New(c)
+}
+
+func (c *stubTransport) Invoke(function string, args []string) (string, []byte, error) {
+	c.n++
+	txID := "tx" + strconv.Itoa(c.n)
+	argv := [][]byte{[]byte(function)}
+	for _, a := range args {
+		argv = append(argv, []byte(a))
+	}
+	return txID, c.stub.MockInvoke(txID, argv).Payload, nil
+}
+
+func (c *stubTransport) Query(function string, args []string) ([]byte, error) {
+	_, envelope, err := c.Invoke(function, args)
+	return envelope, err
+}
+
+// downTransport is a peer that cannot be reached
+type downTransport struct{}
+
+func (downTransport) Invoke(function string, args []string) (string, []byte, error) {
+	return "", nil, errors.New("connection refused")
+}
+
+func (downTransport) Query(function string, args []string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+var taipei = time.FixedZone("UTC+08:00", 8*3600)
+
+func newServer(cc *client.Client, now time.Time) *Server {
+	s := New(cc, taipei)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func postJSON(t *testing.T, s http.Handler, path string, body string) (int, string) {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return serve(s, r)
+}
+
+func postForm(t *testing.T, s http.Handler, path string, form url.Values) (int, string) {
+	r := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(s, r)
+}
+
+func serve(s http.Handler, r *http.Request) (int, string) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	body, _ := io.ReadAll(w.Result().Body)
+	return w.Code, strings.TrimSpace(string(body))
+}
+
+// store records an exchange between seller 1 and seller 2 through /responseStore
+func store(t *testing.T, s *Server, id string, at time.Time) {
+	s.now = func() time.Time { return at }
+	code, body := postJSON(t, s, "/responseStore",
+		`{"Request_id":"`+id+`","seller_A":"1","seller_B":"2","user_A":"bob","user_B":"alice","point_A":10,"point_B":"20"}`)
+	if code != http.StatusOK || !strings.Contains(body, `"respond":true`) {
+		t.Fatalf("responseStore %s: %d %s", id, code, body)
+	}
+}
+
+func TestResponseStore(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	s := newServer(newStubClient(t), time.Date(2016, 12, 4, 8, 30, 15, 500e6, taipei))
+	code, body := postJSON(t, s, "/responseStore",
+		`{"Request_id":"r1","seller_A":"1","seller_B":"2","user_A":"bob","user_B":"alice","point_A":10,"point_B":20}`)
+	if code != http.StatusOK || body != `{"msg":"tx1","respond":true,"record_id":"r1"}` {
+		t.Fatalf("responseStore: %d %s", code, body)
+	}
+	if !strings.Contains(logged.String(), "/responseStore") || strings.Contains(logged.String(), "bob") {
+		t.Errorf("request log %q", logged.String())
+	}
+
+	code, body = serve(s, httptest.NewRequest("GET", "/query_tx", nil))
+	want := `{"msg":{"tx":[{"txID":"1-2-2016124-r1","EX_TIME":"1480811415000","USER_A_ID":"bob","USER_B_ID":"alice",` +
+		`"SELLER_A_ID":"1","SELLER_B_ID":"2","POINT_A":"10","POINT_B":"20","related":null}]}}`
+	if code != http.StatusOK || body != want {
+		t.Errorf("query_tx: %d %s", code, body)
+	}
+
+	code, body = postJSON(t, s, "/responseStore", `{"Request_id":"r2","seller_A":"1","point_A":1,"point_B":2}`)
+	if code != http.StatusOK || !strings.Contains(body, `"respond":false`) || !strings.Contains(body, `"record_id":"r2"`) {
+		t.Errorf("incomplete responseStore: %d %s", code, body)
+	}
+	code, body = postJSON(t, s, "/responseStore", `{"Request_id":"r3","point_A":"ten","point_B":2}`)
+	if code != http.StatusBadRequest || !strings.Contains(body, `"respond":false`) {
+		t.Errorf("responseStore with bad points: %d %s", code, body)
+	}
+}
+
+func TestBundleResponseStore(t *testing.T) {
+	cc := newStubClient(t)
+	s := newServer(cc, time.Date(2016, 12, 4, 8, 30, 15, 0, taipei))
+	cc.CreatePoint("1-a", "bob")
+	cc.CreatePoint("2-a", "alice")
+	code, body := postJSON(t, s, "/responseStore",
+		`{"Request_id":"r1","seller_A":"1","seller_B":"2","user_A":"bob","user_B":"alice","point_A":10,"point_B":20,"points_A":["1-a"],"points_B":["2-a"]}`)
+	if code != http.StatusOK || !strings.Contains(body, `"respond":true`) {
+		t.Fatalf("bundle responseStore: %d %s", code, body)
+	}
+	code, body = postJSON(t, s, "/getLatExRec", `{"SELLER_ID":1,"RECORD_NUM":1}`)
+	if code != http.StatusOK || !strings.Contains(body, `"related":[{"id":"1-a","owner":"bob"},{"id":"2-a","owner":"alice"}]`) {
+		t.Errorf("getLatExRec: %d %s", code, body)
+	}
+	if p, _ := cc.Point("1-a"); p == nil || p.Owner != "alice" {
+		t.Errorf("1-a went to %+v", p)
+	}
+	code, body = postJSON(t, s, "/responseStore",
+		`{"Request_id":"r2","seller_A":"1","seller_B":"2","user_A":"bob","user_B":"alice","point_A":1,"point_B":2,"points_A":"1-a"}`)
+	if code != http.StatusBadRequest || !strings.Contains(body, `"record_id":"r2"`) {
+		t.Errorf("responseStore with points_A not a list: %d %s", code, body)
+	}
+}
+
+func TestSignedResponseStore(t *testing.T) {
+	cc := newStubClient(t)
+	s := newServer(cc, time.Date(2016, 12, 4, 8, 30, 15, 0, taipei))
+	body := `{"Request_id":"r1","seller_A":"1","seller_B":"2","user_A":"bob","user_B":"alice","point_A":10,"point_B":20,` +
+		`"txID":"signed-1","EX_TIME":"1480811415000","nonce":"n1","signature_A":"c2ln"}`
+	code, got := postJSON(t, s, "/responseStore", body)
+	if code != http.StatusOK || got != `{"msg":"tx1","respond":true,"record_id":"r1"}` {
+		t.Fatalf("signed responseStore without seller keys: %d %s", code, got)
+	}
+	if txs, _ := cc.Exchanges(); len(txs) != 1 || txs[0].Id != "signed-1" || txs[0].Timestamp != "1480811415000" {
+		t.Errorf("recorded %+v", txs)
+	}
+	code, got = postJSON(t, s, "/responseStore", `{"Request_id":"r2","seller_A":"1","seller_B":"2","point_A":1,"point_B":2,"nonce":"n2"}`)
+	if code != http.StatusBadRequest || !strings.Contains(got, `"respond":false`) {
+		t.Errorf("signed responseStore without txID: %d %s", code, got)
+	}
+}
+
+func TestRingStore(t *testing.T) {
+	cc := newStubClient(t)
+	s := newServer(cc, time.Date(2016, 12, 4, 8, 30, 15, 0, taipei))
+	code, body := postJSON(t, s, "/ringStore", `{"Request_id":"r1","legs":[`+
+		`{"user":"bob","seller":"1","point_in":30,"point_out":10},`+
+		`{"user":"alice","seller":"2","point_in":10,"point_out":20},`+
+		`{"user":"carol","seller":"3","point_in":"20","point_out":"30"}]}`)
+	if code != http.StatusOK || body != `{"msg":"tx1","respond":true,"record_id":"r1"}` {
+		t.Fatalf("ringStore: %d %s", code, body)
+	}
+	code, body = postJSON(t, s, "/getLatExRec", `{"SELLER_ID":3,"RECORD_NUM":1}`)
+	if code != http.StatusOK || !strings.Contains(body, `"txID":"1-2-3-2016124-r1"`) ||
+		!strings.Contains(body, `{"USER_ID":"carol","SELLER_ID":"3","POINT_IN":"20","POINT_OUT":"30"}`) {
+		t.Errorf("getLatExRec of seller 3: %d %s", code, body)
+	}
+
+	code, body = postJSON(t, s, "/ringStore", `{"Request_id":"r2","legs":[{"user":"bob","seller":"1","point_in":5,"point_out":10},`+
+		`{"user":"alice","seller":"2","point_in":10,"point_out":20}]}`)
+	if code != http.StatusOK || !strings.Contains(body, `"respond":false`) {
+		t.Errorf("ring that does not add up: %d %s", code, body)
+	}
+	code, body = postJSON(t, s, "/ringStore", `{"Request_id":"r3","legs":"bob"}`)
+	if code != http.StatusBadRequest || !strings.Contains(body, `"record_id":"r3"`) {
+		t.Errorf("ringStore without legs: %d %s", code, body)
+	}
+}
+
+func TestPseudonyms(t *testing.T) {
+	cc := newStubClient(t)
+	s := newServer(cc, time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	keys := pseudonym.Keys{"1": []byte("0123456789abcdef")}
+	s.SetPseudonymKeys(keys)
+	store(t, s, "r1", time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+
+	bob, _ := keys.Pseudonym("1", "bob")
+	txs, _ := cc.Exchanges()
+	if len(txs) != 1 || txs[0].TraderA != bob || txs[0].TraderB != "alice" {
+		t.Fatalf("recorded %+v", txs)
+	}
+	code, body := postJSON(t, s, "/getUserEx", `{"SELLER_ID":"1","USER_ID":"bob"}`)
+	if code != http.StatusOK || !strings.Contains(body, `"USER_A_ID":"bob"`) || !strings.Contains(body, `"EX_TIME":"2016/12/04 08:00:00"`) {
+		t.Errorf("getUserEx of bob: %d %s", code, body)
+	}
+	if _, body := postJSON(t, s, "/getUserEx", `{"SELLER_ID":"2","USER_ID":"alice"}`); !strings.Contains(body, `"USER_A_ID":"`+bob+`"`) {
+		t.Errorf("seller 2 sees bob as %s", body)
+	}
+	if _, body := postJSON(t, s, "/getUserEx", `{"SELLER_ID":"1","USER_ID":"carol"}`); body != `{"respond":401,"content":null}` {
+		t.Errorf("getUserEx of a member without exchanges: %s", body)
+	}
+}
+
+func TestGetLatExRec(t *testing.T) {
+	s := newServer(newStubClient(t), time.Time{})
+	store(t, s, "r1", time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	store(t, s, "r2", time.Date(2016, 12, 5, 23, 59, 59, 0, taipei))
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"latest", `{"SELLER_ID":1,"RECORD_NUM":1}`,
+			`{"respond":300,"content":[{"txID":"1-2-2016125-r2","EX_TIME":"2016/12/05 23:59:59","USER_A_ID":"bob","USER_B_ID":"alice",` +
+				`"SELLER_A_ID":"1","SELLER_B_ID":"2","POINT_A":"10","POINT_B":"20","related":null}]}`},
+		{"no records", `{"SELLER_ID":"9","RECORD_NUM":"1"}`, `{"respond":401,"content":null}`},
+		{"bad seller", `{"SELLER_ID":"x","RECORD_NUM":"1"}`, `{"respond":500,"content":null}`},
+	}
+	for _, tt := range tests {
+		code, body := postJSON(t, s, "/getLatExRec", tt.body)
+		if code != http.StatusOK || body != tt.want {
+			t.Errorf("%s: %d %s, want %s", tt.name, code, body, tt.want)
+		}
+	}
+}
+
+func TestGetToExPo(t *testing.T) {
+	s := newServer(newStubClient(t), time.Time{})
+	store(t, s, "r1", time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	store(t, s, "r2", time.Date(2016, 12, 5, 8, 0, 0, 0, taipei))
+
+	tests := []struct {
+		name     string
+		from, to string
+		respond  int
+		n        int
+	}{
+		{"local day", "2016/12/04", "2016/12/04 23:59:59", 300, 1},
+		{"both days", "2016-12-04", "2016-12-06", 300, 2},
+		{"explicit offset", "2016-12-05T00:00:00Z", "2016-12-05T00:00:00Z", 300, 1},
+		{"nothing", "2016/12/06", "2016/12/07", 401, 0},
+		{"unreadable", "tomorrow", "2016/12/07", 500, 0},
+	}
+	for _, tt := range tests {
+		_, body := postForm(t, s, "/getToExPo", url.Values{"SELLER_ID": {"2"}, "START_TIME": {tt.from}, "END_TIME": {tt.to}})
+		var got struct {
+			Respond int                     `json:"respond"`
+			Content []chaincode.Transaction `json:"content"`
+		}
+		json.Unmarshal([]byte(body), &got)
+		if got.Respond != tt.respond || len(got.Content) != tt.n {
+			t.Errorf("%s: %s", tt.name, body)
+		}
+	}
+}
+
+func TestExportEx(t *testing.T) {
+	s := newServer(newStubClient(t), time.Time{})
+	store(t, s, "r1", time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	store(t, s, "r2", time.Date(2016, 12, 5, 8, 0, 0, 0, taipei))
+
+	tests := []struct {
+		name, query string
+		status      int
+		lines       int
+		mime        string
+	}{
+		{"csv", "SELLER_ID=2&START_TIME=2016-12-04&END_TIME=2016-12-06", http.StatusOK, 3, "text/csv; charset=utf-8"},
+		{"ndjson", "SELLER_ID=1&START_TIME=2016-12-05&END_TIME=2016-12-06&FORMAT=ndjson", http.StatusOK, 1, "application/x-ndjson"},
+		{"no exchanges", "SELLER_ID=1&START_TIME=2017-01-01&END_TIME=2017-01-31", http.StatusOK, 1, "text/csv; charset=utf-8"},
+		{"bad format", "SELLER_ID=1&START_TIME=2016-12-04&END_TIME=2016-12-06&FORMAT=xlsx", http.StatusBadRequest, 1, "application/json; charset=utf-8"},
+		{"no seller", "START_TIME=2016-12-04&END_TIME=2016-12-06", http.StatusBadRequest, 1, "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/exportEx?"+tt.query, nil))
+		body := w.Body.String()
+		if w.Code != tt.status || strings.Count(body, "\n") != tt.lines || w.Header().Get("Content-Type") != tt.mime {
+			t.Errorf("%s: %d %s %q", tt.name, w.Code, w.Header().Get("Content-Type"), body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		sum := sha256.Sum256(w.Body.Bytes())
+		trailer := w.Result().Trailer
+		if trailer.Get("X-Checksum-Sha256") != hex.EncodeToString(sum[:]) ||
+			trailer.Get("Digest") != "sha-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+			t.Errorf("%s: checksum trailers %v", tt.name, trailer)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	s := newServer(newStubClient(t), time.Time{})
+	store(t, s, "r1", time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	store(t, s, "r2", time.Date(2016, 12, 5, 8, 0, 0, 0, taipei))
+
+	code, body := postJSON(t, s, "/reconcile", `{"SELLER_ID":"1","START_TIME":"2016-12-04","END_TIME":"2016-12-06","RECORDS":[`+
+		`{"txID":"1-2-2016124-r1","USER_ID":"bob","POINTS":10,"EX_TIME":"2016/12/04 08:00:00"},`+
+		`{"txID":"1-2-2016125-r2","USER_ID":"bob","POINTS":10,"EX_TIME":1480899600000},`+
+		`{"txID":"x","USER_ID":"bob","POINTS":1,"EX_TIME":"2016/12/04"}]}`)
+	var got struct {
+		Respond int                      `json:"respond"`
+		Content chaincode.Reconciliation `json:"content"`
+	}
+	json.Unmarshal([]byte(body), &got)
+	res := got.Content
+	if code != http.StatusOK || got.Respond != chaincode.CodeRecorded || res.Matched != 1 || len(res.MissingOnLedger) != 1 ||
+		len(res.Mismatches) != 1 || res.Mismatches[0].Ledger != "2016/12/05 08:00:00" || res.Mismatches[0].Seller != "2016/12/05 09:00:00" {
+		t.Fatalf("reconcile: %d %s", code, body)
+	}
+
+	code, body = postJSON(t, s, "/getReconciliations", `{"SELLER_ID":"1","id":"`+res.Id+`"}`)
+	if code != http.StatusOK || !strings.Contains(body, `"respond":300`) || !strings.Contains(body, `"START_TIME":"2016/12/04 00:00:00"`) {
+		t.Errorf("getReconciliations: %d %s", code, body)
+	}
+	if _, body := postJSON(t, s, "/getReconciliations", `{"SELLER_ID":"2"}`); body != `{"respond":401,"content":null}` {
+		t.Errorf("getReconciliations of a seller that never reconciled: %s", body)
+	}
+	for _, bad := range []string{
+		`{"SELLER_ID":"1","START_TIME":"2016-12-04","END_TIME":"2016-12-06","RECORDS":{"txID":"x"}}`,
+		`{"SELLER_ID":"1","START_TIME":"2016-12-04","END_TIME":"2016-12-06","RECORDS":[{"txID":"x","POINTS":1,"EX_TIME":"soon"}]}`,
+	} {
+		if code, body := postJSON(t, s, "/reconcile", bad); code != http.StatusBadRequest || body != `{"respond":500,"content":null}` {
+			t.Errorf("reconcile %s: %d %s", bad, code, body)
+		}
+	}
+}
+
+func TestGetReceipt(t *testing.T) {
+	s := newServer(newStubClient(t), time.Time{})
+	store(t, s, "r1", time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	store(t, s, "r2", time.Date(2016, 12, 4, 9, 0, 0, 0, taipei))
+
+	code, body := postJSON(t, s, "/getReceipt", `{"txID":"1-2-2016124-r2"}`)
+	var got struct {
+		Respond int            `json:"respond"`
+		Content merkle.Receipt `json:"content"`
+	}
+	json.Unmarshal([]byte(body), &got)
+	if code != http.StatusOK || got.Respond != chaincode.CodeEnquiryOK || got.Content.Size != 2 || got.Content.Verify() != nil {
+		t.Errorf("getReceipt: %d %s", code, body)
+	}
+	if _, body := postJSON(t, s, "/getReceipt", `{"txID":"nope"}`); body != `{"respond":401,"content":null}` {
+		t.Errorf("getReceipt of an unknown exchange: %s", body)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	s := newServer(newStubClient(t), time.Date(2016, 12, 4, 8, 0, 0, 0, taipei))
+	if _, body := postJSON(t, s, "/getpoint", `{"owner":"bob"}`); body != `{"msg":[]}` {
+		t.Errorf("getpoint before init_point: %s", body)
+	}
+	if _, body := postJSON(t, s, "/init_point", `{"seller":"1","owner":"Bob"}`); body != `{"msg":"tx2","id":"1-2016114-1"}` {
+		t.Errorf("init_point: %s", body)
+	}
+	if _, body := postJSON(t, s, "/init_point", `{"seller":"1","owner":"bob"}`); body != `{"msg":"tx3","id":"1-2016114-2"}` {
+		t.Errorf("second init_point the same day: %s", body)
+	}
+	if _, body := postJSON(t, s, "/getpoint", `{"owner":"bob"}`); body != `{"msg":[{"id":"1-2016114-1","owner":"bob"},{"id":"1-2016114-2","owner":"bob"}]}` {
+		t.Errorf("getpoint: %s", body)
+	}
+	if _, body := serve(s, httptest.NewRequest("GET", "/query_point", nil)); body != `["1-2016114-1","1-2016114-2"]` {
+		t.Errorf("query_point: %s", body)
+	}
+	if _, body := postJSON(t, s, "/init_point", `{"seller":"1","owner":""}`); body != `{"msg":"2nd argument owner must be a non-empty string"}` {
+		t.Errorf("init_point without owner: %s", body)
+	}
+}
+
+func TestBackendDown(t *testing.T) {
+	s := newServer(client.New(downTransport{}), time.Now())
+	tests := []struct {
+		path, body, want string
+	}{
+		{"/getLatExRec", `{"SELLER_ID":"1","RECORD_NUM":"1"}`, `{"respond":500,"content":null}`},
+		{"/getToExPo", `{"SELLER_ID":"1","START_TIME":"2016/12/04","END_TIME":"2016/12/05"}`, `{"respond":500,"content":null}`},
+		{"/responseStore", `{"Request_id":"r1","point_A":1,"point_B":2}`, `{"msg":"connection refused","respond":false,"record_id":"r1"}`},
+		{"/init_point", `{"seller":"1","owner":"bob"}`, `{"msg":null,"error":"connection refused"}`},
+		{"/getpoint", `{"owner":"bob"}`, `{"msg":null,"error":"connection refused"}`},
+	}
+	for _, tt := range tests {
+		code, body := postJSON(t, s, tt.path, tt.body)
+		if code != http.StatusBadGateway || body != tt.want {
+			t.Errorf("%s: %d %s, want %s", tt.path, code, body, tt.want)
+		}
+	}
+	if code, _ := serve(s, httptest.NewRequest("GET", "/getLatExRec", nil)); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /getLatExRec: %d", code)
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	tests := []struct {
+		in     string
+		offset int
+	}{
+		{"+08:00", 8 * 3600},
+		{"-03:30", -(3*3600 + 1800)},
+		{"UTC", 0},
+		{"Asia/Taipei", 8 * 3600},
+	}
+	at := time.Date(2016, 12, 4, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		loc, err := ParseZone(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if _, offset := at.In(loc).Zone(); offset != tt.offset {
+			t.Errorf("%s: offset %d, want %d", tt.in, offset, tt.offset)
+		}
+	}
+	if _, err := ParseZone("Mars/Olympus"); err == nil {
+		t.Error("unknown zone accepted")
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	cc := newAdminClient(t)
+	s := newServer(cc, time.Now())
+	keys := pseudonym.Keys{"1": []byte("0123456789abcdef")}
+	s.SetPseudonymKeys(keys)
+	cc.SetSellerPolicy("1", map[string]interface{}{"pseudonymous": true, "transfers": true})
+	bob, _ := keys.Pseudonym("1", "bob")
+	alice, _ := keys.Pseudonym("1", "alice")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) //bob's own key
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if _, err := cc.RegisterMemberKey("1", bob, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil); err != nil {
+		t.Fatalf("RegisterMemberKey: %v", err)
+	}
+	if _, _, err := cc.CreditMember("1", bob, 50); err != nil {
+		t.Fatalf("CreditMember: %v", err)
+	}
+
+	tr := client.Transfer{Seller: "1", From: bob, To: alice, Points: 20, Nonce: "n1"}
+	tr.Signature, _ = tr.Sign(key)
+	code, body := postJSON(t, s, "/transfer", `{"SELLER_ID":"1","FROM_ID":"bob","TO_ID":"alice","POINTS":20,"nonce":"n1","signature":"`+tr.Signature+`"}`)
+	if code != http.StatusOK || !strings.Contains(body, `"respond":100`) || !strings.Contains(body, `"FROM_ID":"bob","TO_ID":"alice","POINTS":20`) {
+		t.Errorf("transfer: %d %s", code, body)
+	}
+	if _, body := postJSON(t, s, "/transfer", `{"SELLER_ID":"1","FROM_ID":"bob","TO_ID":"alice","POINTS":20,"nonce":"n2","signature":"`+tr.Signature+`"}`); body != `{"respond":200,"content":null}` {
+		t.Errorf("transfer with the signature of another: %s", body)
+	}
+	if code, _ := postJSON(t, s, "/transfer", `{"SELLER_ID":"1","FROM_ID":"bob","TO_ID":"alice","POINTS":"x"}`); code != http.StatusBadRequest {
+		t.Errorf("transfer without points: %d", code)
+	}
+	if _, body := postJSON(t, s, "/getBalance", `{"SELLER_ID":"1","USER_ID":"alice"}`); !strings.Contains(body, `"USER_ID":"alice","POINTS":20`) {
+		t.Errorf("getBalance: %s", body)
+	}
+	if _, body := postJSON(t, s, "/getTransfers", `{"SELLER_ID":"1","USER_ID":"alice"}`); !strings.Contains(body, `"TO_ID":"alice"`) || !strings.Contains(body, `"FROM_ID":"`+bob+`"`) {
+		t.Errorf("getTransfers of alice: %s", body)
+	}
+	if _, body := postJSON(t, s, "/getTransfers", `{"SELLER_ID":"2"}`); body != `{"respond":401,"content":null}` {
+		t.Errorf("getTransfers of a seller without any: %s", body)
+	}
+}
@@ -1,3 +1,8 @@
+//go:build ignore
+
+// ccpx06 is the CCPX chaincode as it ran on Fabric 0.6 peers, before the port to the fabric-chaincode-go shim.
+// ccpx.zip next to it is what a 0.6 peer deploys, see "ccpxctl deploy -legacy". It does not build against the current shim.
+
 /*
 Licensed to the Apache Software Foundation (ASF) under one
 or more contributor license agreements.  See the NOTICE file
@@ -0,0 +1,201 @@
+// Package merkle is the Merkle tree the chaincode keeps over the exchanges of
+// each period, and the verifier of the receipts it hands out. It has no
+// dependency outside the standard library so a seller, or anybody a member
+// shows a receipt to, can check it offline.
+//
+// The tree is the one of RFC 6962 (Certificate Transparency): leaves are
+// SHA-256(0x00 || record), nodes SHA-256(0x01 || left || right), and a tree
+// of n leaves splits at the largest power of two below n. Records are not
+// salted, a leaf confirms any guess of the record it was made from.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// LeafHash is the hash of a record as a leaf of the tree
+func LeafHash(record []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(record)
+	return h.Sum(nil)
+}
+
+// NodeHash is the hash of an inner node
+func NodeHash(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root is the root of the tree over leaves, nil when there is none
+func Root(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return nil
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return NodeHash(Root(leaves[:k]), Root(leaves[k:]))
+}
+
+// Proof is the inclusion proof of leaf index in the tree over leaves, the
+// siblings from the leaf up to the root
+func Proof(leaves [][]byte, index int) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if index < k {
+		return append(Proof(leaves[:k], index), Root(leaves[k:]))
+	}
+	return append(Proof(leaves[k:], index-k), Root(leaves[:k]))
+}
+
+// split is the largest power of two smaller than n, n > 1
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// VerifyInclusion checks that leaf is leaf index of the tree of size leaves
+// with root, proof being what Proof returned
+func VerifyInclusion(leaf []byte, index uint64, size uint64, proof [][]byte, root []byte) error {
+	if index >= size {
+		return fmt.Errorf("merkle: leaf %d of a tree of %d", index, size)
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("merkle: proof longer than the tree is deep")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("merkle: proof shorter than the tree is deep")
+	}
+	if !bytes.Equal(r, root) {
+		return errors.New("merkle: proof does not lead to the root")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Accumulator - the tree as the ledger keeps it, only the roots of its perfect subtrees
+// ============================================================================================================================
+
+// Accumulator grows a tree one leaf at a time without keeping the leaves.
+// Peaks are the roots of its perfect subtrees, the largest first.
+type Accumulator struct {
+	Size  uint64   `json:"size"`
+	Peaks []string `json:"peaks"` //hex
+}
+
+// Add appends a leaf hash
+func (a *Accumulator) Add(leaf []byte) {
+	peaks := a.Peaks
+	node := leaf
+	//each trailing 1 bit of the size is a subtree as big as the one node now completes
+	for n := a.Size; n&1 == 1; n >>= 1 {
+		left, _ := hex.DecodeString(peaks[len(peaks)-1])
+		peaks = peaks[:len(peaks)-1]
+		node = NodeHash(left, node)
+	}
+	a.Peaks = append(peaks, hex.EncodeToString(node))
+	a.Size++
+}
+
+// Root is the root of the tree, the peaks folded from the smallest one
+func (a *Accumulator) Root() []byte {
+	var root []byte
+	for i := len(a.Peaks) - 1; i >= 0; i-- {
+		peak, _ := hex.DecodeString(a.Peaks[i])
+		if root == nil {
+			root = peak
+		} else {
+			root = NodeHash(peak, root)
+		}
+	}
+	return root
+}
+
+// ============================================================================================================================
+// Receipt - the evidence that an exchange was recorded
+// ============================================================================================================================
+
+// Receipt proves that Record, the exchange as the ledger stores it, is leaf
+// Index of the tree of Period when it had Size leaves and the given Root.
+// Hashes are hex encoded. Erased is set when the members of the record were
+// erased after it was recorded: the leaf is still the hash of the record as
+// it was, which only a receipt obtained before the erasure holds.
+type Receipt struct {
+	Record json.RawMessage `json:"record"`
+	Period string          `json:"period"`
+	Index  uint64          `json:"index"`
+	Size   uint64          `json:"size"`
+	Leaf   string          `json:"leaf"`
+	Proof  []string        `json:"proof"`
+	Root   string          `json:"root"`
+	Erased string          `json:"erased,omitempty"` //the erasure transaction
+}
+
+// Verify checks that the record hashes to the leaf and that the leaf is in the
+// tree, only the latter for an erased record. It does not tell whether Root
+// is the one the ledger has for the period, compare it with a root obtained
+// from a peer you trust.
+func (r *Receipt) Verify() error {
+	leaf, err := hex.DecodeString(r.Leaf)
+	if err != nil {
+		return fmt.Errorf("merkle: leaf: %v", err)
+	}
+	if r.Erased == "" {
+		if err := checkRecord(r.Record, leaf); err != nil {
+			return err
+		}
+	}
+	proof := make([][]byte, len(r.Proof))
+	for i, p := range r.Proof {
+		if proof[i], err = hex.DecodeString(p); err != nil {
+			return fmt.Errorf("merkle: proof %d: %v", i, err)
+		}
+	}
+	root, err := hex.DecodeString(r.Root)
+	if err != nil {
+		return fmt.Errorf("merkle: root: %v", err)
+	}
+	return VerifyInclusion(leaf, r.Index, r.Size, proof, root)
+}
+
+// checkRecord checks that a record, compacted as the ledger stores it, hashes to leaf
+func checkRecord(raw json.RawMessage, leaf []byte) error {
+	var record bytes.Buffer
+	if err := json.Compact(&record, raw); err != nil {
+		return fmt.Errorf("merkle: record: %v", err)
+	}
+	if !bytes.Equal(LeafHash(record.Bytes()), leaf) {
+		return errors.New("merkle: the record does not hash to the leaf")
+	}
+	return nil
+}
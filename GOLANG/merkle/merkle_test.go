@@ -0,0 +1,79 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+)
+
+func leaves(n int) [][]byte {
+	var l [][]byte
+	for i := 0; i < n; i++ {
+		l = append(l, LeafHash([]byte(`{"txID":"t`+strconv.Itoa(i)+`"}`)))
+	}
+	return l
+}
+
+func TestProofs(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		l := leaves(n)
+		root := Root(l)
+		acc := Accumulator{}
+		for _, leaf := range l {
+			acc.Add(leaf)
+		}
+		if hex.EncodeToString(acc.Root()) != hex.EncodeToString(root) || acc.Size != uint64(n) {
+			t.Fatalf("%d leaves: accumulator root %x, tree root %x", n, acc.Root(), root)
+		}
+		for i := 0; i < n; i++ {
+			proof := Proof(l, i)
+			if err := VerifyInclusion(l[i], uint64(i), uint64(n), proof, root); err != nil {
+				t.Fatalf("leaf %d of %d: %v", i, n, err)
+			}
+			if n > 1 && VerifyInclusion(l[(i+1)%n], uint64(i), uint64(n), proof, root) == nil {
+				t.Fatalf("leaf %d of %d: another leaf verifies", i, n)
+			}
+			if n > 1 && VerifyInclusion(l[i], uint64(i), uint64(n), proof[1:], root) == nil {
+				t.Fatalf("leaf %d of %d: verifies with a short proof", i, n)
+			}
+		}
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	records := []string{`{"txID":"t0","POINT_A":"10"}`, `{"txID":"t1","POINT_A":"20"}`, `{"txID":"t2","POINT_A":"30"}`}
+	var l [][]byte
+	for _, r := range records {
+		l = append(l, LeafHash([]byte(r)))
+	}
+	r := Receipt{Record: []byte("{\n  \"txID\": \"t1\",\n  \"POINT_A\": \"20\"\n}"), Period: "2016-12-04", Index: 1, Size: 3,
+		Leaf: hex.EncodeToString(l[1]), Root: hex.EncodeToString(Root(l))}
+	for _, p := range Proof(l, 1) {
+		r.Proof = append(r.Proof, hex.EncodeToString(p))
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatalf("indented record: %v", err)
+	}
+
+	tampered := r
+	tampered.Record = []byte(`{"txID":"t1","POINT_A":"200"}`)
+	if tampered.Verify() == nil {
+		t.Error("altered record verifies")
+	}
+	tampered = r
+	tampered.Root = hex.EncodeToString(l[0])
+	if tampered.Verify() == nil {
+		t.Error("wrong root verifies")
+	}
+
+	erased := r
+	erased.Record = []byte(`{"txID":"t1","POINT_A":"20","erased":"e1"}`)
+	erased.Erased = "e1"
+	if err := erased.Verify(); err != nil {
+		t.Errorf("erased record: %v", err)
+	}
+	erased.Root = hex.EncodeToString(l[0])
+	if erased.Verify() == nil {
+		t.Error("erased record verifies with a wrong root")
+	}
+}
@@ -0,0 +1,348 @@
+// Package peer is a client of the REST interface of a Fabric 0.6 peer, the
+// port 7050 API the ibc SDK used: chaincode deploy, invoke and query over
+// JSON-RPC, chain height, blocks, transactions and the registrar. It also
+// talks to the simulator of package simulator, the only server of this API the
+// current chaincode runs on. Fabric 2.x peers do not serve it.
+package peer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client calls one peer as one enrollment id. Its zero value is not usable,
+// set URL at least.
+type Client struct {
+	URL          string //e.g. http://172.17.0.2:7050
+	EnrollID     string //secureContext of the chaincode calls
+	EnrollSecret string //when set, the client logs EnrollID in before its first chaincode call
+	HTTP         *http.Client
+
+	// Retries is how many more times a failed call is tried, Backoff the wait
+	// before the first retry, doubled for each next one (500ms when zero).
+	// Reads are retried on any failure of the connection and on 5xx answers.
+	// Deploys and invocations only when the peer could not be reached or
+	// answered 503, so that a transaction is never submitted twice.
+	Retries int
+	Backoff time.Duration
+
+	id       int64
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+// Error is a JSON-RPC error answer of the /chaincode endpoint
+type Error struct {
+	Method  string //deploy, invoke or query
+	Code    int
+	Message string
+	Data    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (%d) %s", e.Method, e.Message, e.Code, e.Data)
+}
+
+// StatusError is an error answer of the other REST endpoints
+type StatusError struct {
+	Path    string
+	Status  int
+	Message string
+
+	body []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.Path, e.Status, e.Message)
+}
+
+// Timestamp is a protobuf timestamp
+type Timestamp struct {
+	Seconds int64 `json:"seconds"`
+	Nanos   int32 `json:"nanos"`
+}
+
+// Time is the timestamp as a time.Time
+func (ts Timestamp) Time() time.Time {
+	return time.Unix(ts.Seconds, int64(ts.Nanos))
+}
+
+// ChainInfo is what GET /chain answers
+type ChainInfo struct {
+	Height            uint64 `json:"height"`
+	CurrentBlockHash  []byte `json:"currentBlockHash"`
+	PreviousBlockHash []byte `json:"previousBlockHash"`
+}
+
+// Transaction is a transaction of a block. ChaincodeID is kept raw, the 0.6
+// peer writes it as the bytes of its protobuf and the simulator as a name.
+type Transaction struct {
+	Type        int             `json:"type"`
+	ChaincodeID json.RawMessage `json:"chaincodeID"`
+	Payload     []byte          `json:"payload,omitempty"`
+	Txid        string          `json:"txid"`
+	Timestamp   Timestamp       `json:"timestamp"`
+}
+
+// Event is a chaincode event of a block
+type Event struct {
+	ChaincodeID string `json:"chaincodeID"`
+	TxID        string `json:"txID"`
+	EventName   string `json:"eventName"`
+	Payload     []byte `json:"payload"`
+}
+
+// Block is what GET /chain/blocks/{n} answers
+type Block struct {
+	Transactions      []Transaction `json:"transactions"`
+	StateHash         []byte        `json:"stateHash"`
+	PreviousBlockHash []byte        `json:"previousBlockHash"`
+	NonHashData       struct {
+		LocalLedgerCommitTimestamp Timestamp `json:"localLedgerCommitTimestamp"`
+		ChaincodeEvents            []Event   `json:"chaincodeEvents"`
+	} `json:"nonHashData"`
+}
+
+// ============================================================================================================================
+// Chaincode - POST /chaincode
+// ============================================================================================================================
+
+type rpcRequest struct {
+	JSONRPC string    `json:"jsonrpc"`
+	Method  string    `json:"method"`
+	Params  rpcParams `json:"params"`
+	ID      int64     `json:"id"`
+}
+
+type rpcParams struct {
+	Type          int                    `json:"type"`
+	ChaincodeID   map[string]string      `json:"chaincodeID"`
+	CtorMsg       map[string]interface{} `json:"ctorMsg"`
+	SecureContext string                 `json:"secureContext,omitempty"`
+}
+
+type rpcResponse struct {
+	Result *struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+// Deploy deploys the chaincode at path (a go import path or a zip url), runs
+// its Init with function and args and returns the name the peer gave it. The
+// peer answers before the deployment is committed, see Ready.
+func (c *Client) Deploy(path string, function string, args []string) (string, error) {
+	return c.chaincode("deploy", map[string]string{"path": path}, function, args)
+}
+
+// Invoke submits a transaction to the chaincode name and returns its id
+func (c *Client) Invoke(name string, function string, args []string) (string, error) {
+	return c.chaincode("invoke", map[string]string{"name": name}, function, args)
+}
+
+// Query runs a query on the chaincode name and returns what it answered
+func (c *Client) Query(name string, function string, args []string) (string, error) {
+	return c.chaincode("query", map[string]string{"name": name}, function, args)
+}
+
+func (c *Client) chaincode(method string, chaincodeID map[string]string, function string, args []string) (string, error) {
+	if err := c.ensureLogin(); err != nil {
+		return "", err
+	}
+	req := rpcRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		ID:      atomic.AddInt64(&c.id, 1),
+		Params: rpcParams{
+			Type:          1, //golang
+			ChaincodeID:   chaincodeID,
+			CtorMsg:       map[string]interface{}{"args": append([]string{function}, args...)},
+			SecureContext: c.EnrollID,
+		},
+	}
+	body, _ := json.Marshal(req)
+	var resp rpcResponse
+	if err := c.do("POST", "/chaincode", body, method == "query", &resp); err != nil {
+		//JSON-RPC errors may come with a 4xx status, their body tells more
+		var se *StatusError
+		if !errors.As(err, &se) || json.Unmarshal(se.body, &resp) != nil || resp.Error == nil {
+			return "", err
+		}
+	}
+	if resp.Error != nil {
+		return "", &Error{Method: method, Code: resp.Error.Code, Message: resp.Error.Message, Data: resp.Error.Data}
+	}
+	if resp.Result == nil {
+		return "", errors.New(method + ": empty answer from peer")
+	}
+	return resp.Result.Message, nil
+}
+
+// ============================================================================================================================
+// Chain - GET /chain, /chain/blocks/{n}, /transactions/{txid}
+// ============================================================================================================================
+
+// Chain returns the height and the hash of the last block
+func (c *Client) Chain() (*ChainInfo, error) {
+	var info ChainInfo
+	if err := c.do("GET", "/chain", nil, true, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Block returns block n, the genesis block is 0
+func (c *Client) Block(n uint64) (*Block, error) {
+	var b Block
+	if err := c.do("GET", "/chain/blocks/"+strconv.FormatUint(n, 10), nil, true, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Transaction returns a committed transaction
+func (c *Client) Transaction(txID string) (*Transaction, error) {
+	var tx Transaction
+	if err := c.do("GET", "/transactions/"+txID, nil, true, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Ready waits until the transaction txID is committed, polling every
+// interval for at most timeout. A deployment's transaction id is the name of
+// the chaincode.
+func (c *Client) Ready(txID string, interval time.Duration, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := c.Transaction(txID)
+		var se *StatusError
+		if err == nil || !errors.As(err, &se) || se.Status != http.StatusNotFound {
+			return err
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("transaction %s not committed after %s", txID, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// ============================================================================================================================
+// Registrar - POST /registrar, GET /registrar/{enrollmentID}
+// ============================================================================================================================
+
+// Login logs EnrollID in with EnrollSecret
+func (c *Client) Login() error {
+	body, _ := json.Marshal(map[string]string{"enrollId": c.EnrollID, "enrollSecret": c.EnrollSecret})
+	if err := c.do("POST", "/registrar", body, false, nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.loggedIn = true
+	c.mu.Unlock()
+	return nil
+}
+
+// LoggedIn tells whether the peer has EnrollID logged in
+func (c *Client) LoggedIn() (bool, error) {
+	err := c.do("GET", "/registrar/"+c.EnrollID, nil, true, nil)
+	var se *StatusError
+	if errors.As(err, &se) && se.Status == http.StatusUnauthorized {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Client) ensureLogin() error {
+	if c.EnrollSecret == "" {
+		return nil
+	}
+	c.mu.Lock()
+	done := c.loggedIn
+	c.mu.Unlock()
+	if done {
+		return nil
+	}
+	return c.Login()
+}
+
+// ============================================================================================================================
+// HTTP
+// ============================================================================================================================
+
+// do sends a request, retrying as Retries says, and decodes the JSON answer
+// into v. Non-2xx answers are a *StatusError.
+func (c *Client) do(method string, path string, body []byte, idempotent bool, v interface{}) error {
+	backoff := c.Backoff
+	if backoff == 0 {
+		backoff = 500 * time.Millisecond
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = c.once(method, path, body, idempotent, v)
+		if !retry || attempt >= c.Retries {
+			return err
+		}
+		time.Sleep(backoff << uint(attempt))
+	}
+}
+
+// once makes one attempt and tells whether it may be tried again
+func (c *Client) once(method string, path string, body []byte, idempotent bool, v interface{}) (bool, error) {
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	req, err := http.NewRequest(method, c.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		unreached := errors.As(err, &opErr) && opErr.Op == "dial"
+		return idempotent || unreached, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return idempotent, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		var answer struct {
+			Error string `json:"Error"`
+		}
+		msg := string(bytes.TrimSpace(raw))
+		if json.Unmarshal(raw, &answer) == nil && answer.Error != "" {
+			msg = answer.Error
+		}
+		retry := resp.StatusCode == http.StatusServiceUnavailable || (idempotent && resp.StatusCode/100 == 5)
+		return retry, &StatusError{Path: path, Status: resp.StatusCode, Message: msg, body: raw}
+	}
+	if v == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("%s: bad answer from peer: %v", path, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,188 @@
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standIn is a peer that answers from a table keyed by "METHOD path" or,
+// for /chaincode, by "method function". Each answer is a status and a body.
+type standIn struct {
+	mu      sync.Mutex
+	answers map[string][]answer //served in turn, the last one again and again
+	calls   []string
+	bodies  []map[string]interface{}
+}
+
+type answer struct {
+	status int
+	body   string
+}
+
+func newStandIn(answers map[string][]answer) (*standIn, *httptest.Server) {
+	s := &standIn{answers: answers}
+	return s, httptest.NewServer(s)
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := r.Method + " " + r.URL.Path
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if r.URL.Path == "/chaincode" {
+		params, _ := body["params"].(map[string]interface{})
+		ctor, _ := params["ctorMsg"].(map[string]interface{})
+		args, _ := ctor["args"].([]interface{})
+		key = body["method"].(string) + " " + args[0].(string)
+	}
+	s.calls = append(s.calls, key)
+	s.bodies = append(s.bodies, body)
+	queue := s.answers[key]
+	if len(queue) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"Error":"no answer for `+key+`"}`)
+		return
+	}
+	a := queue[0]
+	if len(queue) > 1 {
+		s.answers[key] = queue[1:]
+	}
+	w.WriteHeader(a.status)
+	io.WriteString(w, a.body)
+}
+
+func (s *standIn) count(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.calls {
+		if c == key {
+			n++
+		}
+	}
+	return n
+}
+
+func ok(msg string) answer {
+	return answer{200, `{"jsonrpc":"2.0","result":{"status":"OK","message":` + strconvQuote(msg) + `},"id":1}`}
+}
+
+func strconvQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestChaincode(t *testing.T) {
+	s, srv := newStandIn(map[string][]answer{
+		"POST /registrar": {{200, `{"OK":"Login successful for user 'test_user0'."}`}},
+		"deploy init":     {ok("ab12")},
+		"invoke write":    {ok("5c4d-uuid")},
+		"query read":      {ok(`{"respond":300}`)},
+		"query nothing":   {{200, `{"jsonrpc":"2.0","error":{"code":-32003,"message":"Query failure","data":"Error when querying chaincode"},"id":4}`}},
+	})
+	defer srv.Close()
+	c := &Client{URL: srv.URL, EnrollID: "test_user0", EnrollSecret: "MS9qrN8hFjlE"}
+
+	if name, err := c.Deploy("github.com/x/ccpx", "init", []string{"99"}); err != nil || name != "ab12" {
+		t.Errorf("Deploy: %s %v", name, err)
+	}
+	if txID, err := c.Invoke("ab12", "write", []string{"abc", "1"}); err != nil || txID != "5c4d-uuid" {
+		t.Errorf("Invoke: %s %v", txID, err)
+	}
+	if msg, err := c.Query("ab12", "read", []string{"abc"}); err != nil || msg != `{"respond":300}` {
+		t.Errorf("Query: %s %v", msg, err)
+	}
+	_, err := c.Query("ab12", "nothing", nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32003 || rpcErr.Data != "Error when querying chaincode" {
+		t.Errorf("query error: %v", err)
+	}
+
+	if n := s.count("POST /registrar"); n != 1 {
+		t.Errorf("logged in %d times, want once", n)
+	}
+	deploy := s.bodies[1]
+	params := deploy["params"].(map[string]interface{})
+	if deploy["jsonrpc"] != "2.0" || params["secureContext"] != "test_user0" ||
+		params["chaincodeID"].(map[string]interface{})["path"] != "github.com/x/ccpx" {
+		t.Errorf("deploy request: %v", deploy)
+	}
+}
+
+func TestChain(t *testing.T) {
+	_, srv := newStandIn(map[string][]answer{
+		"GET /chain":          {{200, `{"height":2,"currentBlockHash":"AQI=","previousBlockHash":"AwQ="}`}},
+		"GET /chain/blocks/1": {{200, `{"transactions":[{"type":2,"chaincodeID":"CgRhYjEy","payload":"AQ==","txid":"5c4d-uuid","timestamp":{"seconds":1480838400,"nanos":5}}],"stateHash":"BQY=","previousBlockHash":"AwQ=","nonHashData":{"localLedgerCommitTimestamp":{"seconds":1480838401},"chaincodeEvents":[{"chaincodeID":"ab12","txID":"5c4d-uuid","eventName":"recorded"}]}}`}},
+		"GET /chain/blocks/9": {{400, `{"Error":"Error retrieving block from blockchain: Error retrieving block: 9"}`}},
+		"GET /transactions/7": {{404, `{"Error":"Transaction 7 is not found."}`}},
+	})
+	defer srv.Close()
+	c := &Client{URL: srv.URL}
+
+	info, err := c.Chain()
+	if err != nil || info.Height != 2 || string(info.CurrentBlockHash) != "\x01\x02" {
+		t.Errorf("Chain: %+v %v", info, err)
+	}
+	b, err := c.Block(1)
+	if err != nil || len(b.Transactions) != 1 || b.Transactions[0].Txid != "5c4d-uuid" ||
+		!b.Transactions[0].Timestamp.Time().Equal(time.Unix(1480838400, 5)) || b.NonHashData.ChaincodeEvents[0].EventName != "recorded" {
+		t.Errorf("Block: %+v %v", b, err)
+	}
+	_, err = c.Block(9)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Status != 400 || !strings.HasPrefix(se.Message, "Error retrieving block") {
+		t.Errorf("missing block: %v", err)
+	}
+	if err := c.Ready("7", time.Millisecond, 5*time.Millisecond); err == nil || !strings.Contains(err.Error(), "not committed") {
+		t.Errorf("Ready: %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	down := answer{503, `{"Error":"peer is busy"}`}
+	s, srv := newStandIn(map[string][]answer{
+		"GET /chain":      {{500, `{"Error":"ledger failure"}`}, down, {200, `{"height":5}`}},
+		"invoke write":    {down, ok("5c4d-uuid")},
+		"invoke set_user": {{500, `{"Error":"timeout"}`}, ok("never")},
+	})
+	defer srv.Close()
+	c := &Client{URL: srv.URL, Retries: 2, Backoff: time.Millisecond}
+
+	if info, err := c.Chain(); err != nil || info.Height != 5 || s.count("GET /chain") != 3 {
+		t.Errorf("Chain after two failures: %+v %v", info, err)
+	}
+	if txID, err := c.Invoke("ab12", "write", nil); err != nil || txID != "5c4d-uuid" {
+		t.Errorf("Invoke after a 503: %s %v", txID, err)
+	}
+	if _, err := c.Invoke("ab12", "set_user", nil); err == nil || s.count("invoke set_user") != 1 {
+		t.Errorf("an invocation the peer may have run was retried: %v", err)
+	}
+
+	srv.Close()
+	c.Retries = 1
+	if _, err := c.Invoke("ab12", "write", nil); err == nil {
+		t.Error("closed peer answered")
+	}
+}
+
+func TestLoggedIn(t *testing.T) {
+	_, srv := newStandIn(map[string][]answer{
+		"GET /registrar/test_user0": {{200, `{"OK":"User test_user0 is already logged in."}`}},
+		"GET /registrar/bob":        {{401, `{"Error":"User bob must log in."}`}},
+	})
+	defer srv.Close()
+	for id, want := range map[string]bool{"test_user0": true, "bob": false} {
+		c := &Client{URL: srv.URL, EnrollID: id}
+		if got, err := c.LoggedIn(); err != nil || got != want {
+			t.Errorf("LoggedIn %s: %v %v", id, got, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Package pseudonym turns member ids into the pseudonyms the ledger stores in
+// their place. A pseudonym is a keyed hash, HMAC-SHA256 under a secret of the
+// member's seller, so the same member of two sellers gets two unrelated
+// pseudonyms and nobody without the seller's secret can tell who it is. The
+// seller resolves its own members by hashing its member list, see Directory.
+//
+// The chaincode refuses members in clear for a seller whose policy is
+// pseudonymous, and for any seller that registered a key: such a seller signs
+// its records on its own side, so it hashes its members there too. That holds
+// for exchanges, rings, credits and transfers alike.
+package pseudonym
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Prefix starts every pseudonym, the hex of the hash follows
+const Prefix = "psn:"
+
+// Is tells whether v has the form of a pseudonym
+func Is(v string) bool {
+	if len(v) != len(Prefix)+2*sha256.Size || !strings.HasPrefix(v, Prefix) {
+		return false
+	}
+	for _, c := range v[len(Prefix):] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Of is the pseudonym of member user of the seller whose secret is key
+func Of(key []byte, seller string, user string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalSeller(seller) + "\n" + user))
+	return Prefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalSeller - seller ids are matched as numbers on the ledger, 01 is seller 1
+func normalSeller(seller string) string {
+	if n, err := strconv.Atoi(seller); err == nil {
+		return strconv.Itoa(n)
+	}
+	return seller
+}
+
+// NewKey returns a fresh seller secret, base64 encoded like Keys files hold them
+func NewKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Keys are the secrets of the sellers, by seller id
+type Keys map[string][]byte
+
+// ReadKeys reads a JSON object of base64 secrets keyed by seller id, e.g. {"1":"..."}
+func ReadKeys(path string) (Keys, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var encoded map[string]string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	keys := make(Keys)
+	for seller, v := range encoded {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(key) < 16 {
+			return nil, fmt.Errorf("%s: the key of seller %s must be at least 16 bytes, base64", path, seller)
+		}
+		keys[normalSeller(seller)] = key
+	}
+	return keys, nil
+}
+
+// Has tells whether there is a secret for seller
+func (k Keys) Has(seller string) bool {
+	_, ok := k[normalSeller(seller)]
+	return ok
+}
+
+// Pseudonym is the pseudonym of member user of seller. A user that already is
+// a pseudonym is returned as it is.
+func (k Keys) Pseudonym(seller string, user string) (string, error) {
+	if Is(user) {
+		return user, nil
+	}
+	key, ok := k[normalSeller(seller)]
+	if !ok {
+		return "", errors.New("pseudonym: no key for seller " + seller)
+	}
+	return Of(key, seller, user), nil
+}
+
+// Directory resolves the pseudonyms of the members of one seller
+type Directory struct {
+	key    []byte
+	seller string
+	users  map[string]string //pseudonym -> member id
+}
+
+// NewDirectory returns the directory of seller, whose secret is key, knowing members
+func NewDirectory(key []byte, seller string, members ...string) *Directory {
+	d := &Directory{key: key, seller: seller, users: make(map[string]string)}
+	d.Add(members...)
+	return d
+}
+
+// Add makes members resolvable
+func (d *Directory) Add(members ...string) {
+	for _, m := range members {
+		d.users[Of(d.key, d.seller, m)] = m
+	}
+}
+
+// Resolve returns the member behind a pseudonym, v itself when it is not one of
+// the seller's members
+func (d *Directory) Resolve(v string) (string, bool) {
+	user, ok := d.users[v]
+	if !ok {
+		return v, false
+	}
+	return user, true
+}
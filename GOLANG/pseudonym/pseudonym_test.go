@@ -0,0 +1,48 @@
+package pseudonym
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPseudonyms(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+	os.WriteFile(path, []byte(`{"1":"MDEyMzQ1Njc4OWFiY2RlZg==","02":"ZmVkY2JhOTg3NjU0MzIxMA=="}`), 0600)
+	keys, err := ReadKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob1, _ := keys.Pseudonym("1", "bob")
+	bob2, _ := keys.Pseudonym("2", "bob")
+	again, _ := keys.Pseudonym("01", "bob")
+	if !Is(bob1) || !Is(bob2) || bob1 == bob2 || again != bob1 {
+		t.Errorf("bob is %s at seller 1, %s at seller 2 and %s at seller 01", bob1, bob2, again)
+	}
+	if p, _ := keys.Pseudonym("1", bob1); p != bob1 {
+		t.Errorf("a pseudonym was hashed again: %s", p)
+	}
+	if _, err := keys.Pseudonym("3", "bob"); err == nil || keys.Has("3") {
+		t.Error("seller 3 has no key")
+	}
+	for _, v := range []string{"bob", "psn:", Prefix + "XYZ", bob1[:len(bob1)-1]} {
+		if Is(v) {
+			t.Errorf("%q is a pseudonym", v)
+		}
+	}
+
+	d := NewDirectory(keys["1"], "1", "alice", "bob")
+	if user, ok := d.Resolve(bob1); !ok || user != "bob" {
+		t.Errorf("Resolve %s: %s %v", bob1, user, ok)
+	}
+	if _, ok := d.Resolve(bob2); ok {
+		t.Error("seller 1 resolved a member of seller 2")
+	}
+
+	os.WriteFile(path, []byte(`{"1":"c2hvcnQ="}`), 0600)
+	if _, err := ReadKeys(path); err == nil {
+		t.Error("a 5 byte key was accepted")
+	}
+}
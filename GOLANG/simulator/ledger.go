@@ -0,0 +1,478 @@
+// Package simulator runs a chaincode without a Fabric network. A Ledger hosts
+// the chaincode in process on a key-value state it keeps on disk, cuts one
+// block per committed transaction, stamps and numbers transactions, collects
+// chaincode events and serves the REST interface of a peer (/chaincode,
+// /chain, /chain/blocks/{n}, /transactions/{txid}, /registrar), so the gateway,
+// ccpxctl and the client SDK can be developed offline.
+//
+// Like a peer, the simulator discards the writes of queries and of failed
+// invocations. Unlike a peer it answers an invocation once it is committed,
+// so callers learn whether it failed.
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// blocksFile is the file of dir the blocks are appended to, one JSON block per line
+const blocksFile = "blocks.jsonl"
+
+// transaction types, the values of the 0.6 peer
+const (
+	TypeDeploy = 1
+	TypeInvoke = 2
+)
+
+// Timestamp is a protobuf timestamp the way the peer REST API writes it
+type Timestamp struct {
+	Seconds int64 `json:"seconds"`
+	Nanos   int32 `json:"nanos"`
+}
+
+func stamp(tm time.Time) Timestamp {
+	return Timestamp{Seconds: tm.Unix(), Nanos: int32(tm.Nanosecond())}
+}
+
+// Time is the timestamp as a time.Time
+func (ts Timestamp) Time() time.Time {
+	return time.Unix(ts.Seconds, int64(ts.Nanos))
+}
+
+// Write is one key a transaction wrote, or deleted
+type Write struct {
+	Key    string `json:"key"`
+	Value  []byte `json:"value,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// Event is an event a chaincode set in a committed transaction
+type Event struct {
+	ChaincodeID string `json:"chaincodeID"`
+	TxID        string `json:"txID"`
+	EventName   string `json:"eventName"`
+	Payload     []byte `json:"payload,omitempty"`
+	Block       uint64 `json:"-"`
+}
+
+// Transaction is a committed deployment or invocation
+type Transaction struct {
+	Type        int       `json:"type"`
+	ChaincodeID string    `json:"chaincodeID"`
+	Args        []string  `json:"args"`
+	Txid        string    `json:"txid"`
+	Timestamp   Timestamp `json:"timestamp"`
+	EnrollID    string    `json:"enrollID,omitempty"`
+	Writes      []Write   `json:"writes,omitempty"`
+}
+
+// NonHashData is what a block carries outside of its hash
+type NonHashData struct {
+	LocalLedgerCommitTimestamp Timestamp `json:"localLedgerCommitTimestamp"`
+	ChaincodeEvents            []Event   `json:"chaincodeEvents,omitempty"`
+}
+
+// Block is a block of the chain. Block 0 is the genesis block and holds no
+// transaction, every other block holds exactly one.
+type Block struct {
+	Transactions      []*Transaction `json:"transactions,omitempty"`
+	StateHash         []byte         `json:"stateHash"`
+	PreviousBlockHash []byte         `json:"previousBlockHash,omitempty"`
+	NonHashData       NonHashData    `json:"nonHashData"`
+}
+
+// hash is the hash the next block chains to, it leaves out NonHashData
+func (b *Block) hash() []byte {
+	hashed := *b
+	hashed.NonHashData = NonHashData{}
+	body, _ := json.Marshal(hashed)
+	sum := sha256.Sum256(body)
+	return sum[:]
+}
+
+// Ledger hosts one chaincode over a persistent state. All its methods are safe
+// for concurrent use, transactions run one at a time.
+type Ledger struct {
+	// Clock stamps the transactions, time.Now by default
+	Clock func() time.Time
+
+	mu       sync.Mutex
+	cc       shim.Chaincode
+	state    map[string][]byte
+	blocks   []*Block
+	names    map[string]bool              //deployed chaincode names
+	current  string                       //the name deployed last
+	attrs    map[string]map[string]string //cert attributes per enrollment id
+	creators map[string][]byte            //serialized identities per enrollment id
+	secrets  map[string]string            //enrollment secrets of the ids that may log in over REST
+	subs     map[chan Event]bool
+	file     *os.File
+}
+
+// Open hosts cc on the ledger kept in dir, creating it when it does not exist
+// yet. An empty dir keeps the ledger in memory.
+func Open(dir string, cc shim.Chaincode) (*Ledger, error) {
+	l := &Ledger{
+		Clock:    time.Now,
+		cc:       cc,
+		state:    make(map[string][]byte),
+		names:    make(map[string]bool),
+		attrs:    make(map[string]map[string]string),
+		creators: make(map[string][]byte),
+		secrets:  make(map[string]string),
+		subs:     make(map[chan Event]bool),
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, blocksFile)
+		if err := l.replay(path); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		l.file = f
+	}
+	if len(l.blocks) == 0 {
+		genesis := &Block{StateHash: make([]byte, sha256.Size)}
+		genesis.NonHashData.LocalLedgerCommitTimestamp = stamp(l.Clock())
+		if err := l.append(genesis); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// replay rebuilds the state from the blocks of an existing ledger
+func (l *Ledger) replay(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var b Block
+		if err := json.Unmarshal(sc.Bytes(), &b); err != nil {
+			return fmt.Errorf("%s: block %d: %v", path, len(l.blocks), err)
+		}
+		if n := len(l.blocks); n > 0 && !bytes.Equal(b.PreviousBlockHash, l.blocks[n-1].hash()) {
+			return fmt.Errorf("%s: block %d does not chain to block %d", path, n, n-1)
+		}
+		for _, tx := range b.Transactions {
+			l.apply(tx)
+		}
+		l.blocks = append(l.blocks, &b)
+	}
+	return sc.Err()
+}
+
+func (l *Ledger) apply(tx *Transaction) {
+	if tx.Type == TypeDeploy {
+		l.names[tx.ChaincodeID] = true
+		l.current = tx.ChaincodeID
+	}
+	for _, w := range tx.Writes {
+		if w.Delete {
+			delete(l.state, w.Key)
+		} else {
+			l.state[w.Key] = w.Value
+		}
+	}
+}
+
+// append adds a block to the chain and to the file
+func (l *Ledger) append(b *Block) error {
+	if l.file != nil {
+		line, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	}
+	l.blocks = append(l.blocks, b)
+	return nil
+}
+
+// Close closes the ledger file and the event subscriptions
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs {
+		delete(l.subs, ch)
+		close(ch)
+	}
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// SetAttributes sets the certificate attributes the calls of enrollID carry,
+// e.g. {"role": "admin"}. Enrollment ids without attributes may call the
+// functions that require no role.
+func (l *Ledger) SetAttributes(enrollID string, attrs map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attrs[enrollID] = attrs
+	delete(l.creators, enrollID)
+}
+
+// SetSecret registers enrollID with its enrollment secret. Only registered
+// ids log in at the registrar of Handler, and only logged in ids call the
+// chaincode through it.
+func (l *Ledger) SetSecret(enrollID string, secret string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.secrets[enrollID] = secret
+}
+
+// checkSecret tells whether secret is the one registered for enrollID
+func (l *Ledger) checkSecret(enrollID string, secret string) bool {
+	l.mu.Lock()
+	want, ok := l.secrets[enrollID]
+	l.mu.Unlock()
+	return ok && want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(secret)) == 1
+}
+
+// ============================================================================================================================
+// Transactions
+// ============================================================================================================================
+
+// ChaincodeName is the name a deployment of path with args gets, a hex
+// SHA-512 like the names the 0.6 peer handed out
+func ChaincodeName(path string, args []string) string {
+	h := sha512.New()
+	h.Write([]byte(path))
+	for _, a := range args {
+		h.Write([]byte{0})
+		h.Write([]byte(a))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Deploy runs the chaincode's Init with args (the function name first) and
+// returns the name calls must use. A deployment whose Init fails is not
+// committed and has no name.
+func (l *Ledger) Deploy(enrollID string, path string, args []string) (string, pb.Response, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	name := ChaincodeName(path, args)
+	stub, res, err := l.execute(TypeDeploy, name, enrollID, args)
+	if err != nil || res.Status >= shim.ERRORTHRESHOLD {
+		return "", res, err
+	}
+	return name, res, l.commit(stub)
+}
+
+// Invoke runs function as a transaction and commits it in a new block when
+// the chaincode succeeds.
+func (l *Ledger) Invoke(enrollID string, function string, args []string) (string, pb.Response, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stub, res, err := l.execute(TypeInvoke, "", enrollID, append([]string{function}, args...))
+	if err != nil {
+		return "", res, err
+	}
+	if res.Status >= shim.ERRORTHRESHOLD {
+		return stub.txID, res, nil
+	}
+	return stub.txID, res, l.commit(stub)
+}
+
+// Query runs function and discards whatever it wrote
+func (l *Ledger) Query(enrollID string, function string, args []string) (pb.Response, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, res, err := l.execute(TypeInvoke, "", enrollID, append([]string{function}, args...))
+	return res, err
+}
+
+// Deployed tells whether name was deployed on this ledger
+func (l *Ledger) Deployed(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.names[name]
+}
+
+// execute runs the chaincode on a fresh transaction stub, a panic of the
+// chaincode fails the transaction
+func (l *Ledger) execute(txType int, name string, enrollID string, args []string) (stub *txStub, res pb.Response, err error) {
+	txID := name //a deployment's transaction id is the chaincode name, like on the 0.6 peer
+	if txType != TypeDeploy {
+		if txID, err = newTxID(); err != nil {
+			return nil, res, err
+		}
+		name = l.current
+	}
+	creator, err := l.creator(enrollID)
+	if err != nil {
+		return nil, res, err
+	}
+	stub = newTxStub(l, txID, args, creator, l.Clock())
+	stub.tx.Type = txType
+	stub.tx.ChaincodeID = name
+	stub.tx.EnrollID = enrollID
+	defer func() {
+		if r := recover(); r != nil {
+			res = shim.Error(fmt.Sprintf("chaincode panicked: %v", r))
+		}
+	}()
+	if txType == TypeDeploy {
+		return stub, l.cc.Init(stub), nil
+	}
+	return stub, l.cc.Invoke(stub), nil
+}
+
+// commit cuts the block of a successful transaction, applies its writes and
+// publishes its events
+func (l *Ledger) commit(stub *txStub) error {
+	tx := stub.tx
+	tx.Writes = stub.writeSet()
+	prev := l.blocks[len(l.blocks)-1]
+	writes, _ := json.Marshal(tx.Writes)
+	stateHash := sha256.Sum256(append(append([]byte{}, prev.StateHash...), writes...))
+	b := &Block{
+		Transactions:      []*Transaction{tx},
+		StateHash:         stateHash[:],
+		PreviousBlockHash: prev.hash(),
+	}
+	b.NonHashData.LocalLedgerCommitTimestamp = tx.Timestamp
+	for _, ev := range stub.events {
+		ev.ChaincodeID = tx.ChaincodeID
+		ev.TxID = tx.Txid
+		b.NonHashData.ChaincodeEvents = append(b.NonHashData.ChaincodeEvents, ev)
+	}
+	if err := l.append(b); err != nil {
+		return err
+	}
+	l.apply(tx)
+	for _, ev := range b.NonHashData.ChaincodeEvents {
+		ev.Block = uint64(len(l.blocks) - 1)
+		for ch := range l.subs {
+			select {
+			case ch <- ev:
+			default: //a subscriber that does not keep up misses events
+			}
+		}
+	}
+	return nil
+}
+
+// newTxID returns a random UUID, the peer's transaction ids
+func newTxID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	h := hex.EncodeToString(u[:])
+	return strings.Join([]string{h[:8], h[8:12], h[12:16], h[16:20], h[20:]}, "-"), nil
+}
+
+// ============================================================================================================================
+// Chain
+// ============================================================================================================================
+
+// Height is the number of blocks, the genesis block included
+func (l *Ledger) Height() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return uint64(len(l.blocks))
+}
+
+// Block returns block n
+func (l *Ledger) Block(n uint64) (*Block, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n >= uint64(len(l.blocks)) {
+		return nil, false
+	}
+	return l.blocks[n], true
+}
+
+// Transaction returns a committed transaction and the number of its block
+func (l *Ledger) Transaction(txID string) (*Transaction, uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for n := len(l.blocks) - 1; n > 0; n-- {
+		for _, tx := range l.blocks[n].Transactions {
+			if tx.Txid == txID {
+				return tx, uint64(n), true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// chainInfo is what GET /chain answers
+type chainInfo struct {
+	Height            uint64 `json:"height"`
+	CurrentBlockHash  []byte `json:"currentBlockHash"`
+	PreviousBlockHash []byte `json:"previousBlockHash,omitempty"`
+}
+
+func (l *Ledger) info() chainInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last := l.blocks[len(l.blocks)-1]
+	return chainInfo{Height: uint64(len(l.blocks)), CurrentBlockHash: last.hash(), PreviousBlockHash: last.PreviousBlockHash}
+}
+
+// Subscribe returns a channel the events of the transactions committed from
+// now on are sent to, and the function that ends the subscription. Events
+// are dropped while the channel's buffer of size buffer is full.
+func (l *Ledger) Subscribe(buffer int) (<-chan Event, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch := make(chan Event, buffer)
+	l.subs[ch] = true
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.subs[ch] {
+			delete(l.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// errNotDeployed answers the calls to a chaincode name the ledger does not know
+func errNotDeployed(name string) error {
+	return errors.New("chaincode " + name + " is not deployed")
+}
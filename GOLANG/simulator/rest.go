@@ -0,0 +1,293 @@
+package simulator
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// JSON-RPC error codes of the peer's /chaincode endpoint
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcDeployFailure  = -32001
+	rpcInvokeFailure  = -32002
+	rpcQueryFailure   = -32003
+)
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  *struct {
+		Type        int `json:"type"`
+		ChaincodeID struct {
+			Path string `json:"path"`
+			Name string `json:"name"`
+		} `json:"chaincodeID"`
+		CtorMsg struct {
+			Args []string `json:"args"`
+		} `json:"ctorMsg"`
+		SecureContext string `json:"secureContext"`
+	} `json:"params"`
+	ID interface{} `json:"id"`
+}
+
+type rpcResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Result  *rpcResult  `json:"result,omitempty"`
+	Error   *rpcError   `json:"error,omitempty"`
+	ID      interface{} `json:"id"`
+}
+
+// Handler serves the REST interface of a peer on top of the ledger. The
+// registrar logs in the enrollment ids registered with SetSecret, and only
+// for the host that logged them in: a chaincode call is made as the
+// secureContext it names when that id is logged in from the caller's host,
+// it fails otherwise.
+func (l *Ledger) Handler() http.Handler {
+	h := &handler{l: l, users: make(map[string]map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chaincode", h.chaincode)
+	mux.HandleFunc("/chain", h.chain)
+	mux.HandleFunc("/chain/blocks/", h.block)
+	mux.HandleFunc("/transactions/", h.transaction)
+	mux.HandleFunc("/registrar", h.login)
+	mux.HandleFunc("/registrar/", h.loggedIn)
+	return mux
+}
+
+type handler struct {
+	l *Ledger
+
+	mu    sync.Mutex
+	users map[string]map[string]bool //hosts each enrollment id is logged in from
+}
+
+// host is the address a request comes from, without its port
+func host(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return h
+	}
+	return r.RemoteAddr
+}
+
+// loggedInFrom tells whether enrollID logged in from the host of r
+func (h *handler) loggedInFrom(enrollID string, r *http.Request) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.users[enrollID][host(r)]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// restError is the body of a failed REST call
+func restError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"Error": msg})
+}
+
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		restError(w, http.StatusMethodNotAllowed, r.Method+" is not allowed")
+		return false
+	}
+	return true
+}
+
+// ============================================================================================================================
+// POST /chaincode - deploy, invoke and query over JSON-RPC 2.0
+// ============================================================================================================================
+func (h *handler) chaincode(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "POST") {
+		return
+	}
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcParseError, Message: "Parse error", Data: err.Error()}})
+		return
+	}
+	answer := func(res *rpcResult, rpcErr *rpcError) {
+		status := http.StatusOK
+		if rpcErr != nil && rpcErr.Code < rpcQueryFailure { //malformed calls, not failed ones
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, rpcResponse{JSONRPC: "2.0", Result: res, Error: rpcErr, ID: req.ID})
+	}
+	if req.JSONRPC != "2.0" || req.Params == nil {
+		answer(nil, &rpcError{Code: rpcInvalidRequest, Message: "Invalid request", Data: "jsonrpc must be 2.0 and params must be set"})
+		return
+	}
+	p := req.Params
+	if len(p.CtorMsg.Args) == 0 {
+		answer(nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: "ctorMsg.args must name the function"})
+		return
+	}
+	user := p.SecureContext
+	if !h.loggedInFrom(user, r) {
+		code, msg := rpcInvokeFailure, "Invoke failure"
+		switch req.Method {
+		case "deploy":
+			code, msg = rpcDeployFailure, "Deploy failure"
+		case "query":
+			code, msg = rpcQueryFailure, "Query failure"
+		}
+		answer(nil, &rpcError{Code: code, Message: msg, Data: "User " + user + " must log in."})
+		return
+	}
+
+	switch req.Method {
+	case "deploy":
+		if p.ChaincodeID.Path == "" {
+			answer(nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params", Data: "chaincodeID.path must be set"})
+			return
+		}
+		name, res, err := h.l.Deploy(user, p.ChaincodeID.Path, p.CtorMsg.Args)
+		if err != nil {
+			answer(nil, &rpcError{Code: rpcDeployFailure, Message: "Deploy failure", Data: err.Error()})
+		} else if res.Status >= shim.ERRORTHRESHOLD {
+			answer(nil, &rpcError{Code: rpcDeployFailure, Message: "Deploy failure", Data: failure(res.Payload, res.Message)})
+		} else {
+			answer(&rpcResult{Status: "OK", Message: name}, nil)
+		}
+	case "invoke", "query":
+		if !h.l.Deployed(p.ChaincodeID.Name) {
+			code, msg := rpcInvokeFailure, "Invoke failure"
+			if req.Method == "query" {
+				code, msg = rpcQueryFailure, "Query failure"
+			}
+			answer(nil, &rpcError{Code: code, Message: msg, Data: errNotDeployed(p.ChaincodeID.Name).Error()})
+			return
+		}
+		function, args := p.CtorMsg.Args[0], p.CtorMsg.Args[1:]
+		if req.Method == "query" {
+			res, err := h.l.Query(user, function, args)
+			if err != nil {
+				answer(nil, &rpcError{Code: rpcQueryFailure, Message: "Query failure", Data: err.Error()})
+			} else if res.Status >= shim.ERRORTHRESHOLD {
+				answer(nil, &rpcError{Code: rpcQueryFailure, Message: "Query failure", Data: failure(res.Payload, res.Message)})
+			} else {
+				answer(&rpcResult{Status: "OK", Message: string(res.Payload)}, nil)
+			}
+			return
+		}
+		txID, res, err := h.l.Invoke(user, function, args)
+		if err != nil {
+			answer(nil, &rpcError{Code: rpcInvokeFailure, Message: "Invoke failure", Data: err.Error()})
+		} else if res.Status >= shim.ERRORTHRESHOLD {
+			answer(nil, &rpcError{Code: rpcInvokeFailure, Message: "Invoke failure", Data: failure(res.Payload, res.Message)})
+		} else {
+			answer(&rpcResult{Status: "OK", Message: txID}, nil)
+		}
+	default:
+		answer(nil, &rpcError{Code: rpcMethodNotFound, Message: "Method not found", Data: "the method must be deploy, invoke or query"})
+	}
+}
+
+// failure is the error data of a failed call, the chaincode's envelope when it answered one
+func failure(payload []byte, message string) string {
+	if len(payload) > 0 {
+		return string(payload)
+	}
+	return message
+}
+
+// ============================================================================================================================
+// GET /chain, /chain/blocks/{n} and /transactions/{txid}
+// ============================================================================================================================
+func (h *handler) chain(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.l.info())
+}
+
+func (h *handler) block(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/chain/blocks/"), 10, 64)
+	if err != nil {
+		restError(w, http.StatusBadRequest, "Block number must be a non-negative integer")
+		return
+	}
+	b, ok := h.l.Block(n)
+	if !ok {
+		restError(w, http.StatusNotFound, "Requested block not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (h *handler) transaction(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	tx, _, ok := h.l.Transaction(strings.TrimPrefix(r.URL.Path, "/transactions/"))
+	if !ok {
+		restError(w, http.StatusNotFound, "Requested transaction not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, tx)
+}
+
+// ============================================================================================================================
+// POST /registrar, GET /registrar/{enrollmentID}
+// ============================================================================================================================
+func (h *handler) login(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "POST") {
+		return
+	}
+	var req struct {
+		EnrollID     string `json:"enrollId"`
+		EnrollSecret string `json:"enrollSecret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.EnrollID == "" {
+		restError(w, http.StatusBadRequest, "enrollId and enrollSecret must be set")
+		return
+	}
+	if !h.l.checkSecret(req.EnrollID, req.EnrollSecret) {
+		restError(w, http.StatusUnauthorized, "Login failed for user '"+req.EnrollID+"'")
+		return
+	}
+	h.mu.Lock()
+	if h.users[req.EnrollID] == nil {
+		h.users[req.EnrollID] = make(map[string]bool)
+	}
+	h.users[req.EnrollID][host(r)] = true
+	h.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"OK": "Login successful for user '" + req.EnrollID + "'."})
+}
+
+func (h *handler) loggedIn(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, "GET") {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/registrar/")
+	if !h.loggedInFrom(id, r) {
+		restError(w, http.StatusUnauthorized, "User "+id+" must log in.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"OK": "User " + id + " is already logged in."})
+}
@@ -0,0 +1,228 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/chaincode"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/client"
+	"github.com/CCPX-system/CCPX-blockchain/GOLANG/peer"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func openCCPX(t *testing.T, dir string) *Ledger {
+	l, err := Open(dir, new(chaincode.SimpleChaincode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetAttributes("admin", map[string]string{"role": "admin"})
+	l.SetSecret("admin", "adminpw")
+	l.SetSecret("bob", "bobpw")
+	return l
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(v)
+	return resp.StatusCode
+}
+
+func TestREST(t *testing.T) {
+	l := openCCPX(t, "")
+	defer l.Close()
+	srv := httptest.NewServer(l.Handler())
+	defer srv.Close()
+
+	admin := &client.RPCTransport{Peer: &peer.Client{URL: srv.URL, EnrollID: "admin", EnrollSecret: "adminpw"}}
+	if _, err := client.New(admin).PointIDs(); err == nil {
+		t.Error("query before deploy answered")
+	}
+	name, err := admin.Deploy("github.com/CCPX-system/CCPX-blockchain/GOLANG/ccpx", []string{"99"})
+	if err != nil || name != ChaincodeName("github.com/CCPX-system/CCPX-blockchain/GOLANG/ccpx", []string{"init", "99"}) {
+		t.Fatalf("deploy: %s %v", name, err)
+	}
+	if err := admin.Peer.Ready(name, time.Millisecond, time.Second); err != nil {
+		t.Errorf("deployment not committed: %v", err)
+	}
+
+	cc := client.New(admin)
+	txID, err := cc.CreatePoint("p1", "bob")
+	if err != nil {
+		t.Fatalf("CreatePoint: %v", err)
+	}
+	if _, err := cc.CreatePoint("p1", "bob"); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("second CreatePoint: %v", err)
+	}
+	//a call is made as the secureContext it names only once that id logged in with its secret
+	for _, p := range []*peer.Client{{URL: srv.URL, EnrollID: "bob"}, {URL: srv.URL, EnrollID: "bob", EnrollSecret: "adminpw"}, {URL: srv.URL, EnrollID: "eve", EnrollSecret: "evepw"}} {
+		if _, err := client.New(&client.RPCTransport{Peer: p, Name: name}).Point("p1"); err == nil {
+			t.Errorf("%s called with secret %q", p.EnrollID, p.EnrollSecret)
+		}
+		if in, _ := p.LoggedIn(); in {
+			t.Errorf("%s logged in with secret %q", p.EnrollID, p.EnrollSecret)
+		}
+	}
+	bob := client.New(&client.RPCTransport{Peer: &peer.Client{URL: srv.URL, EnrollID: "bob", EnrollSecret: "bobpw"}, Name: name})
+	if _, err := bob.DeletePoint("p1"); !errors.Is(err, client.ErrNoPermission) {
+		t.Errorf("DeletePoint without the admin role: %v", err)
+	}
+	if p, err := bob.Point("p1"); err != nil || p.Owner != "bob" {
+		t.Errorf("Point: %+v %v", p, err)
+	}
+
+	var info chainInfo
+	if code := getJSON(t, srv.URL+"/chain", &info); code != http.StatusOK || info.Height != 3 {
+		t.Errorf("/chain: %d %+v", code, info) //genesis, deploy, init_point
+	}
+	var b Block
+	if code := getJSON(t, srv.URL+"/chain/blocks/2", &b); code != http.StatusOK || len(b.Transactions) != 1 ||
+		b.Transactions[0].Txid != txID || b.Transactions[0].ChaincodeID != name {
+		t.Errorf("/chain/blocks/2: %d %+v", code, b)
+	}
+	if code := getJSON(t, srv.URL+"/chain/blocks/3", &b); code != http.StatusNotFound {
+		t.Errorf("/chain/blocks/3: %d", code)
+	}
+	var tx Transaction
+	if code := getJSON(t, srv.URL+"/transactions/"+txID, &tx); code != http.StatusOK || tx.Args[0] != "init_point" || tx.EnrollID != "admin" {
+		t.Errorf("/transactions: %d %+v", code, tx)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+	l := openCCPX(t, dir)
+	name, _, err := l.Deploy("admin", "ccpx", []string{"init", "99"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := client.New(l.As("admin"))
+	cc.CreatePoint("p1", "bob")
+	cc.TransferPoint("p1", "alice")
+	cc.DeletePoint("p1")
+	cc.CreatePoint("p2", "bob")
+	height := l.Height()
+	l.Close()
+
+	l = openCCPX(t, dir)
+	defer l.Close()
+	if !l.Deployed(name) || l.Height() != height {
+		t.Fatalf("reopened ledger: deployed %v, height %d, want %d", l.Deployed(name), l.Height(), height)
+	}
+	cc = client.New(l.As("bob"))
+	if ids, err := cc.PointIDs(); err != nil || len(ids) != 1 || ids[0] != "p2" {
+		t.Errorf("PointIDs: %v %v", ids, err)
+	}
+	if hist, err := cc.PointHistory("p1"); err != nil || len(hist.History) != 3 {
+		t.Errorf("PointHistory: %+v %v", hist, err)
+	}
+}
+
+// eventChaincode writes a key and sets an event, then fails or panics when asked to
+type eventChaincode struct{}
+
+func (eventChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (eventChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "get" {
+		v, _ := stub.GetState(args[0])
+		return shim.Success(v)
+	}
+	stub.PutState("k", []byte(function))
+	stub.SetEvent("called", []byte(function))
+	switch function {
+	case "panic":
+		panic("asked to")
+	case "fail":
+		return shim.Error("asked to")
+	}
+	return shim.Success(nil)
+}
+
+func TestTransactions(t *testing.T) {
+	l, err := Open("", eventChaincode{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	at := time.Date(2016, 12, 4, 8, 0, 0, 0, time.UTC)
+	l.Clock = func() time.Time { return at }
+	events, cancel := l.Subscribe(4)
+	defer cancel()
+
+	if _, res, _ := l.Invoke("bob", "ok", nil); res.Status != shim.OK || l.Height() != 2 {
+		t.Fatalf("ok: %+v, height %d", res, l.Height())
+	}
+	select {
+	case ev := <-events:
+		if ev.EventName != "called" || string(ev.Payload) != "ok" || ev.Block != 1 {
+			t.Errorf("event %+v", ev)
+		}
+	default:
+		t.Error("no event")
+	}
+	b, _ := l.Block(1)
+	if !b.NonHashData.LocalLedgerCommitTimestamp.Time().Equal(at) || len(b.Transactions[0].Writes) != 1 {
+		t.Errorf("block 1: %+v", b)
+	}
+
+	for _, fn := range []string{"fail", "panic", "query"} {
+		var res pb.Response
+		if fn == "query" {
+			res, err = l.Query("bob", fn, nil)
+		} else {
+			_, res, err = l.Invoke("bob", fn, nil)
+		}
+		if err != nil || (fn != "query" && res.Status < shim.ERRORTHRESHOLD) {
+			t.Errorf("%s: %+v %v", fn, res, err)
+		}
+		if res, _ := l.Query("bob", "get", []string{"k"}); string(res.Payload) != "ok" {
+			t.Errorf("%s changed the state, k is %q", fn, res.Payload)
+		}
+	}
+	if l.Height() != 2 || len(events) != 0 {
+		t.Errorf("uncommitted transactions cut blocks or sent events: height %d, %d events", l.Height(), len(events))
+	}
+}
+
+func TestLoginBoundToHost(t *testing.T) {
+	l := openCCPX(t, "")
+	defer l.Close()
+	h := l.Handler()
+	call := func(from string, method string, path string, body string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.RemoteAddr = from
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if strings.Contains(w.Body.String(), "must log in") {
+			return http.StatusUnauthorized
+		}
+		return w.Code
+	}
+	deploy := `{"jsonrpc":"2.0","method":"deploy","params":{"type":1,"chaincodeID":{"path":"ccpx"},"ctorMsg":{"args":["init","99"]},"secureContext":"admin"},"id":1}`
+
+	if code := call("10.0.0.1:4000", "POST", "/registrar", `{"enrollId":"admin","enrollSecret":"adminpw"}`); code != http.StatusOK {
+		t.Fatalf("login: %d", code)
+	}
+	if code := call("10.0.0.2:4000", "POST", "/chaincode", deploy); code != http.StatusUnauthorized {
+		t.Errorf("call as admin from another host: %d", code)
+	}
+	if code := call("10.0.0.2:4000", "GET", "/registrar/admin", ""); code != http.StatusUnauthorized {
+		t.Errorf("admin logged in from another host: %d", code)
+	}
+	if code := call("10.0.0.1:4001", "POST", "/chaincode", deploy); code != http.StatusOK {
+		t.Errorf("call as admin from the host that logged in: %d", code)
+	}
+}
@@ -0,0 +1,248 @@
+package simulator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// attrsOID is the certificate extension fabric-ca puts the attributes in
+var attrsOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// txStub is the ChaincodeStubInterface of one transaction. Reads see the
+// ledger state under the transaction's own writes, which only reach the
+// ledger when it commits. Stub methods a peer without private data, history
+// or rich queries cannot serve are left to the embedded nil interface and
+// panic, which fails the transaction.
+type txStub struct {
+	shim.ChaincodeStubInterface
+
+	l       *Ledger
+	tx      *Transaction
+	txID    string
+	args    [][]byte
+	creator []byte
+	now     time.Time
+	writes  map[string]*Write
+	events  []Event
+}
+
+func newTxStub(l *Ledger, txID string, args []string, creator []byte, now time.Time) *txStub {
+	s := &txStub{
+		l:       l,
+		tx:      &Transaction{Args: args, Txid: txID, Timestamp: stamp(now)},
+		txID:    txID,
+		creator: creator,
+		now:     now,
+		writes:  make(map[string]*Write),
+	}
+	for _, a := range args {
+		s.args = append(s.args, []byte(a))
+	}
+	return s
+}
+
+// writeSet is the transaction's writes, sorted by key
+func (s *txStub) writeSet() []Write {
+	var ws []Write
+	for _, w := range s.writes {
+		ws = append(ws, *w)
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].Key < ws[j].Key })
+	return ws
+}
+
+func (s *txStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *txStub) GetStringArgs() []string {
+	return s.tx.Args
+}
+
+func (s *txStub) GetFunctionAndParameters() (string, []string) {
+	if len(s.tx.Args) == 0 {
+		return "", nil
+	}
+	return s.tx.Args[0], s.tx.Args[1:]
+}
+
+func (s *txStub) GetTxID() string {
+	return s.txID
+}
+
+func (s *txStub) GetChannelID() string {
+	return "ccpx"
+}
+
+func (s *txStub) GetState(key string) ([]byte, error) {
+	if w, ok := s.writes[key]; ok {
+		return w.Value, nil
+	}
+	return s.l.state[key], nil
+}
+
+func (s *txStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	s.writes[key] = &Write{Key: key, Value: append([]byte{}, value...)}
+	return nil
+}
+
+func (s *txStub) DelState(key string) error {
+	s.writes[key] = &Write{Key: key, Delete: true}
+	return nil
+}
+
+func (s *txStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *txStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, "\x00") || !strings.HasSuffix(compositeKey, "\x00") {
+		return "", nil, errors.New("not a composite key: " + compositeKey)
+	}
+	parts := strings.Split(compositeKey[1:len(compositeKey)-1], "\x00")
+	return parts[0], parts[1:], nil
+}
+
+// GetStateByRange returns the simple keys from startKey included to endKey excluded, "" leaves a side open
+func (s *txStub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = "\x01" //composite keys start with 0x00, a range query never returns them
+	}
+	if endKey == "" {
+		endKey = string(utf8.MaxRune)
+	}
+	return s.between(startKey, endKey), nil
+}
+
+func (s *txStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return s.between(prefix, prefix+string(utf8.MaxRune)), nil
+}
+
+// between snapshots the keys in [start, end) of the state as the transaction sees it
+func (s *txStub) between(start string, end string) *iterator {
+	seen := make(map[string]bool)
+	var keys []string
+	for k := range s.l.state {
+		if k >= start && k < end {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for k := range s.writes {
+		if k >= start && k < end && !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	it := &iterator{}
+	for _, k := range keys {
+		if v, _ := s.GetState(k); v != nil {
+			it.kvs = append(it.kvs, &queryresult.KV{Namespace: s.tx.ChaincodeID, Key: k, Value: v})
+		}
+	}
+	return it
+}
+
+func (s *txStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *txStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now.Unix(), Nanos: int32(s.now.Nanosecond())}, nil
+}
+
+func (s *txStub) GetTransient() (map[string][]byte, error) {
+	return nil, nil
+}
+
+func (s *txStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be empty string")
+	}
+	s.events = append(s.events, Event{EventName: name, Payload: append([]byte{}, payload...)})
+	return nil
+}
+
+// iterator walks a snapshot of the keys of a range query
+type iterator struct {
+	kvs []*queryresult.KV
+	pos int
+}
+
+func (it *iterator) HasNext() bool {
+	return it.pos < len(it.kvs)
+}
+
+func (it *iterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more keys")
+	}
+	it.pos++
+	return it.kvs[it.pos-1], nil
+}
+
+func (it *iterator) Close() error {
+	return nil
+}
+
+// ============================================================================================================================
+// Identities
+// ============================================================================================================================
+
+// creator returns the serialized identity of enrollID, a self-signed
+// certificate carrying its attributes the way fabric-ca encodes them
+func (l *Ledger) creator(enrollID string) ([]byte, error) {
+	if id, ok := l.creators[enrollID]; ok {
+		return id, nil
+	}
+	attrs, _ := json.Marshal(map[string]map[string]string{"attrs": l.attrs[enrollID]})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(int64(len(l.creators)) + 1),
+		Subject:         pkix.Name{CommonName: enrollID},
+		NotBefore:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:        time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExtraExtensions: []pkix.Extension{{Id: attrsOID, Value: attrs}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	id, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   "CCPXMSP",
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.creators[enrollID] = id
+	return id, nil
+}
@@ -0,0 +1,44 @@
+package simulator
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Caller calls the hosted chaincode in process as one enrollment id. It
+// satisfies client.Transport and answers the chaincode's envelope for
+// invocations too.
+type Caller struct {
+	l        *Ledger
+	enrollID string
+}
+
+// As returns a Caller making its calls as enrollID
+func (l *Ledger) As(enrollID string) *Caller {
+	return &Caller{l: l, enrollID: enrollID}
+}
+
+// Invoke runs function as a transaction
+func (c *Caller) Invoke(function string, args []string) (string, []byte, error) {
+	txID, res, err := c.l.Invoke(c.enrollID, function, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if res.Status >= shim.ERRORTHRESHOLD && len(res.Payload) == 0 {
+		return txID, nil, errors.New(res.Message)
+	}
+	return txID, res.Payload, nil
+}
+
+// Query runs function and discards what it wrote
+func (c *Caller) Query(function string, args []string) ([]byte, error) {
+	res, err := c.l.Query(c.enrollID, function, args)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status >= shim.ERRORTHRESHOLD && len(res.Payload) == 0 {
+		return nil, errors.New(res.Message)
+	}
+	return res.Payload, nil
+}
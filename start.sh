@@ -4,14 +4,56 @@
 #docker rm -f $(docker ps -a -q)
 #docker rmi -f $(docker images -q)
 
-cd docker-hyperledger
-. setenv.sh
-docker-compose -f single-peer-ca.yaml up -d
+# By default the chaincode runs on the Fabric 2.x test network of fabric-samples: start.sh brings it up with a channel,
+# installs and commits the chaincode with GOLANG/deploy/fabric.sh (the peer lifecycle commands) and starts the gateway
+# on the Gateway service of org 1's peer, as User1 of org 1. FABRIC_SAMPLES must point at a fabric-samples checkout
+# with its bin directory (./install-fabric.sh binary docker).
+#
+# CCPX_NETWORK=sim ./start.sh runs the chaincode on ccpx-sim instead, for offline development only: the simulator has
+# no membership service, test_user0 logs in with CCPX_SECRET (a random one by default). CCPX_NETWORK=fabric-0.6 ./start.sh starts the 0.6 network of docker-hyperledger and deploys
+# the 0.6 chaincode of GOLANG/legacy/ccpx06 on it; the gateway is not started then, it needs the current chaincode.
 
-cd ../docker-webservice
-docker build -t ccpx/ws .
+docker build -f docker-webservice/Dockerfile -t ccpx/ws .
 
-docker network connect bridge dockerhyperledger_vp_1
+if [ "$CCPX_NETWORK" = "fabric-0.6" ]; then
+	docker volume create ccpx-deploy
+	cd docker-hyperledger
+	. setenv.sh
+	docker-compose -f single-peer-ca.yaml up -d
+	cd ..
+	docker network connect bridge dockerhyperledger_vp_1
 
-docker run --name ccpx_node --net=bridge -p 9999:8080 ccpx/ws
-#docker run --name ccpx_node --net=bridge -d -p 9999:8080 ccpx/ws
+	# deploy the 0.6 chaincode and keep its name in the manifest
+	docker run --rm --net=bridge -v ccpx-deploy:/var/lib/ccpx ccpx/ws ccpxctl deploy -legacy || exit 1
+	exit 0
+fi
+
+if [ "$CCPX_NETWORK" = "sim" ]; then
+	# test_user0 logs in with this secret, the only id the simulator lets call the chaincode
+	export CCPX_SECRET=${CCPX_SECRET:-$(head -c 16 /dev/urandom | od -An -tx1 | tr -d ' \n')}
+	docker volume create ccpx-deploy
+	docker network create ccpx
+	docker run --name ccpx_sim --net=ccpx -v ccpx-deploy:/var/lib/ccpx -d ccpx/ws \
+		ccpx-sim -listen :7050 -data /var/lib/ccpx/sim -users "test_user0=$CCPX_SECRET"
+
+	# deploy the chaincode, wait until it answers and keep its name for the gateway
+	docker run --rm --net=ccpx -e CCPX_PEER=http://ccpx_sim:7050 -e CCPX_SECRET -v ccpx-deploy:/var/lib/ccpx ccpx/ws ccpxctl deploy || exit 1
+
+	docker run --name ccpx_node --net=ccpx -e CCPX_PEER=http://ccpx_sim:7050 -e CCPX_SECRET -v ccpx-deploy:/var/lib/ccpx -p 9999:8080 ccpx/ws
+	exit 0
+fi
+
+: "${FABRIC_SAMPLES:?FABRIC_SAMPLES must point at the fabric-samples checkout to run the test network from}"
+CCPX_CHANNEL=${CCPX_CHANNEL:-mychannel}
+export PATH=$FABRIC_SAMPLES/bin:$PATH
+
+(cd "$FABRIC_SAMPLES/test-network" && ./network.sh up createChannel -c "$CCPX_CHANNEL") || exit 1
+CCPX_CHANNEL=$CCPX_CHANNEL GOLANG/deploy/fabric.sh || exit 1
+
+ORG1=$FABRIC_SAMPLES/test-network/organizations/peerOrganizations/org1.example.com
+docker run --name ccpx_node --net=fabric_test -v "$ORG1:/etc/ccpx/org1:ro" -p 9999:8080 \
+	-e CCPX_FABRIC=peer0.org1.example.com:7051 -e CCPX_CHANNEL="$CCPX_CHANNEL" -e CCPX_MSPID=Org1MSP \
+	-e CCPX_CERT=/etc/ccpx/org1/users/User1@org1.example.com/msp/signcerts/User1@org1.example.com-cert.pem \
+	-e CCPX_KEY=/etc/ccpx/org1/users/User1@org1.example.com/msp/keystore/priv_sk \
+	-e CCPX_TLS_CA=/etc/ccpx/org1/tlsca/tlsca.org1.example.com-cert.pem \
+	ccpx/ws